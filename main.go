@@ -1,10 +1,16 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	services "github.com/lumenn/bifrost-agent/services"
 	"github.com/lumenn/bifrost-agent/tasks"
@@ -14,74 +20,188 @@ import (
 	"github.com/joho/godotenv"
 )
 
-func setupRouter(llmService services.LLMService, baseURL, centralaBaseURL, centralaAPIKey, ollamaURL, openaiAPIKey, softoBaseURL string) *gin.Engine {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	r := gin.Default()
+func setupRouter(llmService services.LLMService, artifacts *services.ArtifactStore, profiles *services.ProfileSet, workspaces *services.WorkspaceManager, dryRun bool, imageService *services.ImageGenerationService, synthesizer services.Synthesizer, ollamaURL string) *gin.Engine {
+	r := gin.New()
+	r.Use(tasks.LogRequests(), gin.Recovery())
+	r.Use(tasks.RunContext(profiles, dryRun))
+	r.Use(tasks.WorkspaceContext(workspaces))
+	r.Use(tasks.ArtifactContext(artifacts))
 
 	r.GET("/ping", func(ctx *gin.Context) {
 		log.Println("[INFO] Handling ping request")
 		ctx.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
 
-	r.GET("/solveTask1", func(ctx *gin.Context) {
-		tasks.SolveTask1(ctx, llmService, baseURL)
+	r.GET("/flags", func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		ctx.JSON(http.StatusOK, gin.H{"profile": profile.Name, "flags": profile.Ledger.Flags(ctx.Query("task"))})
+	})
+
+	r.GET("/submissions", func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		list, err := profile.Submissions.Submissions(ctx.Query("task"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read submissions: %v", err)})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"profile": profile.Name, "submissions": list})
+	})
+
+	r.POST("/submissions/:id/resubmit", func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.ResubmitReport(ctx, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/mirror", func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		ctx.JSON(http.StatusOK, gin.H{"profile": profile.Name, "manifest": profile.Mirror.Manifest()})
+	})
+
+	r.POST("/mirror", func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.MirrorResources(ctx, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask2", func(ctx *gin.Context) {
-		tasks.SolveTask2(ctx, llmService, baseURL)
+	r.GET("/runs/:id/files", func(ctx *gin.Context) {
+		// Only runs of the request's profile are visible
+		profile := tasks.CurrentProfile(ctx)
+		workspace, err := workspaces.Get(profile.Name, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "run workspace not found"})
+			return
+		}
+
+		files, err := workspaces.Files(profile.Name, workspace.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list files: %v", err)})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"workspace": workspace, "files": files})
 	})
 
-	r.GET("/solveTask3", func(ctx *gin.Context) {
-		tasks.SolveTask3(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/artifacts/:id/derived", func(ctx *gin.Context) {
+		artifact, err := artifacts.Get(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+			return
+		}
+
+		derived, err := artifacts.Derivations(artifact.SHA256)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read derived artifacts: %v", err)})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"artifact": artifact, "derived": derived})
 	})
 
-	r.GET("/solveTask4", func(ctx *gin.Context) {
-		tasks.SolveTask4(ctx, llmService, centralaBaseURL, centralaAPIKey, ollamaURL)
+	r.GET("/artifacts/:id", func(ctx *gin.Context) {
+		artifact, err := artifacts.Get(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+			return
+		}
+
+		ctx.Header("Content-Type", artifact.MIMEType)
+		ctx.Header("Cache-Control", "public, max-age=31536000, immutable")
+		ctx.File(artifact.Path)
 	})
 
-	r.GET("/solveTask5", func(ctx *gin.Context) {
-		tasks.SolveTask5(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.POST("/speech", func(ctx *gin.Context) {
+		var req services.SpeechRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request body: %v", err)})
+			return
+		}
+
+		artifact, err := synthesizer.Synthesize(ctx, req)
+		if errors.Is(err, services.ErrInvalidSpeechRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to synthesize speech: %v", err)})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"artifact": artifact,
+			"url":      artifacts.URL(artifact),
+		})
 	})
 
-	r.GET("/solveTask6", func(ctx *gin.Context) {
-		tasks.SolveTask6(ctx, centralaBaseURL, centralaAPIKey, openaiAPIKey)
+	r.GET("/solveTask1", tasks.SkipIfSolved("login"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask1(ctx, llmService, profile.XYZBaseURL, profile.FormUsername, profile.FormPassword)
 	})
 
-	r.GET("/solveTask7", func(ctx *gin.Context) {
-		tasks.SolveTask7(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask2", tasks.SkipIfSolved("verify"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask2(ctx, llmService, profile.XYZBaseURL)
 	})
 
-	r.GET("/solveTask8", func(ctx *gin.Context) {
-		tasks.SolveTask8(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask3", tasks.SkipIfSolved("JSON"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask3(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask9", func(ctx *gin.Context) {
-		tasks.SolveTask9(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask4", tasks.SkipIfSolved("CENZURA"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask4(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey, ollamaURL)
 	})
 
-	r.GET("/solveTask10", func(ctx *gin.Context) {
-		tasks.SolveTask10(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask5", tasks.SkipIfSolved("mp3"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask5(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask11", func(ctx *gin.Context) {
-		tasks.SolveTask11(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask6", tasks.SkipIfSolved("robotid"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask6(ctx, imageService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask12", func(ctx *gin.Context) {
-		tasks.SolveTask12(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask7", tasks.SkipIfSolved("kategorie"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask7(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask13", func(ctx *gin.Context) {
-		tasks.SolveTask13(ctx, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask8", tasks.SkipIfSolved("arxiv"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask8(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask14", func(ctx *gin.Context) {
-		tasks.SolveTask14(ctx, llmService, centralaBaseURL, centralaAPIKey)
+	r.GET("/solveTask9", tasks.SkipIfSolved("dokumenty"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask9(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
 	})
 
-	r.GET("/solveTask15", func(ctx *gin.Context) {
-		tasks.SolveTask15(ctx, llmService, centralaBaseURL, centralaAPIKey, softoBaseURL)
+	r.GET("/solveTask10", tasks.SkipIfSolved("wektory"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask10(ctx, llmService, profile.Embedder, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/solveTask11", tasks.SkipIfSolved("database"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask11(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/solveTask12", tasks.SkipIfSolved("loop"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask12(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/solveTask13", tasks.SkipIfSolved("connections"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask13(ctx, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/solveTask14", tasks.SkipIfSolved("photos"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask14(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey)
+	})
+
+	r.GET("/solveTask15", tasks.SkipIfSolved("softo"), func(ctx *gin.Context) {
+		profile := tasks.CurrentProfile(ctx)
+		tasks.SolveTask15(ctx, llmService, profile.CentralaBaseURL, profile.CentralaAPIKey, profile.SoftoBaseURL)
 	})
 
 	return r
@@ -90,39 +210,45 @@ func setupRouter(llmService services.LLMService, baseURL, centralaBaseURL, centr
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if len(os.Args) > 1 && os.Args[1] == "centrala-mock" {
+		runCentralaMock(os.Args[2:])
+		return
+	}
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("[FATAL] Error loading .env file")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "mirror" {
+		runMirror(os.Args[2:])
+		return
+	}
+
 	ollamaURL := os.Getenv("OLLAMA_URL")
 	if ollamaURL == "" {
 		log.Fatal("[FATAL] OLLAMA_URL not specified in environment variables")
 	}
 
-	softoBaseURL := os.Getenv("SOFTO_BASE_URL")
-	if softoBaseURL == "" {
-		log.Fatal("[FATAL] SOFTO_BASE_URL not specified in environment variables")
-	}
-
 	apiKey := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("XYZ_BASE_URL")
 
-	centralaBaseURL := os.Getenv("CENTRALA_BASE_URL")
-	if centralaBaseURL == "" {
-		log.Fatal("[FATAL] CENTRALA_BASE_URL environment variable is not set")
+	profileConfig, err := loadProfileConfig()
+	if err != nil {
+		log.Fatal("[FATAL] Error loading profiles:", err)
 	}
 
-	centralaAPIKey := os.Getenv("CENTRALA_API_KEY")
-	if centralaAPIKey == "" {
-		log.Fatal("[FATAL] CENTRALA_API_KEY environment variable is not set")
+	profiles, err := services.NewProfileSet(profileConfig, profileDataDir(), apiKey)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing profiles:", err)
 	}
 
-	if baseURL == "" {
-		log.Fatal("[FATAL] XYZ_BASE_URL environment variable is not set")
+	if err := configureLogging(profiles, apiKey); err != nil {
+		log.Fatal("[FATAL] Error configuring logging:", err)
 	}
 
-	baseURL = strings.TrimRight(baseURL, "/")
+	if err := configureHTTPClient(profiles, apiKey); err != nil {
+		log.Fatal("[FATAL] Error configuring HTTP client:", err)
+	}
 
 	systemPrompt := `You are a helpful assistant that answers questions by providing street names. 
 Return your answer in this format: { "question": "this is a question?", "answer": "street name" }. 
@@ -134,7 +260,381 @@ Be concise and return only the JSON response.
 		log.Fatal("[FATAL] Error initializing LLM Service:", err)
 	}
 
-	r := setupRouter(llmService, baseURL, centralaBaseURL, centralaAPIKey, ollamaURL, apiKey, softoBaseURL)
+	artifactDir := os.Getenv("ARTIFACT_DIR")
+	if artifactDir == "" {
+		artifactDir = "data/artifacts"
+	}
+
+	// Public address of this server, used for links that must outlive provider URLs.
+	publicURL := os.Getenv("BIFROST_PUBLIC_URL")
+	if publicURL == "" {
+		log.Println("[WARN] BIFROST_PUBLIC_URL not set - stored artifacts will not have public URLs")
+	}
+
+	artifacts, err := services.NewArtifactStore(artifactDir, publicURL)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing artifact store:", err)
+	}
+
+	llmService.WithArtifacts(artifacts)
+
+	imageService, err := services.NewImageGenerationService(apiKey, artifacts)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing image generation service:", err)
+	}
+
+	// TTS_BASE_URL points speech synthesis at a local OpenAI-compatible server.
+	ttsAPIKey := os.Getenv("TTS_API_KEY")
+	if ttsAPIKey == "" {
+		ttsAPIKey = apiKey
+	}
+	synthesizer, err := services.NewOpenAISynthesizer(ttsAPIKey, os.Getenv("TTS_BASE_URL"), openai.SpeechModel(os.Getenv("TTS_MODEL")), artifacts)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing speech synthesizer:", err)
+	}
+
+	workspaces, err := newWorkspaceManager(profiles)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing workspaces:", err)
+	}
+
+	embedder, err := newEmbedder(apiKey, ollamaURL)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing embedder:", err)
+	}
+
+	// Each profile caches its vectors in an artifact store of its own.
+	for _, profile := range profiles.All() {
+		embeddings, err := services.NewArtifactStore(filepath.Join(profile.DataDir, "embeddings"), "")
+		if err != nil {
+			log.Fatal("[FATAL] Error initializing embedding cache:", err)
+		}
+		if profile.Embedder, err = services.NewCachedEmbedder(embedder, embeddings); err != nil {
+			log.Fatal("[FATAL] Error initializing embedding cache:", err)
+		}
+	}
+
+	// DRY_RUN=true computes answers without submitting them, unless a request
+	// overrides it.
+	dryRun, _ := strconv.ParseBool(os.Getenv("DRY_RUN"))
+	if dryRun {
+		log.Println("[WARN] DRY_RUN enabled - answers will not be submitted to Centrala")
+	}
+
+	r := setupRouter(llmService, artifacts, profiles, workspaces, dryRun, imageService, synthesizer, ollamaURL)
 	log.Println("[INFO] Starting server on :8080")
 	r.Run(":8080")
 }
+
+// newEmbedder builds the embedder selected by EMBEDDING_PROVIDER ("openai" by
+// default, or "ollama"), EMBEDDING_MODEL and EMBEDDING_DIMENSIONS. Caching is
+// added by the caller.
+func newEmbedder(openaiAPIKey, ollamaURL string) (services.Embedder, error) {
+	model := os.Getenv("EMBEDDING_MODEL")
+
+	var embedder services.Embedder
+	var err error
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "", "openai":
+		dimensions := 0
+		if value := os.Getenv("EMBEDDING_DIMENSIONS"); value != "" {
+			if dimensions, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid EMBEDDING_DIMENSIONS: %w", err)
+			}
+		}
+		embedder, err = services.NewOpenAIEmbedder(openaiAPIKey, openai.EmbeddingModel(model), dimensions)
+	case "ollama":
+		embedder, err = services.NewOllamaEmbedder(ollamaURL, model)
+	default:
+		return nil, fmt.Errorf("unsupported EMBEDDING_PROVIDER %q", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return embedder, nil
+}
+
+// loadProfileConfig reads the profiles file named by PROFILES_PATH. Without
+// one, a single "default" profile is built from the CENTRALA_*, XYZ_* and
+// SOFTO_BASE_URL environment variables.
+func loadProfileConfig() (*services.ProfileConfig, error) {
+	if path := os.Getenv("PROFILES_PATH"); path != "" {
+		return services.LoadProfileConfig(path)
+	}
+
+	if os.Getenv("XYZ_BASE_URL") == "" {
+		return nil, fmt.Errorf("XYZ_BASE_URL environment variable is not set")
+	}
+	if os.Getenv("SOFTO_BASE_URL") == "" {
+		return nil, fmt.Errorf("SOFTO_BASE_URL not specified in environment variables")
+	}
+
+	return &services.ProfileConfig{
+		Default: "default",
+		Profiles: []services.Profile{{
+			Name:            "default",
+			CentralaAPIKey:  os.Getenv("CENTRALA_API_KEY"),
+			CentralaBaseURL: os.Getenv("CENTRALA_BASE_URL"),
+			XYZBaseURL:      os.Getenv("XYZ_BASE_URL"),
+			SoftoBaseURL:    os.Getenv("SOFTO_BASE_URL"),
+			FormUsername:    os.Getenv("XYZ_FORM_USERNAME"),
+			FormPassword:    os.Getenv("XYZ_FORM_PASSWORD"),
+		}},
+	}, nil
+}
+
+// configureLogging installs the structured logger configured by LOG_LEVEL
+// (debug, info, warn or error), LOG_FORMAT (text or json) and
+// LOG_PII_PATTERNS (";"-separated regular expressions). Profile keys and
+// passwords, plus any extra secrets, are masked in every record.
+func configureLogging(profiles *services.ProfileSet, secrets ...string) error {
+	config := services.LogConfig{
+		Level:   os.Getenv("LOG_LEVEL"),
+		Format:  os.Getenv("LOG_FORMAT"),
+		Secrets: append(secrets, profileSecrets(profiles)...),
+	}
+	for _, pattern := range strings.Split(os.Getenv("LOG_PII_PATTERNS"), ";") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			config.PIIPatterns = append(config.PIIPatterns, pattern)
+		}
+	}
+
+	logger, err := services.NewLogger(os.Stderr, config)
+	if err != nil {
+		return err
+	}
+	services.InstallLogger(logger)
+	return nil
+}
+
+// profileSecrets returns the keys and passwords of every profile.
+func profileSecrets(profiles *services.ProfileSet) []string {
+	if profiles == nil {
+		return nil
+	}
+
+	var secrets []string
+	for _, profile := range profiles.All() {
+		secrets = append(secrets, profile.CentralaAPIKey, profile.FormPassword)
+	}
+	return secrets
+}
+
+// configureHTTPClient sets up the HTTP clients from HTTP_TIMEOUT (a duration
+// such as "30s"), HTTP_MAX_ATTEMPTS and HTTP_MAX_BODY_BYTES: the default
+// client, and a client per profile with the disk cache described by
+// newHTTPCache. Profile keys and passwords, plus any extra secrets, are
+// redacted from their errors and cached URLs.
+func configureHTTPClient(profiles *services.ProfileSet, secrets ...string) error {
+	config := services.HTTPClientConfig{}
+	config.Secrets = append(secrets, profileSecrets(profiles)...)
+	var err error
+
+	if value := os.Getenv("HTTP_TIMEOUT"); value != "" {
+		if config.Timeout, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid HTTP_TIMEOUT: %w", err)
+		}
+	}
+	if value := os.Getenv("HTTP_MAX_ATTEMPTS"); value != "" {
+		if config.MaxAttempts, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid HTTP_MAX_ATTEMPTS: %w", err)
+		}
+	}
+	if value := os.Getenv("HTTP_MAX_BODY_BYTES"); value != "" {
+		if config.MaxBodyBytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid HTTP_MAX_BODY_BYTES: %w", err)
+		}
+	}
+
+	client, err := services.NewHTTPClient(config)
+	if err != nil {
+		return err
+	}
+	services.SetDefaultHTTPClient(client)
+
+	for _, profile := range profiles.All() {
+		profileConfig := config
+		if profileConfig.Transport, err = newHTTPCache(profile, config.Secrets); err != nil {
+			return err
+		}
+		if profile.HTTPClient, err = services.NewHTTPClient(profileConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newHTTPCache builds the disk cache for a profile's plain HTTP downloads in
+// its data directory (HTTP_CACHE=off disables it). Responses are revalidated
+// once older than HTTP_CACHE_MAX_AGE (0 by default), or the per-host durations
+// in HTTP_CACHE_HOST_MAX_AGE ("host=1h,other=10m"). secrets are redacted from
+// the stored URLs.
+func newHTTPCache(profile *services.Profile, secrets []string) (http.RoundTripper, error) {
+	if os.Getenv("HTTP_CACHE") == "off" {
+		return nil, nil
+	}
+
+	config := services.HTTPCacheConfig{HostMaxAge: make(map[string]time.Duration), Secrets: secrets}
+	var err error
+	if value := os.Getenv("HTTP_CACHE_MAX_AGE"); value != "" {
+		if config.DefaultMaxAge, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid HTTP_CACHE_MAX_AGE: %w", err)
+		}
+	}
+	for _, override := range strings.Split(os.Getenv("HTTP_CACHE_HOST_MAX_AGE"), ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		host, value, ok := strings.Cut(override, "=")
+		maxAge, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid HTTP_CACHE_HOST_MAX_AGE entry %q", override)
+		}
+		config.HostMaxAge[strings.TrimSpace(host)] = maxAge
+	}
+
+	return services.NewHTTPCache(filepath.Join(profile.DataDir, "http-cache"), nil, config)
+}
+
+// profileDataDir is where each profile keeps its flags, submissions, mirror
+// and caches (PROFILE_DATA_DIR, data/profiles by default).
+func profileDataDir() string {
+	if dir := os.Getenv("PROFILE_DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "data/profiles"
+}
+
+// newWorkspaceManager keeps per-run working directories in WORKSPACE_DIR
+// (data/workspaces by default), in one directory per profile. Idle workspaces
+// are removed after WORKSPACE_TTL (24h by default, 0 keeps them) and, oldest
+// first, while they take more than WORKSPACE_MAX_BYTES. The profile's mirror
+// is linked into each one.
+func newWorkspaceManager(profiles *services.ProfileSet) (*services.WorkspaceManager, error) {
+	config := services.WorkspaceConfig{
+		Root: os.Getenv("WORKSPACE_DIR"),
+		TTL:  24 * time.Hour,
+		Shared: func(name string) map[string]string {
+			profile, err := profiles.Get(name)
+			if err != nil {
+				return nil
+			}
+			return map[string]string{"mirror": profile.Mirror.Root()}
+		},
+	}
+	if config.Root == "" {
+		config.Root = "data/workspaces"
+	}
+
+	var err error
+	if value := os.Getenv("WORKSPACE_TTL"); value != "" {
+		if config.TTL, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid WORKSPACE_TTL: %w", err)
+		}
+	}
+	if value := os.Getenv("WORKSPACE_MAX_BYTES"); value != "" {
+		if config.MaxBytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid WORKSPACE_MAX_BYTES: %w", err)
+		}
+	}
+
+	workspaces, err := services.NewWorkspaceManager(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := workspaces.Collect(); err != nil {
+		log.Printf("[WARN] Workspace garbage collection failed: %v", err)
+	}
+	return workspaces, nil
+}
+
+// runMirror fetches every known Centrala resource into the mirror of one
+// profile, so its later runs can work offline.
+func runMirror(args []string) {
+	flags := flag.NewFlagSet("mirror", flag.ExitOnError)
+	profileName := flags.String("profile", "", "profile whose key is used for /data (default profile if empty)")
+	refresh := flags.Bool("refresh", false, "fetch resources that are already mirrored again")
+	verify := flags.Bool("verify", false, "only check the checksums of mirrored resources")
+	flags.Parse(args)
+
+	profileConfig, err := loadProfileConfig()
+	if err != nil {
+		log.Fatal("[FATAL] Error loading profiles:", err)
+	}
+	profiles, err := services.NewProfileSet(profileConfig, profileDataDir())
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing profiles:", err)
+	}
+	profile, err := profiles.Get(*profileName)
+	if err != nil {
+		log.Fatal("[FATAL] Error selecting profile:", err)
+	}
+	mirror := profile.Mirror
+
+	if *verify {
+		problems := mirror.Verify()
+		for _, problem := range problems {
+			log.Printf("[ERROR] %s", problem)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("[FATAL] %d mirrored resources failed verification", len(problems))
+		}
+		log.Printf("[INFO] All %d mirrored resources verified", len(mirror.Manifest()))
+		return
+	}
+
+	if err := configureLogging(profiles); err != nil {
+		log.Fatal("[FATAL] Error configuring logging:", err)
+	}
+	if err := configureHTTPClient(profiles); err != nil {
+		log.Fatal("[FATAL] Error configuring HTTP client:", err)
+	}
+
+	centralaService := services.NewCentralaService(profile.CentralaBaseURL, profile.CentralaAPIKey, nil).
+		WithMirror(mirror, *refresh).
+		WithHTTPClient(profile.HTTPClient)
+	results, err := centralaService.MirrorKnownResources()
+	if err != nil {
+		log.Fatal("[FATAL] Error mirroring resources:", err)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			log.Printf("[ERROR] %s: %s", result.Resource, result.Error)
+			continue
+		}
+		log.Printf("[INFO] %s: %s (%d bytes)", result.Resource, result.Version.SHA256, result.Version.Size)
+	}
+	if failed > 0 {
+		log.Fatalf("[FATAL] Failed to mirror %d of %d resources", failed, len(results))
+	}
+}
+
+// runCentralaMock serves the Centrala emulator so tasks can run offline with
+// CENTRALA_BASE_URL pointing at it.
+func runCentralaMock(args []string) {
+	flags := flag.NewFlagSet("centrala-mock", flag.ExitOnError)
+	fixturesDir := flags.String("fixtures", "fixtures/centrala", "directory with centrala.json, data/ and dane/")
+	addr := flags.String("addr", ":8081", "address to listen on")
+	flags.Parse(args)
+
+	if err := configureLogging(nil); err != nil {
+		log.Fatal("[FATAL] Error configuring logging:", err)
+	}
+
+	fixtures, err := services.LoadCentralaFixtures(*fixturesDir)
+	if err != nil {
+		log.Fatal("[FATAL] Error loading Centrala fixtures:", err)
+	}
+
+	emulator, err := services.NewCentralaEmulator(fixtures)
+	if err != nil {
+		log.Fatal("[FATAL] Error initializing Centrala emulator:", err)
+	}
+
+	log.Printf("[INFO] Starting Centrala emulator on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, emulator))
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DryRunReport is a report that was computed but not submitted. Accepted is
+// the answer that earned the task's flag, Diff lists where the new answer
+// differs from it and Matches is true when it does not; all three are empty
+// when the task has no accepted answer yet.
+type DryRunReport struct {
+	Task     string                 `json:"task"`
+	Payload  map[string]interface{} `json:"payload"`
+	Accepted interface{}            `json:"accepted,omitempty"`
+	Diff     []AnswerChange         `json:"diff,omitempty"`
+	Matches  bool                   `json:"matchesAccepted"`
+}
+
+// AnswerChange is one difference between two answers. Path uses JSON pointer
+// style ("/01", "/2/name"); an empty path means the whole answer.
+type AnswerChange struct {
+	Path     string      `json:"path"`
+	Previous interface{} `json:"previous,omitempty"`
+	Current  interface{} `json:"current,omitempty"`
+}
+
+// DiffAnswers compares two answers as they would be sent as JSON.
+func DiffAnswers(previous, current interface{}) []AnswerChange {
+	var changes []AnswerChange
+	diffJSONValues("", normalizeJSONValue(previous), normalizeJSONValue(current), &changes)
+	return changes
+}
+
+func diffJSONValues(path string, previous, current interface{}, changes *[]AnswerChange) {
+	switch prev := previous.(type) {
+	case map[string]interface{}:
+		cur, ok := current.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(prev)+len(cur))
+		for key := range prev {
+			keys = append(keys, key)
+		}
+		for key := range cur {
+			if _, seen := prev[key]; !seen {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			diffJSONValues(path+"/"+key, prev[key], cur[key], changes)
+		}
+		return
+
+	case []interface{}:
+		cur, ok := current.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < max(len(prev), len(cur)); i++ {
+			var p, c interface{}
+			if i < len(prev) {
+				p = prev[i]
+			}
+			if i < len(cur) {
+				c = cur[i]
+			}
+			diffJSONValues(fmt.Sprintf("%s/%d", path, i), p, c, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(previous, current) {
+		*changes = append(*changes, AnswerChange{Path: path, Previous: previous, Current: current})
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AnswerSchema is the subset of JSON Schema used to describe report answers.
+// Fields mirror the keywords of the same name; NoAdditionalProperties stands
+// for "additionalProperties": false.
+type AnswerSchema struct {
+	Type                   string
+	Enum                   []interface{}
+	Pattern                string
+	MinLength              int
+	Items                  *AnswerSchema
+	MinItems               int
+	MaxItems               int
+	Properties             map[string]*AnswerSchema
+	Required               []string
+	AdditionalProperties   *AnswerSchema
+	NoAdditionalProperties bool
+	PropertyNames          *AnswerSchema
+}
+
+// Validate checks a JSON-normalised value and returns one problem per
+// violation, each prefixed with its JSON pointer path.
+func (s *AnswerSchema) Validate(value interface{}) []string {
+	var problems []string
+	s.validate("", value, &problems)
+	return problems
+}
+
+func (s *AnswerSchema) validate(path string, value interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := path
+		if location == "" {
+			location = "/"
+		}
+		*problems = append(*problems, location+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && !matchesSchemaType(s.Type, value) {
+		fail("expected %s, got %s", s.Type, jsonTypeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if answersMatch(allowed, value, false) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %v is not one of %v", value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if len([]rune(v)) < s.MinLength {
+			fail("expected at least %d characters, got %d", s.MinLength, len([]rune(v)))
+		}
+		if s.Pattern != "" {
+			if matched, err := regexp.MatchString(s.Pattern, v); err != nil {
+				fail("invalid pattern %s: %v", s.Pattern, err)
+			} else if !matched {
+				fail("%q does not match %s", v, s.Pattern)
+			}
+		}
+
+	case []interface{}:
+		if len(v) < s.MinItems {
+			fail("expected at least %d items, got %d", s.MinItems, len(v))
+		}
+		if s.MaxItems > 0 && len(v) > s.MaxItems {
+			fail("expected at most %d items, got %d", s.MaxItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s/%d", path, i), item, problems)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				fail("missing required property %q", key)
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if s.PropertyNames != nil {
+				s.PropertyNames.validate(path+"/"+key, key, problems)
+			}
+
+			if property, ok := s.Properties[key]; ok {
+				property.validate(path+"/"+key, v[key], problems)
+			} else if s.NoAdditionalProperties {
+				fail("unexpected property %q", key)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(path+"/"+key, v[key], problems)
+			}
+		}
+	}
+}
+
+func matchesSchemaType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeName(value) == schemaType
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// AnswerRule declares what a task's answer must look like. Normalize repairs
+// fixable answers (casing, key padding, numeric strings...) and runs before
+// the schema check; Check adds validation the schema cannot express and only
+// runs once the schema passed. Both see JSON-normalised values.
+type AnswerRule struct {
+	Schema    *AnswerSchema
+	Normalize func(answer interface{}) (interface{}, error)
+	Check     func(answer interface{}) error
+}
+
+// AnswerValidationError is returned when an answer is rejected locally,
+// before anything is sent to Centrala.
+type AnswerValidationError struct {
+	Task     string
+	Problems []string
+}
+
+func (e *AnswerValidationError) Error() string {
+	return fmt.Sprintf("answer for task %s is invalid: %s", e.Task, strings.Join(e.Problems, "; "))
+}
+
+// AnswerRegistry holds the answer rules of every task that declared one.
+type AnswerRegistry struct {
+	rules map[string]AnswerRule
+}
+
+func NewAnswerRegistry() *AnswerRegistry {
+	return &AnswerRegistry{rules: make(map[string]AnswerRule)}
+}
+
+// Register declares the answer rule for task, replacing any previous one.
+func (r *AnswerRegistry) Register(task string, rule AnswerRule) *AnswerRegistry {
+	r.rules[task] = rule
+	return r
+}
+
+// Prepare normalises and validates answer for task and returns the value to
+// submit. Tasks without a rule are passed through unchanged.
+func (r *AnswerRegistry) Prepare(task string, answer interface{}) (interface{}, error) {
+	rule, ok := r.rules[task]
+	if !ok {
+		return answer, nil
+	}
+
+	prepared := normalizeJSONValue(answer)
+	if rule.Normalize != nil {
+		normalized, err := rule.Normalize(prepared)
+		if err != nil {
+			return nil, &AnswerValidationError{Task: task, Problems: []string{err.Error()}}
+		}
+		prepared = normalized
+	}
+
+	if rule.Schema != nil {
+		if problems := rule.Schema.Validate(prepared); len(problems) > 0 {
+			return nil, &AnswerValidationError{Task: task, Problems: problems}
+		}
+	}
+
+	// Check runs only on schema-valid answers, so it can rely on their shape.
+	if rule.Check != nil {
+		if err := rule.Check(prepared); err != nil {
+			return nil, &AnswerValidationError{Task: task, Problems: []string{err.Error()}}
+		}
+	}
+
+	return prepared, nil
+}
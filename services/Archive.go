@@ -0,0 +1,424 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultMaxArchiveFiles      = 10000
+	defaultMaxArchiveFileBytes  = 512 << 20
+	defaultMaxArchiveTotalBytes = 1 << 30
+	defaultMaxArchiveRatio      = 200
+)
+
+// ErrArchiveLimit is returned when an archive exceeds an ExtractOptions limit.
+var ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+
+// ErrWrongPassword is returned when an encrypted zip entry cannot be
+// decrypted with the given password.
+var ErrWrongPassword = errors.New("wrong archive password")
+
+// ExtractOptions controls ExtractArchive. Zero limits select the defaults.
+type ExtractOptions struct {
+	// Password decrypts legacy ZipCrypto zip entries.
+	Password string
+	// MaxFiles, MaxFileBytes and MaxTotalBytes bound the number and size of
+	// extracted files, counted from the actual data rather than the headers.
+	MaxFiles      int
+	MaxFileBytes  int64
+	MaxTotalBytes int64
+	// MaxRatio bounds the uncompressed/compressed size ratio of zip entries
+	// and of whole gzip streams.
+	MaxRatio int64
+}
+
+func (o *ExtractOptions) applyDefaults() {
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = defaultMaxArchiveFiles
+	}
+	if o.MaxFileBytes <= 0 {
+		o.MaxFileBytes = defaultMaxArchiveFileBytes
+	}
+	if o.MaxTotalBytes <= 0 {
+		o.MaxTotalBytes = defaultMaxArchiveTotalBytes
+	}
+	if o.MaxRatio <= 0 {
+		o.MaxRatio = defaultMaxArchiveRatio
+	}
+}
+
+// ExtractedFile is one regular file written by ExtractArchive.
+type ExtractedFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ExtractArchive extracts a zip, tar, tar.gz or gzip file into destDir and
+// returns the extracted files. The format is detected from the content.
+// Entries escaping destDir, symlinks and other special entries are skipped,
+// and extraction stops with ErrArchiveLimit when the options' limits are hit.
+func ExtractArchive(archivePath, destDir string, options ExtractOptions) ([]ExtractedFile, error) {
+	options.applyDefaults()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat archive: %w", err)
+	}
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(file, header)
+	header = header[:n]
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	extractor := &archiveExtractor{destDir: destDir, options: options}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		err = extractor.zip(file, info.Size())
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		err = extractor.gzip(file, info.Size(), archivePath)
+	case isTarHeader(header):
+		err = extractor.tar(file)
+	default:
+		err = fmt.Errorf("unsupported archive format")
+	}
+
+	if err != nil {
+		return extractor.files, fmt.Errorf("failed to extract %s: %w", filepath.Base(archivePath), err)
+	}
+
+	log.Printf("[INFO] Extracted %d files from %s to %s", len(extractor.files), filepath.Base(archivePath), destDir)
+	return extractor.files, nil
+}
+
+func isTarHeader(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+type archiveExtractor struct {
+	destDir    string
+	options    ExtractOptions
+	files      []ExtractedFile
+	totalBytes int64
+}
+
+func (e *archiveExtractor) zip(file io.ReaderAt, size int64) error {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range reader.File {
+		mode := entry.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			log.Printf("[WARN] Skipping special zip entry %s (%s)", entry.Name, mode.Type())
+			continue
+		}
+
+		if entry.CompressedSize64 > 0 && entry.UncompressedSize64/entry.CompressedSize64 > uint64(e.options.MaxRatio) {
+			return fmt.Errorf("%w: %s compresses %d:1", ErrArchiveLimit, entry.Name, entry.UncompressedSize64/entry.CompressedSize64)
+		}
+
+		content, err := e.openZipEntry(entry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+
+		// Also bound the ratio by the data actually produced, not the header.
+		limit := e.options.MaxFileBytes
+		if byRatio := int64(entry.CompressedSize64) * e.options.MaxRatio; entry.CompressedSize64 > 0 && byRatio < limit {
+			limit = byRatio
+		}
+
+		err = e.write(entry.Name, content, limit)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openZipEntry opens an entry, decrypting ZipCrypto entries with the
+// password. The returned reader fails if the data does not match the CRC-32.
+func (e *archiveExtractor) openZipEntry(entry *zip.File) (io.ReadCloser, error) {
+	if entry.Flags&0x1 == 0 {
+		return entry.Open()
+	}
+
+	if e.options.Password == "" {
+		return nil, fmt.Errorf("entry is encrypted and no password was given")
+	}
+	if entry.Method != zip.Store && entry.Method != zip.Deflate {
+		return nil, fmt.Errorf("unsupported encryption or compression method %d", entry.Method)
+	}
+
+	raw, err := entry.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := newZipCryptoReader(raw, e.options.Password, zipCryptoCheckByte(entry))
+	if err != nil {
+		return nil, err
+	}
+
+	var content io.ReadCloser = io.NopCloser(decrypted)
+	if entry.Method == zip.Deflate {
+		content = flate.NewReader(decrypted)
+	}
+	return &crcCheckReader{ReadCloser: content, hash: crc32.NewIEEE(), want: entry.CRC32}, nil
+}
+
+// zipCryptoCheckByte is the byte the last decrypted header byte must equal:
+// the high byte of the CRC, or of the DOS time when the CRC follows the data.
+func zipCryptoCheckByte(entry *zip.File) byte {
+	if entry.Flags&0x8 != 0 {
+		return byte(entry.ModifiedTime >> 8)
+	}
+	return byte(entry.CRC32 >> 24)
+}
+
+func (e *archiveExtractor) tar(reader io.Reader) error {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+			if err := e.write(header.Name, archive, e.options.MaxFileBytes); err != nil {
+				return err
+			}
+		default:
+			log.Printf("[WARN] Skipping special tar entry %s (type %q)", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// gzip extracts a .tar.gz, or a single gzip-compressed file named after the
+// gzip header or the archive name without ".gz".
+func (e *archiveExtractor) gzip(file io.Reader, size int64, archivePath string) error {
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+
+	// Bound the whole stream by the ratio, which also covers tar.gz bombs.
+	limited := &limitReader{reader: compressed, remaining: size * e.options.MaxRatio}
+	buffered := bufio.NewReaderSize(limited, 512)
+
+	if header, _ := buffered.Peek(512); isTarHeader(header) {
+		return e.tar(buffered)
+	}
+
+	name := path.Base(compressed.Name)
+	if compressed.Name == "" || name == "." || name == "/" {
+		name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(archivePath), ".gz"), ".tgz")
+	}
+	return e.write(name, buffered, e.options.MaxFileBytes)
+}
+
+// write extracts one regular file, refusing names that escape the
+// destination or pass through symlinks, and enforcing the size limits.
+func (e *archiveExtractor) write(name string, content io.Reader, maxBytes int64) error {
+	relative, ok := safeArchivePath(name)
+	if !ok {
+		log.Printf("[WARN] Skipping archive entry with unsafe path %q", name)
+		return nil
+	}
+
+	if len(e.files) >= e.options.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrArchiveLimit, e.options.MaxFiles)
+	}
+
+	target := filepath.Join(e.destDir, relative)
+	if err := e.ensureNoSymlinks(relative); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", relative, err)
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", relative, err)
+	}
+
+	remaining := min(maxBytes, e.options.MaxTotalBytes-e.totalBytes)
+	written, err := io.Copy(out, &limitReader{reader: content, remaining: remaining})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		if errors.Is(err, ErrArchiveLimit) {
+			return fmt.Errorf("%s: %w", relative, err)
+		}
+		return fmt.Errorf("failed to extract %s: %w", relative, err)
+	}
+
+	e.totalBytes += written
+	e.files = append(e.files, ExtractedFile{Name: filepath.ToSlash(relative), Path: target, Size: written})
+	return nil
+}
+
+// ensureNoSymlinks refuses to write through a symlink already present under
+// the destination directory.
+func (e *archiveExtractor) ensureNoSymlinks(relative string) error {
+	current := e.destDir
+	for _, part := range strings.Split(relative, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %w", current, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract %s through symlink %s", relative, current)
+		}
+	}
+	return nil
+}
+
+// safeArchivePath turns an archive entry name into a relative path that stays
+// inside the destination directory.
+func safeArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+
+	relative := filepath.FromSlash(cleaned)
+	return relative, filepath.IsLocal(relative)
+}
+
+// limitReader fails with ErrArchiveLimit once more than remaining bytes are read.
+type limitReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrArchiveLimit
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), ErrArchiveLimit
+	}
+	return n, err
+}
+
+// crcCheckReader verifies the CRC-32 of the data once it has been read.
+type crcCheckReader struct {
+	io.ReadCloser
+	hash interface {
+		io.Writer
+		Sum32() uint32
+	}
+	want uint32
+}
+
+func (r *crcCheckReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && r.hash.Sum32() != r.want {
+		return n, ErrWrongPassword
+	}
+	return n, err
+}
+
+// zipCryptoReader decrypts the traditional PKWARE ("ZipCrypto") encryption.
+type zipCryptoReader struct {
+	reader io.Reader
+	keys   [3]uint32
+}
+
+func newZipCryptoReader(reader io.Reader, password string, check byte) (*zipCryptoReader, error) {
+	z := &zipCryptoReader{reader: reader, keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.updateKeys(password[i])
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	z.decrypt(header)
+	if header[11] != check {
+		return nil, ErrWrongPassword
+	}
+	return z, nil
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.reader.Read(p)
+	z.decrypt(p[:n])
+	return n, err
+}
+
+func (z *zipCryptoReader) decrypt(buf []byte) {
+	for i, c := range buf {
+		temp := (z.keys[2] | 2) & 0xffff
+		plain := c ^ byte((temp*(temp^1))>>8)
+		z.updateKeys(plain)
+		buf[i] = plain
+	}
+}
+
+func (z *zipCryptoReader) updateKeys(b byte) {
+	z.keys[0] = crc32.IEEETable[byte(z.keys[0])^b] ^ (z.keys[0] >> 8)
+	z.keys[1] = (z.keys[1]+(z.keys[0]&0xff))*134775813 + 1
+	z.keys[2] = crc32.IEEETable[byte(z.keys[2])^byte(z.keys[1]>>24)] ^ (z.keys[2] >> 8)
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zipCryptoEncrypt encrypts a stored entry with its 12-byte header, the
+// reverse of zipCryptoReader.
+func zipCryptoEncrypt(password string, content []byte, check byte) []byte {
+	z := &zipCryptoReader{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.updateKeys(password[i])
+	}
+
+	plain := append(append(make([]byte, 11), check), content...)
+	encrypted := make([]byte, len(plain))
+	for i, p := range plain {
+		temp := (z.keys[2] | 2) & 0xffff
+		encrypted[i] = p ^ byte((temp*(temp^1))>>8)
+		z.updateKeys(p)
+	}
+	return encrypted
+}
+
+// writeEncryptedZip writes one ZipCrypto entry holding content.
+func writeEncryptedZip(t *testing.T, name, password string, content []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+
+	crc := crc32.ChecksumIEEE(content)
+	data := zipCryptoEncrypt(password, content, byte(crc>>24))
+	part, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		Flags:              0x1,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "encrypted.zip")
+	if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestExtractArchiveZipCrypto(t *testing.T) {
+	content := []byte("tajne dane z fabryki")
+	archivePath := writeEncryptedZip(t, "notes/secret.txt", "1670", content)
+
+	files, err := ExtractArchive(archivePath, t.TempDir(), ExtractOptions{Password: "1670"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "notes/secret.txt" {
+		t.Fatalf("extracted %+v", files)
+	}
+	if got, _ := os.ReadFile(files[0].Path); !bytes.Equal(got, content) {
+		t.Errorf("extracted %q, want %q", got, content)
+	}
+}
+
+func TestExtractArchiveWrongPassword(t *testing.T) {
+	archivePath := writeEncryptedZip(t, "secret.txt", "1670", []byte("tajne"))
+
+	// One in 256 wrong passwords passes the header check; this one does not.
+	if _, err := ExtractArchive(archivePath, t.TempDir(), ExtractOptions{Password: "0000"}); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("ExtractArchive() error = %v, want ErrWrongPassword", err)
+	}
+	if _, err := ExtractArchive(archivePath, t.TempDir(), ExtractOptions{}); err == nil {
+		t.Error("ExtractArchive() extracted an encrypted entry without a password")
+	}
+}
+
+func TestExtractArchiveSkipsEscapingEntries(t *testing.T) {
+	filePath := writeZipFixture(t, "escape.zip", [][2]string{
+		{"../outside.txt", "x"},
+		{"inside/ok.txt", "ok"},
+	})
+
+	dest := t.TempDir()
+	files, err := ExtractArchive(filePath, dest, ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "inside/ok.txt" {
+		t.Errorf("extracted %+v, want only the entry inside the destination", files)
+	}
+	if FileExists(filepath.Join(filepath.Dir(dest), "outside.txt")) {
+		t.Error("entry escaped the destination")
+	}
+}
+
+func TestExtractArchiveFileLimit(t *testing.T) {
+	filePath := writeZipFixture(t, "many.zip", [][2]string{{"a.txt", "a"}, {"b.txt", "b"}, {"c.txt", "c"}})
+
+	if _, err := ExtractArchive(filePath, t.TempDir(), ExtractOptions{MaxFiles: 2}); !errors.Is(err, ErrArchiveLimit) {
+		t.Errorf("ExtractArchive() error = %v, want ErrArchiveLimit", err)
+	}
+}
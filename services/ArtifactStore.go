@@ -0,0 +1,369 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// artifactIDPattern matches "<sha256><.ext>", which also keeps IDs taken from
+// URLs from escaping the store directory.
+var artifactIDPattern = regexp.MustCompile(`^[0-9a-f]{64}(\.[a-z0-9]{1,8})?$`)
+
+// artifactMIMETypes covers extensions the mime package does not know everywhere.
+var artifactMIMETypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".opus": "audio/ogg",
+	".ogg":  "audio/ogg",
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".json": "application/json",
+}
+
+// Kinds of derived artifacts.
+const (
+	DerivedTranscript       = "transcript"
+	DerivedImageDescription = "image-description"
+	DerivedOCRText          = "ocr-text"
+	DerivedEmbedding        = "embedding"
+)
+
+// Artifact is a file kept in the ArtifactStore, addressed by its content hash.
+type Artifact struct {
+	ID        string    `json:"id"`
+	SHA256    string    `json:"sha256"`
+	MIMEType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	Path      string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Derivation identifies how a derived artifact is produced from its source.
+// Params holds whatever else shapes the output, such as a prompt; only its
+// hash is stored.
+type Derivation struct {
+	Kind     string
+	Producer string
+	Version  string
+	Params   string
+}
+
+// DerivedArtifact links an artifact to the source it was produced from.
+type DerivedArtifact struct {
+	Source     string    `json:"source"`
+	Kind       string    `json:"kind"`
+	Producer   string    `json:"producer"`
+	Version    string    `json:"version"`
+	ParamsHash string    `json:"paramsHash,omitempty"`
+	ArtifactID string    `json:"artifactId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func (d *DerivedArtifact) matches(derivation Derivation) bool {
+	return d.Kind == derivation.Kind && d.Producer == derivation.Producer &&
+		d.Version == derivation.Version && d.ParamsHash == paramsHash(derivation.Params)
+}
+
+// ArtifactStore keeps generated files on local disk so they outlive the
+// (often expiring) links of the providers that produced them. Derived
+// artifacts (transcripts, descriptions...) are linked to their source's hash,
+// so work is only redone when the input or the producer changes.
+type ArtifactStore struct {
+	root          string
+	publicBaseURL string
+	mu            sync.Mutex
+}
+
+func NewArtifactStore(root, publicBaseURL string) (*ArtifactStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("artifact directory not specified")
+	}
+
+	for _, dir := range []string{"objects", "derived"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+		}
+	}
+
+	return &ArtifactStore{
+		root:          root,
+		publicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+	}, nil
+}
+
+// Put stores data under its SHA-256 and returns the artifact. ext (e.g. ".png")
+// is used for serving; when empty it is derived from the sniffed content type.
+func (s *ArtifactStore) Put(data []byte, ext string) (*Artifact, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	mimeType := http.DetectContentType(data)
+	if ext == "" {
+		ext = extensionForMIME(mimeType)
+	}
+	ext = strings.ToLower(ext)
+
+	id := hash + ext
+	if !artifactIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid artifact extension %q", ext)
+	}
+
+	path := s.objectPath(id)
+	if info, err := os.Stat(path); err == nil {
+		return s.artifact(id, info), nil
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated object.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to store artifact: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat artifact: %w", err)
+	}
+
+	log.Printf("[INFO] Stored artifact %s (%d bytes)", id, info.Size())
+	return s.artifact(id, info), nil
+}
+
+// PutFile stores the content of a local file, keeping its extension.
+func (s *ArtifactStore) PutFile(path string) (*Artifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact source: %w", err)
+	}
+	return s.Put(data, strings.ToLower(filepath.Ext(path)))
+}
+
+// Derived returns the artifact produced from source by derivation, if any.
+func (s *ArtifactStore) Derived(source *Artifact, derivation Derivation) (*Artifact, bool) {
+	links, err := s.Derivations(source.SHA256)
+	if err != nil {
+		log.Printf("[WARN] Failed to read derived artifacts of %s: %v", source.ID, err)
+		return nil, false
+	}
+
+	for i := len(links) - 1; i >= 0; i-- {
+		if links[i].matches(derivation) {
+			artifact, err := s.Get(links[i].ArtifactID)
+			if err != nil {
+				return nil, false
+			}
+			return artifact, true
+		}
+	}
+	return nil, false
+}
+
+// PutDerived stores data as the output of derivation on source and links it,
+// replacing an earlier output of the same derivation.
+func (s *ArtifactStore) PutDerived(source *Artifact, derivation Derivation, data []byte, ext string) (*Artifact, error) {
+	if derivation.Kind == "" || derivation.Producer == "" {
+		return nil, fmt.Errorf("derivation kind and producer must be set")
+	}
+
+	artifact, err := s.Put(data, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links, err := s.Derivations(source.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := links[:0]
+	for _, link := range links {
+		if !link.matches(derivation) {
+			kept = append(kept, link)
+		}
+	}
+	kept = append(kept, DerivedArtifact{
+		Source:     source.SHA256,
+		Kind:       derivation.Kind,
+		Producer:   derivation.Producer,
+		Version:    derivation.Version,
+		ParamsHash: paramsHash(derivation.Params),
+		ArtifactID: artifact.ID,
+		CreatedAt:  time.Now().UTC(),
+	})
+
+	content, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal derived artifacts: %w", err)
+	}
+	linkPath := s.derivedPath(source.SHA256)
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create derived artifact directory: %w", err)
+	}
+	tmp := linkPath + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write derived artifacts: %w", err)
+	}
+	if err := os.Rename(tmp, linkPath); err != nil {
+		return nil, fmt.Errorf("failed to write derived artifacts: %w", err)
+	}
+
+	log.Printf("[INFO] Stored %s of %s by %s %s as %s", derivation.Kind, source.ID, derivation.Producer, derivation.Version, artifact.ID)
+	return artifact, nil
+}
+
+// Derivations lists the artifacts derived from the source with the given
+// SHA-256.
+func (s *ArtifactStore) Derivations(sourceSHA256 string) ([]DerivedArtifact, error) {
+	if !artifactIDPattern.MatchString(sourceSHA256) || filepath.Ext(sourceSHA256) != "" {
+		return nil, fmt.Errorf("invalid artifact hash %q", sourceSHA256)
+	}
+
+	content, err := os.ReadFile(s.derivedPath(sourceSHA256))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read derived artifacts: %w", err)
+	}
+
+	var links []DerivedArtifact
+	if err := json.Unmarshal(content, &links); err != nil {
+		return nil, fmt.Errorf("failed to parse derived artifacts: %w", err)
+	}
+	return links, nil
+}
+
+// DeriveText returns the text derived from the file at sourcePath, running
+// produce only when the store has no output of the same derivation for the
+// file's content. The source file is stored as an artifact too.
+func (s *ArtifactStore) DeriveText(sourcePath string, derivation Derivation, produce func() (string, error)) (string, error) {
+	source, err := s.PutFile(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	if artifact, ok := s.Derived(source, derivation); ok {
+		content, err := os.ReadFile(artifact.Path)
+		if err == nil {
+			log.Printf("[DEBUG] Reusing %s of %s from %s %s", derivation.Kind, filepath.Base(sourcePath), derivation.Producer, derivation.Version)
+			return string(content), nil
+		}
+		log.Printf("[WARN] Failed to read derived artifact %s: %v", artifact.ID, err)
+	}
+
+	text, err := produce()
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.PutDerived(source, derivation, []byte(text), ".txt"); err != nil {
+		log.Printf("[WARN] Failed to store %s of %s: %v", derivation.Kind, filepath.Base(sourcePath), err)
+	}
+	return text, nil
+}
+
+// Get looks up a stored artifact by ID.
+func (s *ArtifactStore) Get(id string) (*Artifact, error) {
+	if !artifactIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid artifact id %q", id)
+	}
+
+	info, err := os.Stat(s.objectPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("artifact %s not found: %w", id, err)
+	}
+
+	return s.artifact(id, info), nil
+}
+
+// URL returns the stable bifrost URL the artifact is served from, or an empty
+// string when no public base URL is configured.
+func (s *ArtifactStore) URL(a *Artifact) string {
+	if s.publicBaseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/artifacts/%s", s.publicBaseURL, a.ID)
+}
+
+func (s *ArtifactStore) objectPath(id string) string {
+	return filepath.Join(s.root, "objects", id)
+}
+
+func (s *ArtifactStore) derivedPath(sourceSHA256 string) string {
+	return filepath.Join(s.root, "derived", sourceSHA256[:2], sourceSHA256+".json")
+}
+
+func paramsHash(params string) string {
+	if params == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(params))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *ArtifactStore) artifact(id string, info os.FileInfo) *Artifact {
+	ext := filepath.Ext(id)
+	mimeType, ok := artifactMIMETypes[ext]
+	if !ok {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	return &Artifact{
+		ID:        id,
+		SHA256:    strings.TrimSuffix(id, ext),
+		MIMEType:  mimeType,
+		Size:      info.Size(),
+		Path:      s.objectPath(id),
+		CreatedAt: info.ModTime(),
+	}
+}
+
+func extensionForMIME(mimeType string) string {
+	switch strings.SplitN(mimeType, ";", 2)[0] {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/wave":
+		return ".wav"
+	case "application/ogg":
+		return ".ogg"
+	case "text/plain":
+		return ".txt"
+	default:
+		return ".bin"
+	}
+}
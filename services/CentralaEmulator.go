@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codes returned by the emulator. Like Centrala, it rejects requests with a
+// 4xx status and a JSON body whose code field says why.
+const (
+	emulatorCodeWrongAnswer   = -1
+	emulatorCodeUnknownTask   = -2
+	emulatorCodeInvalidAPIKey = -3
+	emulatorCodeBadRequest    = -4
+	emulatorCodeNotFound      = -5
+)
+
+var (
+	showCreateTablePattern = regexp.MustCompile(`(?i)^show\s+create\s+table\s+` + "`?" + `(\w+)` + "`?" + `$`)
+	selectAllPattern       = regexp.MustCompile(`(?i)^select\s+\*\s+from\s+` + "`?" + `(\w+)` + "`?" + `$`)
+)
+
+// EmulatedTable is a table served by the emulated /apidb endpoint.
+type EmulatedTable struct {
+	Create string                   `json:"create"`
+	Rows   []map[string]interface{} `json:"rows"`
+}
+
+// ReportFixture describes how the emulator checks answers for one task.
+// Commands are canned responses for string answers that drive multi-step
+// tasks (e.g. "START" or "DARKEN IMG_1.PNG") and are not checked at all.
+type ReportFixture struct {
+	Expected   interface{}               `json:"expected"`
+	IgnoreCase bool                      `json:"ignoreCase,omitempty"`
+	Hints      []string                  `json:"hints,omitempty"`
+	Flag       string                    `json:"flag,omitempty"`
+	Commands   map[string]EntityResponse `json:"commands,omitempty"`
+}
+
+// CentralaFixtures is everything the emulator serves. Data holds per-key files
+// from /data/{apikey}/ and Dane the shared assets from /dane/, both by path.
+type CentralaFixtures struct {
+	APIKey  string                              `json:"apiKey"`
+	People  map[string][]string                 `json:"people"`
+	Places  map[string][]string                 `json:"places"`
+	Tables  map[string]EmulatedTable            `json:"tables"`
+	Queries map[string][]map[string]interface{} `json:"queries"`
+	Reports map[string]ReportFixture            `json:"reports"`
+	Data    map[string][]byte                   `json:"-"`
+	Dane    map[string][]byte                   `json:"-"`
+}
+
+// LoadCentralaFixtures reads a fixture directory laid out as:
+//
+//	centrala.json  API key, people/places graph, tables, queries and reports
+//	data/          files served from /data/{apikey}/
+//	dane/          files served from /dane/
+func LoadCentralaFixtures(dir string) (*CentralaFixtures, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "centrala.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var fixtures CentralaFixtures
+	if err := json.Unmarshal(content, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	if fixtures.Data, err = readFixtureFiles(filepath.Join(dir, "data")); err != nil {
+		return nil, err
+	}
+	if fixtures.Dane, err = readFixtureFiles(filepath.Join(dir, "dane")); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Loaded Centrala fixtures from %s - Data: %d, Dane: %d, Reports: %d",
+		dir, len(fixtures.Data), len(fixtures.Dane), len(fixtures.Reports))
+	return &fixtures, nil
+}
+
+// readFixtureFiles loads every file below root keyed by its slash-separated
+// relative path. A missing directory yields no files.
+func readFixtureFiles(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture files from %s: %w", root, err)
+	}
+
+	return files, nil
+}
+
+// EmulatedReport is a /report submission received by the emulator.
+type EmulatedReport struct {
+	Task     string         `json:"task"`
+	Answer   interface{}    `json:"answer"`
+	Response EntityResponse `json:"response"`
+}
+
+// CentralaEmulator is an http.Handler that imitates Centrala from fixtures, so
+// tasks can run offline or against an httptest.Server.
+type CentralaEmulator struct {
+	fixtures *CentralaFixtures
+	mux      *http.ServeMux
+
+	mu      sync.Mutex
+	reports []EmulatedReport
+}
+
+func NewCentralaEmulator(fixtures *CentralaFixtures) (*CentralaEmulator, error) {
+	if fixtures == nil {
+		return nil, fmt.Errorf("fixtures not specified")
+	}
+
+	if fixtures.APIKey == "" {
+		return nil, fmt.Errorf("fixture API key not specified")
+	}
+
+	e := &CentralaEmulator{
+		fixtures: fixtures,
+		mux:      http.NewServeMux(),
+	}
+
+	e.mux.HandleFunc("GET /data/{key}/{name...}", e.handleData)
+	e.mux.HandleFunc("GET /dane/{name...}", e.handleDane)
+	e.mux.HandleFunc("POST /report", e.handleReport)
+	e.mux.HandleFunc("POST /people", e.handleEntity(fixtures.People))
+	e.mux.HandleFunc("POST /places", e.handleEntity(fixtures.Places))
+	e.mux.HandleFunc("POST /apidb", e.handleDatabase)
+
+	return e, nil
+}
+
+func (e *CentralaEmulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[DEBUG] Centrala emulator request: %s %s", r.Method, r.URL.Path)
+	e.mux.ServeHTTP(w, r)
+}
+
+// Reports returns the /report submissions received so far, oldest first.
+func (e *CentralaEmulator) Reports() []EmulatedReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]EmulatedReport(nil), e.reports...)
+}
+
+func (e *CentralaEmulator) handleData(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("key") != e.fixtures.APIKey {
+		http.Error(w, "invalid API key", http.StatusForbidden)
+		return
+	}
+	serveFixtureFile(w, r, e.fixtures.Data, r.PathValue("name"))
+}
+
+func (e *CentralaEmulator) handleDane(w http.ResponseWriter, r *http.Request) {
+	serveFixtureFile(w, r, e.fixtures.Dane, r.PathValue("name"))
+}
+
+func serveFixtureFile(w http.ResponseWriter, r *http.Request, files map[string][]byte, name string) {
+	content, ok := files[path.Clean(name)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+func (e *CentralaEmulator) handleReport(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Task   string      `json:"task"`
+		APIKey string      `json:"apikey"`
+		Answer interface{} `json:"answer"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeEmulatorResponse(w, EntityResponse{Code: emulatorCodeBadRequest, Message: fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+
+	response := e.checkReport(request.Task, request.APIKey, request.Answer)
+
+	e.mu.Lock()
+	e.reports = append(e.reports, EmulatedReport{Task: request.Task, Answer: request.Answer, Response: response})
+	e.mu.Unlock()
+
+	log.Printf("[INFO] Centrala emulator report - Task: %s, Code: %d", request.Task, response.Code)
+	writeEmulatorResponse(w, response)
+}
+
+func (e *CentralaEmulator) checkReport(task, apiKey string, answer interface{}) EntityResponse {
+	if apiKey != e.fixtures.APIKey {
+		return EntityResponse{Code: emulatorCodeInvalidAPIKey, Message: "invalid API key"}
+	}
+
+	fixture, ok := e.fixtures.Reports[task]
+	if !ok {
+		return EntityResponse{Code: emulatorCodeUnknownTask, Message: fmt.Sprintf("unknown task %q", task)}
+	}
+
+	if command, isString := answer.(string); isString {
+		if response, ok := fixture.Commands[command]; ok {
+			return response
+		}
+	}
+
+	if !answersMatch(fixture.Expected, answer, fixture.IgnoreCase) {
+		return EntityResponse{Code: emulatorCodeWrongAnswer, Message: "Wrong answer", Hints: fixture.Hints}
+	}
+
+	flag := fixture.Flag
+	if flag == "" {
+		flag = fmt.Sprintf("{{FLG:EMULATED_%s}}", strings.ToUpper(task))
+	}
+	return EntityResponse{Code: 0, Message: flag}
+}
+
+// answersMatch compares answers after a JSON round trip, so numbers and
+// structs compare the way they would on the wire.
+func answersMatch(expected, actual interface{}, ignoreCase bool) bool {
+	expected, actual = normalizeJSONValue(expected), normalizeJSONValue(actual)
+	if !ignoreCase {
+		return reflect.DeepEqual(expected, actual)
+	}
+	return reflect.DeepEqual(foldJSONValue(expected), foldJSONValue(actual))
+}
+
+func foldJSONValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return strings.ToUpper(strings.TrimSpace(value))
+	case []interface{}:
+		folded := make([]interface{}, len(value))
+		for i, item := range value {
+			folded[i] = foldJSONValue(item)
+		}
+		return folded
+	case map[string]interface{}:
+		folded := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			folded[key] = foldJSONValue(item)
+		}
+		return folded
+	default:
+		return v
+	}
+}
+
+// handleEntity answers /people and /places with the space-separated links of
+// the queried name, as Centrala does.
+func (e *CentralaEmulator) handleEntity(graph map[string][]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			APIKey string `json:"apikey"`
+			Query  string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeEmulatorResponse(w, EntityResponse{Code: emulatorCodeBadRequest, Message: fmt.Sprintf("invalid JSON: %v", err)})
+			return
+		}
+
+		if request.APIKey != e.fixtures.APIKey {
+			writeEmulatorResponse(w, EntityResponse{Code: emulatorCodeInvalidAPIKey, Message: "invalid API key"})
+			return
+		}
+
+		links, ok := graph[strings.ToUpper(strings.TrimSpace(request.Query))]
+		if !ok {
+			writeEmulatorResponse(w, EntityResponse{Code: emulatorCodeNotFound, Message: fmt.Sprintf("no data for %s", request.Query)})
+			return
+		}
+
+		writeEmulatorResponse(w, EntityResponse{Code: 0, Message: strings.Join(links, " ")})
+	}
+}
+
+// handleDatabase answers SHOW TABLES, SHOW CREATE TABLE and SELECT * FROM from
+// the fixture tables; any other query must be listed verbatim in Queries.
+func (e *CentralaEmulator) handleDatabase(w http.ResponseWriter, r *http.Request) {
+	var request DatabaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeEmulatorJSON(w, http.StatusOK, DatabaseResponse{Reply: nil, Error: fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+
+	if request.APIKey != e.fixtures.APIKey {
+		writeEmulatorJSON(w, http.StatusOK, DatabaseResponse{Reply: nil, Error: "invalid API key"})
+		return
+	}
+
+	reply, err := e.runQuery(request.Query)
+	if err != nil {
+		writeEmulatorJSON(w, http.StatusOK, DatabaseResponse{Reply: nil, Error: err.Error()})
+		return
+	}
+
+	writeEmulatorJSON(w, http.StatusOK, DatabaseResponse{Reply: reply, Error: "OK"})
+}
+
+func (e *CentralaEmulator) runQuery(query string) (interface{}, error) {
+	query = strings.TrimSuffix(strings.Join(strings.Fields(query), " "), ";")
+
+	for known, rows := range e.fixtures.Queries {
+		if strings.EqualFold(strings.TrimSuffix(strings.Join(strings.Fields(known), " "), ";"), query) {
+			return rows, nil
+		}
+	}
+
+	if strings.EqualFold(query, "SHOW TABLES") {
+		tables := make([]TableInfo, 0, len(e.fixtures.Tables))
+		for name := range e.fixtures.Tables {
+			tables = append(tables, TableInfo{TableName: name})
+		}
+		sort.Slice(tables, func(i, j int) bool { return tables[i].TableName < tables[j].TableName })
+		return tables, nil
+	}
+
+	if match := showCreateTablePattern.FindStringSubmatch(query); match != nil {
+		table, ok := e.fixtures.Tables[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("table %s doesn't exist", match[1])
+		}
+		return []TableStructure{{Table: match[1], CreateTable: table.Create}}, nil
+	}
+
+	if match := selectAllPattern.FindStringSubmatch(query); match != nil {
+		table, ok := e.fixtures.Tables[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("table %s doesn't exist", match[1])
+		}
+		return table.Rows, nil
+	}
+
+	return nil, fmt.Errorf("query not supported by emulator: %s", query)
+}
+
+// writeEmulatorResponse sends response with the status Centrala uses for its
+// code: 200 on success, 4xx when the request is rejected.
+func writeEmulatorResponse(w http.ResponseWriter, response EntityResponse) {
+	status := http.StatusBadRequest
+	switch response.Code {
+	case 0:
+		status = http.StatusOK
+	case emulatorCodeInvalidAPIKey:
+		status = http.StatusForbidden
+	case emulatorCodeUnknownTask, emulatorCodeNotFound:
+		status = http.StatusNotFound
+	}
+	writeEmulatorJSON(w, status, response)
+}
+
+func writeEmulatorJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[ERROR] Failed to write emulator response: %v", err)
+	}
+}
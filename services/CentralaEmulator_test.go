@@ -0,0 +1,223 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const emulatorFixtures = "../fixtures/centrala"
+
+type emulatedCentrala struct {
+	service     *CentralaService
+	emulator    *CentralaEmulator
+	ledger      *FlagLedger
+	submissions *SubmissionLog
+}
+
+// newEmulatedCentrala points a CentralaService at an emulator serving the
+// repository's fixtures.
+func newEmulatedCentrala(t *testing.T) *emulatedCentrala {
+	t.Helper()
+	fixtures, err := LoadCentralaFixtures(emulatorFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emulator, err := NewCentralaEmulator(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(emulator)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	ledger, err := NewFlagLedger(filepath.Join(dir, "flags.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	submissions, err := NewSubmissionLog(filepath.Join(dir, "submissions.jsonl"), fixtures.APIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewCentralaService(server.URL, fixtures.APIKey, nil).
+		WithRun("test-run", ledger).
+		WithSubmissionLog(submissions)
+	return &emulatedCentrala{service: service, emulator: emulator, ledger: ledger, submissions: submissions}
+}
+
+func TestEmulatorReportRecordsFlag(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	response, err := c.service.PostReport("database", []int{4278, 9294})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != 0 || response.Message != "{{FLG:EMULATED_DATABASE}}" {
+		t.Errorf("response = %+v, want the emulated flag", response)
+	}
+
+	flag, ok := c.ledger.Latest("database")
+	if !ok || flag.RunID != "test-run" {
+		t.Errorf("Latest() = %+v, %v, want the flag of this run", flag, ok)
+	}
+	if reports := c.emulator.Reports(); len(reports) != 1 || reports[0].Task != "database" {
+		t.Errorf("emulator received %+v", reports)
+	}
+}
+
+func TestEmulatorReportRejectionCarriesHints(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	response, err := c.service.PostReport("loop", "WARSZAWA")
+	rejection, ok := AsCentralaError(err)
+	if !ok {
+		t.Fatalf("PostReport() error = %v, want a *CentralaError", err)
+	}
+	want := []string{"Barbara was last seen with Rafal"}
+	if rejection.Code != emulatorCodeWrongAnswer || !reflect.DeepEqual(rejection.Hints, want) {
+		t.Errorf("rejection = %+v", rejection)
+	}
+	if !reflect.DeepEqual(response.Hints, want) {
+		t.Errorf("response hints = %v, want %v", response.Hints, want)
+	}
+	if _, solved := c.ledger.Latest("loop"); solved {
+		t.Error("a rejected answer was recorded as solved")
+	}
+
+	logged, err := c.submissions.Submissions("loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 || !reflect.DeepEqual(logged[0].Hints, want) {
+		t.Errorf("logged submissions = %+v", logged)
+	}
+}
+
+func TestEmulatorRejectsWithErrorStatus(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	cases := map[string]int{
+		`{"task":"loop","apikey":"emulator-key","answer":"ELBLAG"}`:   http.StatusOK,
+		`{"task":"loop","apikey":"emulator-key","answer":"WARSZAWA"}`: http.StatusBadRequest,
+		`{"task":"loop","apikey":"wrong","answer":"ELBLAG"}`:          http.StatusForbidden,
+		`{"task":"nonexistent","apikey":"emulator-key","answer":"x"}`: http.StatusNotFound,
+	}
+	for body, want := range cases {
+		recorder := httptest.NewRecorder()
+		c.emulator.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(body)))
+		if recorder.Code != want {
+			t.Errorf("%s: status %d, want %d", body, recorder.Code, want)
+		}
+		if !strings.Contains(recorder.Body.String(), `"code"`) {
+			t.Errorf("%s: body %q has no code", body, recorder.Body.String())
+		}
+	}
+}
+
+func TestEmulatorSubmitWithRetryUsesHints(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	var seen []string
+	revise := func(answer interface{}, rejection *CentralaError) (interface{}, error) {
+		seen = append(seen, rejection.Hints...)
+		return "elblag", nil
+	}
+	response, attempts, err := c.service.SubmitWithRetry("loop", "KRAKOW", 3, revise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || response.Code != 0 {
+		t.Errorf("got %d attempts ending with %+v, want success on the second", len(attempts), response)
+	}
+	if len(seen) != 1 || !strings.Contains(seen[0], "Rafal") {
+		t.Errorf("reviser saw hints %v", seen)
+	}
+}
+
+func TestEmulatorCommandsAndUnknownTask(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	response, err := c.service.SendCommand("photos", "START")
+	if err != nil || response.Message != "Photos: IMG_1.PNG" {
+		t.Errorf("SendCommand() = %+v, %v", response, err)
+	}
+
+	_, err = c.service.PostReport("nonexistent", "x")
+	if rejection, ok := AsCentralaError(err); !ok || rejection.Code != emulatorCodeUnknownTask {
+		t.Errorf("PostReport() error = %v, want unknown task", err)
+	}
+}
+
+func TestEmulatorDryRunDiffsLatestAcceptedAnswer(t *testing.T) {
+	c := newEmulatedCentrala(t)
+	// Both answers are accepted and earn the same flag.
+	for _, answer := range []string{"elblag", "ELBLAG"} {
+		if _, err := c.service.PostReport("loop", answer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dryRun := c.service.WithDryRun(true)
+	if _, err := dryRun.PostReport("loop", "KRAKOW"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.emulator.Reports()) != 2 {
+		t.Error("dry run submitted the report")
+	}
+	reports := dryRun.DryRunReports()
+	if len(reports) != 1 || reports[0].Matches || reports[0].Accepted != "ELBLAG" {
+		t.Errorf("dry run reports = %+v", reports)
+	}
+}
+
+func TestEmulatorPeopleAndPlaces(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	people, err := c.service.People("barbara")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(people.Names, []string{"KRAKOW", "WARSZAWA"}) {
+		t.Errorf("People() names = %v", people.Names)
+	}
+
+	places, err := c.service.Places("NOWHERE")
+	if rejection, ok := AsCentralaError(err); !ok || rejection.Code != emulatorCodeNotFound {
+		t.Errorf("Places() error = %v, want not found", err)
+	}
+	if places.Code != emulatorCodeNotFound || places.Names != nil {
+		t.Errorf("Places() = %+v, want the error response without names", places)
+	}
+}
+
+func TestEmulatorDataDaneAndDatabase(t *testing.T) {
+	c := newEmulatedCentrala(t)
+
+	want, err := os.ReadFile(filepath.Join(emulatorFixtures, "data", "cenzura.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.service.GetData("cenzura.txt"); err != nil || got != string(want) {
+		t.Errorf("GetData() = %q, %v", got, err)
+	}
+	if _, err := c.service.GetDane("barbara.txt"); err != nil {
+		t.Errorf("GetDane() error = %v", err)
+	}
+
+	tables, err := c.service.ShowTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 {
+		t.Errorf("ShowTables() = %v", tables)
+	}
+	rows, err := c.service.QueryRows("SELECT * FROM users")
+	if err != nil || len(rows) != 2 || rows[1]["username"] != "Monika" {
+		t.Errorf("QueryRows() = %v, %v", rows, err)
+	}
+}
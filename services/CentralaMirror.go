@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// KnownCentralaData and KnownCentralaDane list the resources the tasks read,
+// so the mirror command can fetch them ahead of time.
+var (
+	KnownCentralaData = []string{"json.txt", "cenzura.txt", "robotid.json", "arxiv.txt", "softo.json"}
+	KnownCentralaDane = []string{"pliki_z_fabryki.zip", "arxiv-draft.html", "barbara.txt"}
+)
+
+// mirrorExtPattern keeps object extensions short and free of path characters.
+var mirrorExtPattern = regexp.MustCompile(`^\.[a-z0-9]{1,8}$`)
+
+// MirrorVersion is one fetched version of a mirrored resource.
+type MirrorVersion struct {
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// MirrorEntry is the manifest of one resource, oldest version first.
+type MirrorEntry struct {
+	Resource string          `json:"resource"`
+	Versions []MirrorVersion `json:"versions"`
+}
+
+// Current returns the newest version of the resource.
+func (e *MirrorEntry) Current() MirrorVersion {
+	return e.Versions[len(e.Versions)-1]
+}
+
+// CentralaMirror keeps Centrala /data and /dane resources in a local
+// content-addressed store. manifest.json maps each resource to the versions
+// fetched so far; objects are stored once per checksum and shared by all
+// resources. Fetches of the same resource run one at a time, as
+// they share a download file.
+type CentralaMirror struct {
+	root      string
+	mu        sync.Mutex
+	manifest  map[string]*MirrorEntry
+	fetching  map[string]*sync.Mutex
+	downloads *DownloadManager
+}
+
+func NewCentralaMirror(root string) (*CentralaMirror, error) {
+	if root == "" {
+		return nil, fmt.Errorf("mirror directory not specified")
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "objects"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	downloads, err := NewDownloadManager(nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	mirror := &CentralaMirror{
+		root:      root,
+		manifest:  make(map[string]*MirrorEntry),
+		fetching:  make(map[string]*sync.Mutex),
+		downloads: downloads.WithProgress(LogDownloadProgress),
+	}
+
+	content, err := os.ReadFile(mirror.manifestPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read mirror manifest: %w", err)
+	}
+	if err == nil {
+		var entries []*MirrorEntry
+		if err := json.Unmarshal(content, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse mirror manifest: %w", err)
+		}
+		for _, entry := range entries {
+			if len(entry.Versions) > 0 {
+				mirror.manifest[entry.Resource] = entry
+			}
+		}
+	}
+
+	log.Printf("[INFO] Loaded mirror manifest with %d resources from %s", len(mirror.manifest), root)
+	return mirror, nil
+}
+
+// Fetch returns the local path of resource, downloading url into the store
+// when the resource is not mirrored yet or refresh is set. If a refresh fails
+// and an older version exists, that version is used so work can go on offline.
+func (m *CentralaMirror) Fetch(resource, url string, refresh bool) (string, MirrorVersion, error) {
+	// A fetch that waited for another one sees the version it stored.
+	defer m.lockResource(resource)()
+
+	m.mu.Lock()
+	entry, mirrored := m.manifest[resource]
+	m.mu.Unlock()
+
+	if mirrored && !refresh {
+		version := entry.Current()
+		objectPath := m.objectPath(resource, version.SHA256)
+		if FileExists(objectPath) {
+			return objectPath, version, nil
+		}
+		log.Printf("[WARN] Mirror object for %s is missing, fetching it again", resource)
+	}
+
+	version, err := m.download(resource, url, refresh)
+	if err != nil {
+		if mirrored {
+			previous := entry.Current()
+			if objectPath := m.objectPath(resource, previous.SHA256); FileExists(objectPath) {
+				log.Printf("[WARN] Failed to refresh %s, using mirrored version %s: %v", resource, previous.SHA256[:12], err)
+				return objectPath, previous, nil
+			}
+		}
+		return "", MirrorVersion{}, err
+	}
+
+	if err := m.addVersion(resource, version); err != nil {
+		return "", MirrorVersion{}, err
+	}
+	return m.objectPath(resource, version.SHA256), version, nil
+}
+
+// lockResource waits until no other fetch of resource runs and returns the
+// function releasing it.
+func (m *CentralaMirror) lockResource(resource string) func() {
+	m.mu.Lock()
+	lock, ok := m.fetching[resource]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.fetching[resource] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (m *CentralaMirror) download(resource, url string, refresh bool) (MirrorVersion, error) {
+	log.Printf("[INFO] Mirroring %s", resource)
+
+	ctx := context.Background()
+	if refresh {
+		// Make the HTTP cache ask the server instead of answering from disk.
+		ctx = RevalidateHTTPCache(ctx)
+	}
+
+	// Downloads land in incoming/ under a name derived from the resource, so an
+	// interrupted fetch is resumed next time, and are then moved to their
+	// content address.
+	sum := sha256.Sum256([]byte(resource))
+	incoming := filepath.Join(m.root, "incoming", hex.EncodeToString(sum[:8]))
+	result, err := m.downloads.Download(ctx, DownloadRequest{URL: url, Dest: incoming})
+	if err != nil {
+		return MirrorVersion{}, fmt.Errorf("failed to fetch %s: %w", resource, err)
+	}
+
+	version := MirrorVersion{
+		SHA256:    result.SHA256,
+		Size:      result.Size,
+		FetchedAt: time.Now().UTC(),
+	}
+
+	objectPath := m.objectPath(resource, version.SHA256)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return MirrorVersion{}, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+	if err := os.Rename(incoming, objectPath); err != nil {
+		os.Remove(incoming)
+		return MirrorVersion{}, fmt.Errorf("failed to store %s in mirror: %w", resource, err)
+	}
+
+	log.Printf("[INFO] Mirrored %s (%d bytes, sha256 %s)", resource, version.Size, version.SHA256[:12])
+	return version, nil
+}
+
+// addVersion records version for resource unless it is already the current
+// one, and rewrites the manifest.
+func (m *CentralaMirror) addVersion(resource string, version MirrorVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.manifest[resource]
+	if !ok {
+		entry = &MirrorEntry{Resource: resource}
+		m.manifest[resource] = entry
+	}
+	if len(entry.Versions) > 0 && entry.Current().SHA256 == version.SHA256 {
+		return nil
+	}
+	entry.Versions = append(entry.Versions, version)
+
+	return m.saveManifest()
+}
+
+func (m *CentralaMirror) saveManifest() error {
+	content, err := json.MarshalIndent(m.entries(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mirror manifest: %w", err)
+	}
+
+	tmp := m.manifestPath() + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("failed to write mirror manifest: %w", err)
+	}
+	if err := os.Rename(tmp, m.manifestPath()); err != nil {
+		return fmt.Errorf("failed to write mirror manifest: %w", err)
+	}
+	return nil
+}
+
+// Manifest returns every mirrored resource, sorted by name.
+func (m *CentralaMirror) Manifest() []MirrorEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.entries()
+	manifest := make([]MirrorEntry, len(entries))
+	for i, entry := range entries {
+		manifest[i] = MirrorEntry{Resource: entry.Resource, Versions: append([]MirrorVersion(nil), entry.Versions...)}
+	}
+	return manifest
+}
+
+func (m *CentralaMirror) entries() []*MirrorEntry {
+	entries := make([]*MirrorEntry, 0, len(m.manifest))
+	for _, entry := range m.manifest {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Resource < entries[j].Resource })
+	return entries
+}
+
+// Verify re-hashes the current version of every resource and returns one
+// problem per missing or corrupted object.
+func (m *CentralaMirror) Verify() []string {
+	var problems []string
+	for _, entry := range m.Manifest() {
+		version := entry.Current()
+		sum, err := fileSHA256(m.objectPath(entry.Resource, version.SHA256))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", entry.Resource, err))
+			continue
+		}
+		if sum != version.SHA256 {
+			problems = append(problems, fmt.Sprintf("%s: checksum %s does not match manifest %s", entry.Resource, sum, version.SHA256))
+		}
+	}
+	return problems
+}
+
+// Root returns the mirror's directory.
+func (m *CentralaMirror) Root() string {
+	return m.root
+}
+
+func (m *CentralaMirror) manifestPath() string {
+	return filepath.Join(m.root, "manifest.json")
+}
+
+// objectPath keeps the resource's extension so tools that look at file names
+// (archive extraction, image and audio uploads) still work on mirrored files.
+func (m *CentralaMirror) objectPath(resource, sum string) string {
+	name := sum
+	if ext := strings.ToLower(path.Ext(resource)); mirrorExtPattern.MatchString(ext) {
+		name += ext
+	}
+	return filepath.Join(m.root, "objects", sum[:2], name)
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// MirrorResult reports the outcome of mirroring one resource.
+type MirrorResult struct {
+	Resource string         `json:"resource"`
+	Version  *MirrorVersion `json:"version,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// MirrorKnownResources fetches every known /data and /dane resource, plus the
+// media referenced by arxiv-draft.html, through the service's mirror.
+func (s *CentralaService) MirrorKnownResources() ([]MirrorResult, error) {
+	if s.mirror == nil {
+		return nil, fmt.Errorf("no mirror configured")
+	}
+
+	var results []MirrorResult
+	record := func(resource, url string) string {
+		objectPath, version, err := s.mirror.Fetch(resource, url, s.refresh)
+		if err != nil {
+			results = append(results, MirrorResult{Resource: resource, Error: err.Error()})
+			return ""
+		}
+		results = append(results, MirrorResult{Resource: resource, Version: &version})
+		return objectPath
+	}
+
+	for _, name := range KnownCentralaData {
+		record(s.dataResource(name), s.DataURL(name))
+	}
+
+	var arxivPath string
+	for _, name := range KnownCentralaDane {
+		objectPath := record(daneResource(name), s.DaneURL(name))
+		if name == "arxiv-draft.html" {
+			arxivPath = objectPath
+		}
+	}
+
+	if arxivPath != "" {
+		media, err := arxivMedia(arxivPath)
+		if err != nil {
+			log.Printf("[WARN] Failed to list arxiv media: %v", err)
+		}
+		for _, name := range media {
+			record(daneResource(name), s.DaneURL(name))
+		}
+	}
+
+	return results, nil
+}
+
+// arxivMedia lists the relative image and audio sources of the arxiv draft.
+func arxivMedia(htmlPath string) ([]string, error) {
+	file, err := os.Open(htmlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse arxiv draft: %w", err)
+	}
+
+	var media []string
+	doc.Find("img[src], audio source[src], audio[src]").Each(func(i int, sel *goquery.Selection) {
+		src, _ := sel.Attr("src")
+		if src != "" && !strings.Contains(src, "://") {
+			media = append(media, src)
+		}
+	})
+	return media, nil
+}
+
+// dataResource names a per-key data file in the mirror. The key is replaced
+// by a short fingerprint so the manifest never contains it.
+func (s *CentralaService) dataResource(name string) string {
+	sum := sha256.Sum256([]byte(s.apiKey))
+	return fmt.Sprintf("data/%s/%s", hex.EncodeToString(sum[:6]), strings.TrimLeft(name, "/"))
+}
+
+func daneResource(path string) string {
+	return "dane/" + strings.TrimLeft(path, "/")
+}
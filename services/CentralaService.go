@@ -1,12 +1,18 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"io"
+	"log/slog"
+	neturl "net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -33,10 +39,23 @@ type MediaInfo struct {
 	Description string
 }
 
+// daneFetchConcurrency bounds the parallel asset fetches of DanePaths.
+const daneFetchConcurrency = 4
+
 type CentralaService struct {
 	baseURL       string
 	apiKey        string
 	openAIService *OpenAiService
+	runID         string
+	ledger        *FlagLedger
+	dryRun        bool
+	dryRuns       []DryRunReport
+	submissions   *SubmissionLog
+	answers       *AnswerRegistry
+	mirror        *CentralaMirror
+	refresh       bool
+	client        *HTTPClient
+	logger        *slog.Logger
 }
 
 type APIResponse struct {
@@ -50,6 +69,13 @@ type EntityResponse struct {
 	Hints   []string `json:"hints,omitempty"`
 }
 
+// EntityListResponse is a /people or /places response with the names its
+// message lists.
+type EntityListResponse struct {
+	EntityResponse
+	Names []string `json:"names"`
+}
+
 type DatabaseResponse struct {
 	Reply interface{} `json:"reply"`
 	Error string      `json:"error"`
@@ -70,17 +96,319 @@ type DatabaseRequest struct {
 	Query  string `json:"query"`
 }
 
+// CentralaError is returned when Centrala rejects a request with a non-zero
+// code (or, for /apidb, a non-OK status). Tasks can inspect it with errors.As
+// to read the message and hints and decide how to retry.
+type CentralaError struct {
+	Endpoint string
+	Task     string
+	Code     int
+	Message  string
+	Hints    []string
+}
+
+func (e *CentralaError) Error() string {
+	msg := fmt.Sprintf("centrala %s returned code %d: %s", e.Endpoint, e.Code, e.Message)
+	if e.Task != "" {
+		msg = fmt.Sprintf("centrala %s (task %s) returned code %d: %s", e.Endpoint, e.Task, e.Code, e.Message)
+	}
+	if len(e.Hints) > 0 {
+		msg += fmt.Sprintf(" (hints: %s)", strings.Join(e.Hints, "; "))
+	}
+	return msg
+}
+
+// AsCentralaError unwraps err into a *CentralaError if it is one.
+func AsCentralaError(err error) (*CentralaError, bool) {
+	var centralaErr *CentralaError
+	ok := errors.As(err, &centralaErr)
+	return centralaErr, ok
+}
+
 func NewCentralaService(baseURL, apiKey string, openAIService *OpenAiService) *CentralaService {
 	return &CentralaService{
 		baseURL:       baseURL,
 		apiKey:        apiKey,
 		openAIService: openAIService,
+		logger:        slog.Default(),
+	}
+}
+
+// WithRun makes the service record flags found in report responses in ledger,
+// tagged with runID, and adds runID to its log records. A nil ledger disables
+// recording.
+func (s *CentralaService) WithRun(runID string, ledger *FlagLedger) *CentralaService {
+	s.runID = runID
+	s.ledger = ledger
+	s.logger = slog.Default().With("run_id", runID)
+	return s
+}
+
+// WithSubmissionLog makes every /report request (answers and commands) get
+// written to submissions. A nil log disables auditing.
+func (s *CentralaService) WithSubmissionLog(submissions *SubmissionLog) *CentralaService {
+	s.submissions = submissions
+	return s
+}
+
+// WithAnswerRegistry makes PostReport normalise and validate answers against
+// the task's declared rule before submitting them.
+func (s *CentralaService) WithAnswerRegistry(answers *AnswerRegistry) *CentralaService {
+	s.answers = answers
+	return s
+}
+
+// WithMirror makes /data and /dane reads go through mirror. With refresh set
+// every resource is fetched again instead of served from the mirror.
+func (s *CentralaService) WithMirror(mirror *CentralaMirror, refresh bool) *CentralaService {
+	s.mirror = mirror
+	s.refresh = refresh
+	return s
+}
+
+// WithHTTPClient makes reads that bypass the mirror use client, such as a
+// profile's client with its own cache. Nil selects the default client.
+func (s *CentralaService) WithHTTPClient(client *HTTPClient) *CentralaService {
+	s.client = client
+	return s
+}
+
+// WithDryRun makes PostReport record answers instead of submitting them.
+func (s *CentralaService) WithDryRun(enabled bool) *CentralaService {
+	s.dryRun = enabled
+	return s
+}
+
+// DryRun reports whether answers are recorded instead of submitted.
+func (s *CentralaService) DryRun() bool {
+	return s.dryRun
+}
+
+// DryRunReports returns the reports withheld in dry-run mode, oldest first.
+func (s *CentralaService) DryRunReports() []DryRunReport {
+	return append([]DryRunReport(nil), s.dryRuns...)
+}
+
+func (s *CentralaService) recordFlags(task string, answer interface{}, texts ...string) {
+	if s.ledger == nil {
+		return
+	}
+	if _, err := s.ledger.Record(task, s.runID, answer, texts...); err != nil {
+		s.logger.Error("Failed to record flags", "task", task, "error", err)
+	}
+}
+
+// DataURL returns the URL of a per-key data file, e.g. "robotid.json".
+func (s *CentralaService) DataURL(name string) string {
+	return fmt.Sprintf("%s/data/%s/%s", s.baseURL, s.apiKey, strings.TrimLeft(name, "/"))
+}
+
+// GetData downloads a per-key data file from /data/{apikey}/.
+func (s *CentralaService) GetData(name string) (string, error) {
+	s.logger.Info("Fetching Centrala data file", "name", name)
+
+	content, err := s.read(s.dataResource(name), s.DataURL(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch data file %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// GetDataJSON downloads a per-key data file and decodes it into v.
+func (s *CentralaService) GetDataJSON(name string, v interface{}) error {
+	content, err := s.GetData(name)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return fmt.Errorf("failed to parse data file %s: %w", name, err)
+	}
+	return nil
+}
+
+// DaneURL returns the URL of a shared asset under /dane/, e.g. "barbara.txt".
+func (s *CentralaService) DaneURL(path string) string {
+	return fmt.Sprintf("%s/dane/%s", s.baseURL, strings.TrimLeft(path, "/"))
+}
+
+// GetDane downloads a shared asset from /dane/.
+func (s *CentralaService) GetDane(path string) (string, error) {
+	s.logger.Info("Fetching Centrala asset", "path", path)
+
+	content, err := s.read(daneResource(path), s.DaneURL(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch asset %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// DownloadDane saves a shared asset from /dane/ to dest.
+func (s *CentralaService) DownloadDane(path, dest string) error {
+	s.logger.Info("Downloading Centrala asset", "path", path, "dest", dest)
+
+	if s.mirror == nil {
+		if err := DownloadFile(s.DaneURL(path), dest); err != nil {
+			return fmt.Errorf("failed to download asset %s: %w", path, err)
+		}
+		return nil
+	}
+
+	source, err := s.DanePath(path)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(source, dest); err != nil {
+		return fmt.Errorf("failed to copy asset %s: %w", path, err)
+	}
+	return nil
+}
+
+// DanePath returns a local file holding the shared asset. With a mirror this
+// is the mirrored object, which must not be modified; without one the asset
+// is downloaded to a new temporary file. Pass the path to ReleaseDane once it
+// is no longer needed.
+func (s *CentralaService) DanePath(path string) (string, error) {
+	if s.mirror != nil {
+		objectPath, _, err := s.mirror.Fetch(daneResource(path), s.DaneURL(path), s.refresh)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch asset %s: %w", path, err)
+		}
+		return objectPath, nil
+	}
+
+	tmp, err := os.CreateTemp("", "dane-*"+filepath.Ext(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmp.Close()
+
+	if err := DownloadFile(s.DaneURL(path), tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download asset %s: %w", path, err)
+	}
+	return tmp.Name(), nil
+}
+
+// ReleaseDane removes a temporary file returned by DanePath. Mirrored objects
+// are kept.
+func (s *CentralaService) ReleaseDane(localPath string) {
+	if s.mirror != nil || localPath == "" {
+		return
+	}
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("Failed to remove downloaded asset", "path", localPath, "error", err)
+	}
+}
+
+// DanePaths fetches several shared assets concurrently, as DanePath does, and
+// returns their local paths by asset path; repeated paths are fetched once.
+// Assets that could not be fetched are left out and reported in the error.
+func (s *CentralaService) DanePaths(paths []string) (map[string]string, error) {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		errs  []error
+		local = make(map[string]string, len(paths))
+		slots = make(chan struct{}, daneFetchConcurrency)
+	)
+
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			localPath, err := s.DanePath(path)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			local[path] = localPath
+		}()
+	}
+	wg.Wait()
+
+	return local, errors.Join(errs...)
+}
+
+// read returns a resource's content, from the mirror when one is configured.
+func (s *CentralaService) read(resource, url string) (string, error) {
+	if s.mirror == nil {
+		return s.get(url)
+	}
+
+	objectPath, _, err := s.mirror.Fetch(resource, url, s.refresh)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(objectPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read mirrored %s: %w", resource, err)
+	}
+	return string(content), nil
+}
+
+// get returns the body of url, using the service's HTTP client.
+func (s *CentralaService) get(url string) (string, error) {
+	client := s.client
+	if client == nil {
+		client = DefaultHTTPClient()
+	}
+	body, err := client.Get(context.Background(), url)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// post sends a JSON request to a Centrala endpoint. Centrala answers rejected
+// requests with an error status and a JSON body carrying the code and hints;
+// such bodies are returned without the HTTP error so callers can turn them
+// into a *CentralaError.
+func (s *CentralaService) post(endpoint string, request interface{}) (string, error) {
+	response, err := PostJSON(s.baseURL+endpoint, request)
+	if httpErr, ok := AsHTTPError(err); ok && httpErr.StatusCode != 0 && httpErr.Err == nil {
+		var body struct {
+			Code *int `json:"code"`
+		}
+		if json.Unmarshal([]byte(response), &body) == nil && body.Code != nil {
+			s.logger.Debug("Centrala rejected request", "endpoint", endpoint, "status", httpErr.StatusCode, "code", *body.Code)
+			return response, nil
+		}
+	}
+	return response, err
+}
+
+func copyFile(source, dest string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
 	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
 
 func (s *CentralaService) ProcessCentralaData(llmService LLMService) (*CentralaData, error) {
-	// Construct the full URL
-	url := fmt.Sprintf("%s/data/%s/json.txt", s.baseURL, s.apiKey)
 	llmService.SetSystemPrompt(`
 	You are a helpful assistant that corrects the answers to multiple questions in the test.
 	You are given multiple questions.
@@ -97,16 +425,10 @@ func (s *CentralaService) ProcessCentralaData(llmService LLMService) (*CentralaD
 	]
 	`)
 
-	// Download the JSON data
-	jsonData, err := GetRequestBody(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download data: %w", err)
-	}
-
-	// Parse the JSON data
+	// Download and parse the JSON data
 	var data CentralaData
-	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	if err := s.GetDataJSON("json.txt", &data); err != nil {
+		return nil, err
 	}
 
 	correctedTestData := make([]TestData, len(data.TestData))
@@ -192,11 +514,7 @@ func (s *CentralaService) ProcessCentralaData(llmService LLMService) (*CentralaD
 }
 
 func (s *CentralaService) GetCensorshipData() (string, error) {
-	// Construct the URL using the provided base URL and API key
-	url := fmt.Sprintf("%s/data/%s/cenzura.txt", s.baseURL, s.apiKey)
-
-	// Use the existing GetRequestBody function to fetch the content
-	content, err := GetRequestBody(url)
+	content, err := s.GetData("cenzura.txt")
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch censorship data: %w", err)
 	}
@@ -205,29 +523,21 @@ func (s *CentralaService) GetCensorshipData() (string, error) {
 }
 
 func (s *CentralaService) GetArxivQuestions() (map[string]string, error) {
-	url := fmt.Sprintf("%s/data/%s/arxiv.txt", s.baseURL, s.apiKey)
-	content, err := GetRequestBody(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch questions: %w", err)
-	}
-
 	questions := make(map[string]string)
-	err = json.Unmarshal([]byte(content), &questions)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse questions: %w", err)
+	if err := s.GetDataJSON("arxiv.txt", &questions); err != nil {
+		return nil, fmt.Errorf("failed to fetch questions: %w", err)
 	}
 
 	return questions, nil
 }
 
 func (s *CentralaService) ProcessArxivPage(url string) (string, []MediaInfo, error) {
-	resp, err := http.Get(url)
+	page, err := s.get(url)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to fetch page: %w", err)
 	}
-	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
 	}
@@ -261,7 +571,11 @@ func (s *CentralaService) ProcessArxivPage(url string) (string, []MediaInfo, err
 			wg.Add(1)
 			go func(imgURL string) {
 				defer wg.Done()
-				if description, err := s.openAIService.AnalyzeImages(imgURL); err == nil {
+				description, err := s.openAIService.AnalyzeImages(ImageAnalysisRequest{
+					Prompt: "Describe this image in detail, including any text visible in it.",
+					Images: []ImageInput{{URL: resolveURL(url, imgURL)}},
+				})
+				if err == nil {
 					mu.Lock()
 					mediaInfos = append(mediaInfos, MediaInfo{
 						Type:        "image",
@@ -335,46 +649,61 @@ Context:
 	return answers, nil
 }
 
-func (s *CentralaService) QueryAPI(endpoint, query string) (interface{}, error) {
-	log.Printf("[INFO] Querying Centrala API - Endpoint: %s, Query Length: %d", endpoint, len(query))
-	log.Printf("[DEBUG] Centrala API Query Content: %s", query)
+// People returns the places a person (first name, uppercase, no diacritics) was
+// seen in. A non-zero code is returned as a *CentralaError together with the
+// parsed response.
+func (s *CentralaService) People(name string) (EntityListResponse, error) {
+	return s.queryEntity("/people", name)
+}
+
+// Places returns the people seen in a place (uppercase, no diacritics), like
+// People.
+func (s *CentralaService) Places(name string) (EntityListResponse, error) {
+	return s.queryEntity("/places", name)
+}
+
+func (s *CentralaService) queryEntity(endpoint, query string) (EntityListResponse, error) {
+	s.logger.Info("Querying Centrala API", "endpoint", endpoint, "query_length", len(query))
+	s.logger.Debug("Centrala API query", "endpoint", endpoint, "query", query)
 
 	request := map[string]interface{}{
 		"apikey": s.apiKey,
 		"query":  query,
 	}
 
-	log.Printf("[DEBUG] Centrala API Request - Endpoint: %s", endpoint)
-	response, err := PostJSON(fmt.Sprintf("%s%s", s.baseURL, endpoint), request)
+	response, err := s.post(endpoint, request)
 	if err != nil {
-		log.Printf("[ERROR] Failed to query Centrala API: %v", err)
-		return nil, fmt.Errorf("failed to query API: %w", err)
+		s.logger.Error("Failed to query Centrala API", "endpoint", endpoint, "error", err)
+		return EntityListResponse{}, fmt.Errorf("failed to query API: %w", err)
 	}
 
 	var apiResponse EntityResponse
 	if err := json.Unmarshal([]byte(response), &apiResponse); err != nil {
-		log.Printf("[ERROR] Failed to parse Centrala API response: %v", err)
-		return nil, fmt.Errorf("failed to parse API response: %w", err)
+		s.logger.Error("Failed to parse Centrala API response", "endpoint", endpoint, "error", err)
+		return EntityListResponse{}, fmt.Errorf("failed to parse API response: %w", err)
 	}
+	result := EntityListResponse{EntityResponse: apiResponse}
 
 	if apiResponse.Code != 0 {
-		log.Printf("[ERROR] Centrala API returned error code: %d", apiResponse.Code)
-		return nil, fmt.Errorf("API error: code %d", apiResponse.Code)
+		s.logger.Error("Centrala API returned error code", "endpoint", endpoint, "code", apiResponse.Code)
+		return result, &CentralaError{
+			Endpoint: endpoint,
+			Code:     apiResponse.Code,
+			Message:  apiResponse.Message,
+			Hints:    apiResponse.Hints,
+		}
 	}
 
-	log.Printf("[INFO] Received Centrala API response - Code: %d, Message Length: %d",
-		apiResponse.Code, len(apiResponse.Message))
-	log.Printf("[DEBUG] Centrala API Response Message: %s", apiResponse.Message)
-	if len(apiResponse.Hints) > 0 {
-		log.Printf("[DEBUG] Centrala API Response Hints: %v", apiResponse.Hints)
-	}
+	s.logger.Info("Received Centrala API response", "endpoint", endpoint, "code", apiResponse.Code, "message_length", len(apiResponse.Message))
+	s.logger.Debug("Centrala API response message", "endpoint", endpoint, "message", apiResponse.Message)
 
-	return apiResponse, nil
+	result.Names = strings.Fields(apiResponse.Message)
+	return result, nil
 }
 
 func (s *CentralaService) QueryDatabase(query string) (*DatabaseResponse, error) {
-	log.Printf("[INFO] Querying Centrala database - Query Length: %d", len(query))
-	log.Printf("[DEBUG] Database Query: %s", query)
+	s.logger.Info("Querying Centrala database", "query_length", len(query))
+	s.logger.Debug("Database query", "query", query)
 
 	request := DatabaseRequest{
 		Task:   "database",
@@ -382,50 +711,72 @@ func (s *CentralaService) QueryDatabase(query string) (*DatabaseResponse, error)
 		Query:  query,
 	}
 
-	log.Printf("[DEBUG] Centrala Database Request - Query: %s", query)
-	response, err := PostJSON(fmt.Sprintf("%s/apidb", s.baseURL), request)
+	response, err := s.post("/apidb", request)
 	if err != nil {
-		log.Printf("[ERROR] Failed to query Centrala database: %v", err)
+		s.logger.Error("Failed to query Centrala database", "error", err)
 		return nil, fmt.Errorf("failed to query database: %w", err)
 	}
 
 	var dbResponse DatabaseResponse
 	if err := json.Unmarshal([]byte(response), &dbResponse); err != nil {
-		log.Printf("[ERROR] Failed to parse database response: %v", err)
+		s.logger.Error("Failed to parse database response", "error", err)
 		return nil, fmt.Errorf("failed to parse database response: %w", err)
 	}
 
 	if dbResponse.Error != "OK" {
-		log.Printf("[ERROR] Database returned error: %s", dbResponse.Error)
-		return nil, fmt.Errorf("database error: %s", dbResponse.Error)
+		s.logger.Error("Database returned error", "status", dbResponse.Error)
+		return nil, &CentralaError{
+			Endpoint: "/apidb",
+			Task:     "database",
+			Code:     -1,
+			Message:  dbResponse.Error,
+		}
 	}
 
-	log.Printf("[INFO] Received database response - Status: %s", dbResponse.Error)
-	replyJSON, _ := json.Marshal(dbResponse.Reply)
-	log.Printf("[DEBUG] Database Response Content: %s", string(replyJSON))
+	s.logger.Info("Received database response", "status", dbResponse.Error)
+	s.logger.Debug("Database response content", "reply", dbResponse.Reply)
 
 	return &dbResponse, nil
 }
 
+// QueryRows runs a query against /apidb and returns the reply as rows.
+func (s *CentralaService) QueryRows(query string) ([]map[string]interface{}, error) {
+	response, err := s.QueryDatabase(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]interface{}{}
+	replyJSON, err := json.Marshal(response.Reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reply: %w", err)
+	}
+	if err := json.Unmarshal(replyJSON, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse rows: %w", err)
+	}
+
+	return rows, nil
+}
+
 func (s *CentralaService) ShowTables() ([]string, error) {
-	log.Println("[INFO] Fetching database tables")
+	s.logger.Info("Fetching database tables")
 
 	response, err := s.QueryDatabase("SHOW TABLES")
 	if err != nil {
-		log.Printf("[ERROR] Failed to fetch tables: %v", err)
+		s.logger.Error("Failed to fetch tables", "error", err)
 		return nil, err
 	}
 
 	// Convert the reply to JSON to parse it
 	replyJSON, err := json.Marshal(response.Reply)
 	if err != nil {
-		log.Printf("[ERROR] Failed to marshal tables reply: %v", err)
+		s.logger.Error("Failed to marshal tables reply", "error", err)
 		return nil, fmt.Errorf("failed to marshal reply: %w", err)
 	}
 
 	var tables []TableInfo
 	if err := json.Unmarshal(replyJSON, &tables); err != nil {
-		log.Printf("[ERROR] Failed to parse tables: %v", err)
+		s.logger.Error("Failed to parse tables", "error", err)
 		return nil, fmt.Errorf("failed to parse tables: %w", err)
 	}
 
@@ -435,45 +786,97 @@ func (s *CentralaService) ShowTables() ([]string, error) {
 		tableNames[i] = table.TableName
 	}
 
-	log.Printf("[INFO] Successfully fetched %d tables", len(tableNames))
+	s.logger.Info("Fetched database tables", "count", len(tableNames))
 	return tableNames, nil
 }
 
 func (s *CentralaService) ShowCreateTable(tableName string) (string, error) {
-	log.Printf("[INFO] Fetching structure for table: %s", tableName)
+	s.logger.Info("Fetching table structure", "table", tableName)
 
 	query := fmt.Sprintf("SHOW CREATE TABLE %s", tableName)
 	response, err := s.QueryDatabase(query)
 	if err != nil {
-		log.Printf("[ERROR] Failed to fetch table structure for %s: %v", tableName, err)
+		s.logger.Error("Failed to fetch table structure", "table", tableName, "error", err)
 		return "", err
 	}
 
 	// Convert the reply to JSON to parse it
 	replyJSON, err := json.Marshal(response.Reply)
 	if err != nil {
-		log.Printf("[ERROR] Failed to marshal table structure reply: %v", err)
+		s.logger.Error("Failed to marshal table structure reply", "table", tableName, "error", err)
 		return "", fmt.Errorf("failed to marshal reply: %w", err)
 	}
 
 	var structures []TableStructure
 	if err := json.Unmarshal(replyJSON, &structures); err != nil {
-		log.Printf("[ERROR] Failed to parse table structure: %v", err)
+		s.logger.Error("Failed to parse table structure", "table", tableName, "error", err)
 		return "", fmt.Errorf("failed to parse table structure: %w", err)
 	}
 
 	if len(structures) == 0 {
-		log.Printf("[ERROR] No structure returned for table %s", tableName)
+		s.logger.Error("No structure returned for table", "table", tableName)
 		return "", fmt.Errorf("no structure returned for table %s", tableName)
 	}
 
-	log.Printf("[INFO] Successfully fetched structure for table %s", tableName)
+	s.logger.Info("Fetched table structure", "table", tableName)
 	return structures[0].CreateTable, nil
 }
 
+// PostReport submits an answer to /report. A non-zero code is returned as a
+// *CentralaError together with the parsed response. In dry-run mode the answer
+// is recorded (see DryRunReports) and a synthetic success is returned. Answers
+// failing the task's AnswerRule are rejected with an *AnswerValidationError
+// without contacting Centrala.
 func (s *CentralaService) PostReport(task string, answer interface{}) (EntityResponse, error) {
-	log.Printf("[INFO] Sending report to Centrala - Task: %s", task)
-	log.Printf("[DEBUG] Report Answer Content: %s", answer)
+	if s.answers != nil {
+		prepared, err := s.answers.Prepare(task, answer)
+		if err != nil {
+			s.logger.Error("Answer failed validation", "task", task, "error", err)
+			return EntityResponse{}, err
+		}
+		answer = prepared
+	}
+
+	if s.dryRun {
+		return s.withholdReport(task, answer), nil
+	}
+	return s.submitReport(task, answer)
+}
+
+// SendCommand posts a tool command (e.g. "START" or "DARKEN IMG_1.PNG") to
+// /report. Commands are not answers, so they are sent even in dry-run mode.
+func (s *CentralaService) SendCommand(task, command string) (EntityResponse, error) {
+	return s.submitReport(task, command)
+}
+
+func (s *CentralaService) withholdReport(task string, answer interface{}) EntityResponse {
+	report := DryRunReport{
+		Task: task,
+		Payload: map[string]interface{}{
+			"apikey": "[REDACTED]",
+			"task":   task,
+			"answer": answer,
+		},
+	}
+
+	if s.ledger != nil {
+		// Compare with the answer accepted last, which reflects the task as it is now.
+		if accepted, ok := s.ledger.Latest(task); ok {
+			report.Accepted = accepted.Answer
+			report.Diff = DiffAnswers(accepted.Answer, answer)
+			report.Matches = len(report.Diff) == 0
+		}
+	}
+
+	s.dryRuns = append(s.dryRuns, report)
+	s.logger.Info("Dry run - report not submitted", "task", task, "differences", len(report.Diff))
+
+	return EntityResponse{Code: 0, Message: fmt.Sprintf("DRY RUN: report for task %s not submitted", task)}
+}
+
+func (s *CentralaService) submitReport(task string, answer interface{}) (EntityResponse, error) {
+	s.logger.Info("Sending report to Centrala", "task", task)
+	s.logger.Debug("Report answer", "task", task, "answer", answer)
 
 	request := map[string]interface{}{
 		"apikey": s.apiKey,
@@ -481,25 +884,76 @@ func (s *CentralaService) PostReport(task string, answer interface{}) (EntityRes
 		"answer": answer,
 	}
 
-	log.Printf("[DEBUG] Centrala Report Request - Task: %s", task)
-	response, err := PostJSON(fmt.Sprintf("%s/report", s.baseURL), request)
+	started := time.Now()
+	response, err := s.post("/report", request)
 	if err != nil {
-		log.Printf("[ERROR] Failed to post report to Centrala: %v", err)
+		s.logger.Error("Failed to post report to Centrala", "task", task, "error", err)
+		s.auditReport(task, answer, started, EntityResponse{}, err)
 		return EntityResponse{}, fmt.Errorf("failed to post report: %w", err)
 	}
 
 	var apiResponse EntityResponse
 	if err := json.Unmarshal([]byte(response), &apiResponse); err != nil {
-		log.Printf("[ERROR] Failed to parse Centrala response: %v", err)
+		s.logger.Error("Failed to parse Centrala response", "task", task, "error", err)
+		s.auditReport(task, answer, started, EntityResponse{}, err)
 		return EntityResponse{}, fmt.Errorf("failed to parse API response: %w", err)
 	}
+	s.auditReport(task, answer, started, apiResponse, nil)
+
+	s.logger.Info("Received Centrala response", "task", task, "code", apiResponse.Code,
+		"message_length", len(apiResponse.Message), "hints", len(apiResponse.Hints))
+	s.logger.Debug("Centrala response", "task", task, "message", apiResponse.Message, "hints", apiResponse.Hints)
 
-	log.Printf("[INFO] Received Centrala response - Code: %d, Message Length: %d, Hints: %d",
-		apiResponse.Code, len(apiResponse.Message), len(apiResponse.Hints))
-	log.Printf("[DEBUG] Centrala Response Message: %s", apiResponse.Message)
-	if len(apiResponse.Hints) > 0 {
-		log.Printf("[DEBUG] Centrala Response Hints: %v", apiResponse.Hints)
+	s.recordFlags(task, answer, append([]string{apiResponse.Message}, apiResponse.Hints...)...)
+
+	// The response is returned alongside the error so callers can still read it.
+	if apiResponse.Code != 0 {
+		return apiResponse, &CentralaError{
+			Endpoint: "/report",
+			Task:     task,
+			Code:     apiResponse.Code,
+			Message:  apiResponse.Message,
+			Hints:    apiResponse.Hints,
+		}
 	}
 
 	return apiResponse, nil
 }
+
+func (s *CentralaService) auditReport(task string, answer interface{}, started time.Time, response EntityResponse, err error) {
+	if s.submissions == nil {
+		return
+	}
+
+	submission := Submission{
+		Task:        task,
+		RunID:       s.runID,
+		Answer:      answer,
+		Code:        response.Code,
+		Message:     response.Message,
+		Hints:       response.Hints,
+		LatencyMS:   time.Since(started).Milliseconds(),
+		SubmittedAt: started.UTC(),
+	}
+	if err != nil {
+		submission.Error = err.Error()
+	}
+
+	if _, err := s.submissions.Record(submission, s.apiKey); err != nil {
+		s.logger.Error("Failed to record submission", "task", task, "error", err)
+	}
+}
+
+// resolveURL resolves a possibly relative reference against the page it was found on.
+func resolveURL(pageURL, ref string) string {
+	base, err := neturl.Parse(pageURL)
+	if err != nil {
+		return ref
+	}
+
+	resolved, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return resolved.String()
+}
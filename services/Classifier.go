@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// classifierTopLogProbs is the number of alternatives requested for the first
+// output token; the API allows up to 20.
+const classifierTopLogProbs = 20
+
+// LabelScore is the probability the model assigns to one label.
+type LabelScore struct {
+	Label       string  `json:"label"`
+	Probability float64 `json:"probability"`
+}
+
+// Classification is the outcome of Classify. Scores cover every label, sorted
+// from most to least likely, and sum to 1.
+type Classification struct {
+	Label       string       `json:"label"`
+	Probability float64      `json:"probability"`
+	Scores      []LabelScore `json:"scores"`
+	Raw         string       `json:"raw"`
+}
+
+// Margin is the probability gap between the two most likely labels.
+func (c Classification) Margin() float64 {
+	if len(c.Scores) < 2 {
+		return c.Probability
+	}
+	return c.Scores[0].Probability - c.Scores[1].Probability
+}
+
+// IsAmbiguous reports whether the winning label is less likely than minProbability.
+func (c Classification) IsAmbiguous(minProbability float64) bool {
+	return c.Probability < minProbability
+}
+
+// Classify asks the model to answer with exactly one of labels and turns the
+// log-probabilities of the first answer token into a distribution over labels.
+// Mass on tokens that start no label is dropped and the rest renormalised, so
+// the result is always one of labels; if no alternative matches any label an
+// error is returned instead of guessing.
+func (s *OpenAiService) Classify(content string, labels []string, instructions string) (*Classification, error) {
+	if content == "" {
+		return nil, fmt.Errorf("empty content provided")
+	}
+
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("at least two labels are required, got %d", len(labels))
+	}
+
+	systemPrompt := fmt.Sprintf(`%s
+
+Respond with exactly one of these labels and nothing else: %s`, instructions, strings.Join(labels, ", "))
+
+	log.Printf("[INFO] Classifying content - Model: %s, Labels: %v, Content Length: %d", s.Model, labels, len(content))
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: s.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    "system",
+				Content: systemPrompt,
+			},
+			{
+				Role:    "user",
+				Content: content,
+			},
+		},
+		MaxTokens:   8,
+		LogProbs:    true,
+		TopLogProbs: classifierTopLogProbs,
+	})
+	if err != nil {
+		log.Printf("[ERROR] OpenAI API error: %v", err)
+		return nil, fmt.Errorf("failed to create chat completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned from API")
+	}
+
+	choice := resp.Choices[0]
+	if choice.LogProbs == nil || len(choice.LogProbs.Content) == 0 {
+		return nil, fmt.Errorf("no log probabilities returned for model %s", s.Model)
+	}
+
+	classification, err := scoreLabels(choice.LogProbs.Content[0].TopLogProbs, labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to classify response %q: %w", choice.Message.Content, err)
+	}
+	classification.Raw = choice.Message.Content
+
+	log.Printf("[INFO] Classified content as %s (p=%.3f, margin=%.3f)",
+		classification.Label, classification.Probability, classification.Margin())
+	log.Printf("[DEBUG] Classification scores: %v", classification.Scores)
+
+	return classification, nil
+}
+
+// scoreLabels maps first-token alternatives onto labels. A token, without
+// surrounding whitespace, punctuation and quotes, counts for every label it
+// is a case-insensitive prefix of, split evenly between them. Ties go to the
+// label listed first.
+func scoreLabels(alternatives []openai.TopLogProbs, labels []string) (*Classification, error) {
+	mass := make([]float64, len(labels))
+	total := 0.0
+
+	for _, alt := range alternatives {
+		token := strings.ToLower(strings.TrimFunc(alt.Token, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+		}))
+		if token == "" {
+			continue
+		}
+
+		var matches []int
+		for i, label := range labels {
+			if strings.HasPrefix(strings.ToLower(label), token) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		p := math.Exp(alt.LogProb)
+		for _, i := range matches {
+			mass[i] += p / float64(len(matches))
+		}
+		total += p
+	}
+
+	if total == 0 {
+		return nil, fmt.Errorf("no alternative matched any of the labels %v", labels)
+	}
+
+	scores := make([]LabelScore, len(labels))
+	for i, label := range labels {
+		scores[i] = LabelScore{Label: label, Probability: mass[i] / total}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Probability > scores[j].Probability
+	})
+
+	return &Classification{
+		Label:       scores[0].Label,
+		Probability: scores[0].Probability,
+		Scores:      scores,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestScoreLabels(t *testing.T) {
+	labels := []string{"people", "hardware", "other"}
+	alt := func(token string, p float64) openai.TopLogProbs {
+		return openai.TopLogProbs{Token: token, LogProb: math.Log(p)}
+	}
+
+	cases := []struct {
+		name         string
+		alternatives []openai.TopLogProbs
+		label        string
+		probability  float64
+	}{
+		{"exact tokens", []openai.TopLogProbs{alt("people", 0.6), alt("hardware", 0.3), alt("other", 0.1)}, "people", 0.6},
+		{"punctuation and whitespace", []openai.TopLogProbs{alt(" people.", 0.2), alt("\"Hardware\"", 0.6), alt("`other`", 0.2)}, "hardware", 0.6},
+		{"prefix tokens", []openai.TopLogProbs{alt("hard", 0.5), alt("peo", 0.25), alt("oth", 0.25)}, "hardware", 0.5},
+		{"unmatched mass dropped", []openai.TopLogProbs{alt("people", 0.3), alt("software", 0.6), alt("other", 0.1)}, "people", 0.75},
+		{"tie goes to the first label", []openai.TopLogProbs{alt("other", 0.5), alt("hardware", 0.5)}, "hardware", 0.5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			classification, err := scoreLabels(c.alternatives, labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if classification.Label != c.label || math.Abs(classification.Probability-c.probability) > 1e-9 {
+				t.Errorf("got %s (p=%.3f), want %s (p=%.3f)", classification.Label, classification.Probability, c.label, c.probability)
+			}
+			if len(classification.Scores) != len(labels) {
+				t.Errorf("got %d scores, want one per label", len(classification.Scores))
+			}
+		})
+	}
+
+	if _, err := scoreLabels([]openai.TopLogProbs{alt("software", 0.9), alt(".", 0.1)}, labels); err == nil {
+		t.Error("scoreLabels() classified alternatives matching no label")
+	}
+}
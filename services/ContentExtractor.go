@@ -0,0 +1,308 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultImageExtractionPrompt is used by ImageExtractor when no prompt is set.
+const defaultImageExtractionPrompt = "Describe what this image shows and transcribe any text visible in it."
+
+// ErrNoExtractor is returned when no extractor is registered for a file's type.
+var ErrNoExtractor = errors.New("no extractor for content type")
+
+// Extraction is the text content of a file. Metadata holds extractor-specific
+// details, such as the model that produced a transcript.
+type Extraction struct {
+	Text      string            `json:"text"`
+	MIMEType  string            `json:"mimeType"`
+	Extractor string            `json:"extractor"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// ContentExtractor turns a file of a supported type into text.
+type ContentExtractor interface {
+	Name() string
+	Extract(filePath, mimeType string) (Extraction, error)
+}
+
+// ExtractorRegistry routes files to extractors by their sniffed MIME type.
+type ExtractorRegistry struct {
+	extractors map[string]ContentExtractor
+}
+
+func NewExtractorRegistry() *ExtractorRegistry {
+	return &ExtractorRegistry{extractors: make(map[string]ContentExtractor)}
+}
+
+// NewContentExtractors returns a registry with the built-in extractors: text
+// files, PDFs and office documents, and, when openAI is set, audio transcripts, image
+// descriptions and OCR of scanned PDF pages.
+func NewContentExtractors(openAI *OpenAiService) *ExtractorRegistry {
+	registry := NewExtractorRegistry().Register("text/plain", TextExtractor{})
+	for _, mimeType := range []string{DOCXMIMEType, XLSXMIMEType, ODTMIMEType} {
+		registry.Register(mimeType, OfficeExtractor{})
+	}
+	pdf := PDFExtractor{}
+	if openAI != nil {
+		pdf.Reader = openAI
+		registry.Register("audio/", AudioExtractor{Transcriber: openAI})
+		image := ImageExtractor{Analyzer: openAI}
+		for _, mimeType := range []string{"image/png", "image/jpeg", "image/gif", "image/webp"} {
+			registry.Register(mimeType, image)
+		}
+	}
+	return registry.Register("application/pdf", pdf)
+}
+
+// Register routes mimeType to extractor, replacing any previous one. A type
+// ending in "/" (e.g. "audio/") covers every subtype. Types also cover their
+// children in mimetype's hierarchy, so "text/plain" handles HTML, CSV or JSON.
+func (r *ExtractorRegistry) Register(mimeType string, extractor ContentExtractor) *ExtractorRegistry {
+	r.extractors[mimeType] = extractor
+	return r
+}
+
+// Lookup returns the extractor for mimeType: an exact registration of the
+// type or one of its parents, else a registration of its top-level type.
+// The application/octet-stream root never matches by inheritance.
+func (r *ExtractorRegistry) Lookup(mimeType string) (ContentExtractor, bool) {
+	base, _, _ := strings.Cut(mimeType, ";")
+	for mime := mimetype.Lookup(base); mime != nil && mime.Parent() != nil; mime = mime.Parent() {
+		parent, _, _ := strings.Cut(mime.String(), ";")
+		if extractor, ok := r.extractors[parent]; ok {
+			return extractor, true
+		}
+	}
+	if extractor, ok := r.extractors[base]; ok {
+		return extractor, true
+	}
+
+	major, _, _ := strings.Cut(base, "/")
+	extractor, ok := r.extractors[major+"/"]
+	return extractor, ok
+}
+
+// Extract sniffs the file's type from its content and returns its normalised
+// text. Files of unregistered types fail with ErrNoExtractor.
+func (r *ExtractorRegistry) Extract(filePath string) (Extraction, error) {
+	mime, err := mimetype.DetectFile(filePath)
+	if err != nil {
+		return Extraction{}, fmt.Errorf("failed to detect content type: %w", err)
+	}
+
+	extractor, ok := r.Lookup(mime.String())
+	if !ok {
+		return Extraction{MIMEType: mime.String()}, fmt.Errorf("%w %s (%s)", ErrNoExtractor, mime.String(), filepath.Base(filePath))
+	}
+
+	log.Printf("[DEBUG] Extracting %s as %s with %s extractor", filepath.Base(filePath), mime.String(), extractor.Name())
+	extraction, err := extractor.Extract(filePath, mime.String())
+	if err != nil {
+		return Extraction{}, fmt.Errorf("failed to extract %s: %w", filepath.Base(filePath), err)
+	}
+
+	extraction.Text = NormalizeText(extraction.Text)
+	extraction.MIMEType = mime.String()
+	extraction.Extractor = extractor.Name()
+	return extraction, nil
+}
+
+// ExtractText returns only the text of Extract, for code that reads documents
+// the way it would read plain text files.
+func (r *ExtractorRegistry) ExtractText(filePath string) (string, error) {
+	extraction, err := r.Extract(filePath)
+	if err != nil {
+		return "", err
+	}
+	return extraction.Text, nil
+}
+
+// NormalizeText makes extracted text valid UTF-8 with "\n" line endings and
+// no surrounding whitespace.
+func NormalizeText(text string) string {
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	text = strings.TrimPrefix(text, "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\x00", "")
+	return strings.TrimSpace(text)
+}
+
+// TextExtractor reads text files as they are.
+type TextExtractor struct{}
+
+func (TextExtractor) Name() string { return "text" }
+
+func (TextExtractor) Extract(filePath, mimeType string) (Extraction, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return Extraction{}, err
+	}
+	return Extraction{Text: string(content)}, nil
+}
+
+// AudioTranscriber is implemented by OpenAiService, whose Transcript reuses
+// transcripts kept in the artifact store.
+type AudioTranscriber interface {
+	Transcript(audioPath string) (string, error)
+}
+
+// AudioExtractor returns the transcript of audio files.
+type AudioExtractor struct {
+	Transcriber AudioTranscriber
+}
+
+func (AudioExtractor) Name() string { return "audio-transcript" }
+
+func (e AudioExtractor) Extract(filePath, mimeType string) (Extraction, error) {
+	transcript, err := e.Transcriber.Transcript(filePath)
+	if err != nil {
+		return Extraction{}, err
+	}
+	return Extraction{Text: transcript, Metadata: map[string]string{"model": openai.Whisper1}}, nil
+}
+
+// ImageAnalyzer is implemented by OpenAiService.
+type ImageAnalyzer interface {
+	AnalyzeImages(req ImageAnalysisRequest) (string, error)
+}
+
+// ImageExtractor returns a vision model's description of images, including
+// any text visible in them.
+type ImageExtractor struct {
+	Analyzer ImageAnalyzer
+	// Prompt replaces the default description prompt.
+	Prompt string
+}
+
+func (ImageExtractor) Name() string { return "image-description" }
+
+func (e ImageExtractor) Extract(filePath, mimeType string) (Extraction, error) {
+	prompt := e.Prompt
+	if prompt == "" {
+		prompt = defaultImageExtractionPrompt
+	}
+
+	description, err := e.Analyzer.AnalyzeImages(ImageAnalysisRequest{
+		Prompt: prompt,
+		Images: []ImageInput{{Path: filePath}},
+		Detail: openai.ImageURLDetailHigh,
+	})
+	if err != nil {
+		return Extraction{}, err
+	}
+	return Extraction{Text: description, Metadata: map[string]string{"model": visionModel}}, nil
+}
+
+// OfficeExtractor returns the text of Word and OpenDocument text files, with
+// headings and tables, and of Excel workbooks as CSV per sheet.
+type OfficeExtractor struct{}
+
+func (OfficeExtractor) Name() string { return "office" }
+
+func (OfficeExtractor) Extract(filePath, mimeType string) (Extraction, error) {
+	base, _, _ := strings.Cut(mimeType, ";")
+	switch base {
+	case DOCXMIMEType:
+		text, err := ReadDOCX(filePath)
+		return Extraction{Text: text, Metadata: map[string]string{"format": "docx"}}, err
+	case XLSXMIMEType:
+		spreadsheet, err := ReadXLSX(filePath)
+		if err != nil {
+			return Extraction{}, err
+		}
+		names := make([]string, len(spreadsheet.Sheets))
+		for i, sheet := range spreadsheet.Sheets {
+			names[i] = sheet.Name
+		}
+		return Extraction{Text: spreadsheet.Text(), Metadata: map[string]string{"format": "xlsx", "sheets": strings.Join(names, ",")}}, nil
+	default:
+		text, err := ReadODT(filePath)
+		return Extraction{Text: text, Metadata: map[string]string{"format": "odt"}}, err
+	}
+}
+
+// ImageReader is implemented by OpenAiService, whose ImageText reuses OCR
+// results kept in the artifact store.
+type ImageReader interface {
+	ImageText(imagePath string) (string, error)
+}
+
+// PDFExtractor returns the text layer of PDFs, page by page. Pages without
+// text, such as scans, have their images read by Reader when it is set.
+type PDFExtractor struct {
+	Reader ImageReader
+}
+
+func (PDFExtractor) Name() string { return "pdf" }
+
+func (e PDFExtractor) Extract(filePath, mimeType string) (Extraction, error) {
+	document, err := ReadPDF(filePath)
+	if err != nil {
+		return Extraction{}, err
+	}
+
+	var ocrPages []string
+	images := 0
+	for i, page := range document.Pages {
+		images += len(page.Images)
+		if strings.TrimSpace(page.Text) != "" || len(page.Images) == 0 || e.Reader == nil {
+			continue
+		}
+
+		text, err := e.readPageImages(page)
+		if err != nil {
+			return Extraction{}, fmt.Errorf("failed to read page %d: %w", page.Number, err)
+		}
+		document.Pages[i].Text = text
+		ocrPages = append(ocrPages, strconv.Itoa(page.Number))
+	}
+
+	metadata := map[string]string{
+		"pages":  strconv.Itoa(len(document.Pages)),
+		"images": strconv.Itoa(images),
+	}
+	if len(ocrPages) > 0 {
+		metadata["ocrPages"] = strings.Join(ocrPages, ",")
+		metadata["model"] = visionModel
+	}
+	return Extraction{Text: document.Text(), Metadata: metadata}, nil
+}
+
+// readPageImages runs OCR on the images of a page the vision model accepts.
+func (e PDFExtractor) readPageImages(page PDFPage) (string, error) {
+	dir, err := os.MkdirTemp("", "pdf-page-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var texts []string
+	for _, img := range page.Images {
+		if img.MIMEType != "image/png" && img.MIMEType != "image/jpeg" {
+			log.Printf("[DEBUG] Skipping OCR of %s: unsupported type %s", img.Name, img.MIMEType)
+			continue
+		}
+		imagePath := filepath.Join(dir, img.Name)
+		if err := os.WriteFile(imagePath, img.Data, 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", img.Name, err)
+		}
+
+		log.Printf("[INFO] Page %d has no text layer, reading %s with the vision model", page.Number, img.Name)
+		text, err := e.Reader.ImageText(imagePath)
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
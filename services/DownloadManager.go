@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// partSuffix marks unfinished downloads; they are resumed, never used.
+	partSuffix = ".part"
+	// validatorSuffix names the file next to a partial download holding the
+	// ETag or Last-Modified it was fetched with.
+	validatorSuffix = ".validator"
+
+	defaultDownloadConcurrency = 4
+	progressStepBytes          = 1 << 20
+)
+
+// DownloadRequest is one file to download. SHA256, when set (or found in the
+// manager's checksum manifest under the destination's file name), must match
+// the downloaded content.
+type DownloadRequest struct {
+	URL    string
+	Dest   string
+	SHA256 string
+}
+
+// DownloadResult is the outcome of one download.
+type DownloadResult struct {
+	Dest    string `json:"dest"`
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size"`
+	Resumed bool   `json:"resumed,omitempty"`
+	Err     error  `json:"-"`
+}
+
+// DownloadProgress is reported while a download runs. Total is -1 when the
+// server did not announce a length.
+type DownloadProgress struct {
+	URL      string
+	Dest     string
+	Received int64
+	Total    int64
+	Done     bool
+}
+
+// DownloadManager downloads files through the shared HTTP client. Data is
+// written to "<dest>.part" and renamed to dest only once it is complete and
+// its checksum verified, so a failed download never looks like a valid file.
+// Interrupted downloads are resumed with a Range request, guarded by If-Range
+// so a resource that changed in between is downloaded again in full.
+type DownloadManager struct {
+	client      *HTTPClient
+	concurrency int
+	checksums   map[string]string
+	onProgress  func(DownloadProgress)
+}
+
+// NewDownloadManager creates a manager running at most concurrency downloads
+// at once (4 when 0). A nil client uses the default HTTP client at call time.
+func NewDownloadManager(client *HTTPClient, concurrency int) (*DownloadManager, error) {
+	if concurrency < 0 {
+		return nil, fmt.Errorf("download concurrency must not be negative")
+	}
+	if concurrency == 0 {
+		concurrency = defaultDownloadConcurrency
+	}
+	return &DownloadManager{client: client, concurrency: concurrency}, nil
+}
+
+// WithChecksums makes downloads without an explicit SHA256 verify against
+// checksums, keyed by destination file name (see LoadChecksumManifest).
+func (m *DownloadManager) WithChecksums(checksums map[string]string) *DownloadManager {
+	m.checksums = checksums
+	return m
+}
+
+// WithProgress makes the manager report progress to onProgress, at most once
+// per MiB and once more when a download completes.
+func (m *DownloadManager) WithProgress(onProgress func(DownloadProgress)) *DownloadManager {
+	m.onProgress = onProgress
+	return m
+}
+
+// LogDownloadProgress is a progress callback that logs completed downloads
+// and, for large ones, intermediate progress.
+func LogDownloadProgress(progress DownloadProgress) {
+	if progress.Done {
+		log.Printf("[INFO] Downloaded %s (%d bytes)", progress.Dest, progress.Received)
+		return
+	}
+	if progress.Total > 0 {
+		log.Printf("[DEBUG] Downloading %s: %d/%d bytes", progress.Dest, progress.Received, progress.Total)
+	}
+}
+
+// LoadChecksumManifest reads a sha256sum-style file ("<hex>  <name>" per
+// line) into a map from file name to checksum.
+func LoadChecksumManifest(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checksum manifest: %w", err)
+	}
+	defer file.Close()
+
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		sum, name, ok := strings.Cut(text, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("invalid checksum manifest line %d", line)
+		}
+		checksums[filepath.Base(name)] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksum manifest: %w", err)
+	}
+	return checksums, nil
+}
+
+// DownloadAll runs the requests through a bounded queue and returns their
+// results in request order.
+func (m *DownloadManager) DownloadAll(ctx context.Context, requests []DownloadRequest) []DownloadResult {
+	results := make([]DownloadResult, len(requests))
+	slots := make(chan struct{}, m.concurrency)
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i], _ = m.Download(ctx, request)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Download fetches one file, resuming a previous partial download if there is
+// one. Partial data is kept for a later resume unless it turned out invalid.
+func (m *DownloadManager) Download(ctx context.Context, request DownloadRequest) (DownloadResult, error) {
+	result := DownloadResult{Dest: request.Dest}
+	fail := func(err error) (DownloadResult, error) {
+		result.Err = err
+		return result, err
+	}
+
+	expected := strings.ToLower(request.SHA256)
+	if expected == "" {
+		expected = m.checksums[filepath.Base(request.Dest)]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(request.Dest), 0755); err != nil {
+		return fail(fmt.Errorf("failed to create download directory: %w", err))
+	}
+
+	partPath := request.Dest + partSuffix
+	sum, size, resumed, err := m.fetch(ctx, request, partPath)
+	if err != nil {
+		return fail(err)
+	}
+	result.SHA256, result.Size, result.Resumed = sum, size, resumed
+
+	if expected != "" && sum != expected {
+		removePartial(partPath)
+		return fail(fmt.Errorf("checksum mismatch for %s: got %s, want %s", filepath.Base(request.Dest), sum, expected))
+	}
+
+	if err := os.Rename(partPath, request.Dest); err != nil {
+		return fail(fmt.Errorf("failed to move download into place: %w", err))
+	}
+	os.Remove(partPath + validatorSuffix)
+	return result, nil
+}
+
+// removePartial deletes a partial download and its validator.
+func removePartial(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + validatorSuffix)
+}
+
+// rangeValidator returns the value to send as If-Range when resuming resp's
+// body: a strong ETag, else Last-Modified. Weak ETags cannot be used.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// fetch fills partPath with the complete body and returns its SHA-256 and size.
+func (m *DownloadManager) fetch(ctx context.Context, request DownloadRequest, partPath string) (string, int64, bool, error) {
+	client := m.client
+	if client == nil {
+		client = DefaultHTTPClient()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.URL, nil)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("invalid download URL for %s", filepath.Base(request.Dest))
+	}
+
+	// Only partial downloads with a validator are resumed: without one there is
+	// no way to tell whether the resource changed since.
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+		if validator, err := os.ReadFile(partPath + validatorSuffix); err == nil && len(validator) > 0 {
+			offset = info.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", string(validator))
+		} else {
+			log.Printf("[WARN] Partial download of %s cannot be validated, downloading it again", filepath.Base(request.Dest))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if httpErr, ok := AsHTTPError(err); ok && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// The partial file does not fit the current resource; start over.
+		log.Printf("[WARN] Cannot resume %s, downloading it again", filepath.Base(request.Dest))
+		removePartial(partPath)
+		req.Header.Del("Range")
+		req.Header.Del("If-Range")
+		offset = 0
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer resp.Body.Close()
+
+	resumed := offset > 0 && resp.StatusCode == http.StatusPartialContent && rangeStart(resp) == offset
+	if !resumed && resp.StatusCode == http.StatusPartialContent {
+		removePartial(partPath)
+		return "", 0, false, fmt.Errorf("unexpected partial response for %s", filepath.Base(request.Dest))
+	}
+	if !resumed {
+		if offset > 0 {
+			log.Printf("[INFO] %s changed since the partial download, downloading it again", filepath.Base(request.Dest))
+		}
+		offset = 0
+		if err := saveValidator(partPath, resp.Header); err != nil {
+			return "", 0, false, err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if resumed {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("failed to open partial download: %w", err)
+	}
+
+	hasher := sha256.New()
+	if resumed {
+		if err := hashFile(hasher, partPath); err != nil {
+			part.Close()
+			return "", 0, false, fmt.Errorf("failed to hash partial download: %w", err)
+		}
+		log.Printf("[INFO] Resuming %s at byte %d", filepath.Base(request.Dest), offset)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	progress := &progressWriter{
+		report:   m.onProgress,
+		progress: DownloadProgress{URL: RedactURL(request.URL), Dest: request.Dest, Received: offset, Total: total},
+	}
+
+	written, err := io.Copy(io.MultiWriter(part, hasher, progress), resp.Body)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, false, fmt.Errorf("download of %s interrupted after %d bytes: %w", filepath.Base(request.Dest), offset+written, err)
+	}
+
+	progress.finish()
+	return hex.EncodeToString(hasher.Sum(nil)), offset + written, resumed, nil
+}
+
+// saveValidator records the validator of a new download, or removes a stale
+// one when the server sent none.
+func saveValidator(partPath string, header http.Header) error {
+	validator := rangeValidator(header)
+	if validator == "" {
+		if err := os.Remove(partPath + validatorSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove download validator: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(partPath+validatorSuffix, []byte(validator), 0644); err != nil {
+		return fmt.Errorf("failed to save download validator: %w", err)
+	}
+	return nil
+}
+
+// rangeStart returns the first byte of a 206 response's Content-Range, or -1.
+func rangeStart(resp *http.Response) int64 {
+	value, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, _ := strings.Cut(value, "-")
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return offset
+}
+
+func hashFile(hasher hash.Hash, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hasher, file)
+	return err
+}
+
+type progressWriter struct {
+	report       func(DownloadProgress)
+	progress     DownloadProgress
+	lastReported int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.progress.Received += int64(len(p))
+	if w.report != nil && w.progress.Received-w.lastReported >= progressStepBytes {
+		w.lastReported = w.progress.Received
+		w.report(w.progress)
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) finish() {
+	if w.report != nil {
+		w.progress.Done = true
+		w.report(w.progress)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// contentServer serves content with the given ETag and records the Range
+// header of every request.
+func contentServer(t *testing.T, etag string, content []byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &ranges
+}
+
+// writePartial leaves a partial download of dest, with validator when set.
+func writePartial(t *testing.T, dest string, data []byte, validator string) {
+	t.Helper()
+	if err := os.WriteFile(dest+partSuffix, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if validator != "" {
+		if err := os.WriteFile(dest+partSuffix+validatorSuffix, []byte(validator), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func download(t *testing.T, url, dest string) DownloadResult {
+	t.Helper()
+	manager, err := NewDownloadManager(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := manager.Download(context.Background(), DownloadRequest{URL: url, Dest: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SHA256 != sha256Hex(content) {
+		t.Errorf("SHA256 = %s, want the checksum of the stored file", result.SHA256)
+	}
+	if FileExists(dest+partSuffix) || FileExists(dest+partSuffix+validatorSuffix) {
+		t.Error("partial download left behind")
+	}
+	return result
+}
+
+func TestDownloadResumesUnchangedResource(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10))
+	server, ranges := contentServer(t, `"v1"`, content)
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	writePartial(t, dest, content[:40], `"v1"`)
+
+	result := download(t, server.URL, dest)
+	if !result.Resumed || result.Size != int64(len(content)) {
+		t.Errorf("Resumed = %v, Size = %d, want a resumed download of %d bytes", result.Resumed, result.Size, len(content))
+	}
+	if got := *ranges; len(got) != 1 || got[0] != "bytes=40-" {
+		t.Errorf("Range headers = %q, want one request from byte 40", got)
+	}
+	if stored, _ := os.ReadFile(dest); !bytes.Equal(stored, content) {
+		t.Errorf("stored %q, want %q", stored, content)
+	}
+}
+
+func TestDownloadRestartsChangedResource(t *testing.T) {
+	content := []byte(strings.Repeat("new content ", 10))
+	server, _ := contentServer(t, `"v2"`, content)
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	writePartial(t, dest, []byte("old content old content"), `"v1"`)
+
+	result := download(t, server.URL, dest)
+	if result.Resumed {
+		t.Error("Resumed = true, want a full download of the changed resource")
+	}
+	if stored, _ := os.ReadFile(dest); !bytes.Equal(stored, content) {
+		t.Errorf("stored %q, want %q", stored, content)
+	}
+}
+
+func TestDownloadRestartsUnvalidatedPartial(t *testing.T) {
+	content := []byte(strings.Repeat("abc", 20))
+	server, ranges := contentServer(t, `"v1"`, content)
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	writePartial(t, dest, []byte("stale"), "")
+
+	result := download(t, server.URL, dest)
+	if result.Resumed || (*ranges)[0] != "" {
+		t.Errorf("Resumed = %v with Range %q, want a plain request", result.Resumed, (*ranges)[0])
+	}
+	if stored, _ := os.ReadFile(dest); !bytes.Equal(stored, content) {
+		t.Errorf("stored %q, want %q", stored, content)
+	}
+}
+
+func TestCentralaMirrorFetchesResourceOnce(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("mirrored"))
+	}))
+	defer server.Close()
+
+	mirror, err := NewCentralaMirror(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			objectPath, _, err := mirror.Fetch("dane/file.txt", server.URL, false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if content, _ := os.ReadFile(objectPath); string(content) != "mirrored" {
+				t.Errorf("object holds %q", content)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+}
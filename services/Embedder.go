@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// OpenAI accepts up to 2048 inputs and roughly 300k tokens per request.
+	openAIEmbeddingMaxInputs = 2048
+	openAIEmbeddingMaxTokens = 250_000
+	ollamaEmbeddingMaxInputs = 64
+)
+
+// openAIEmbeddingDimensions holds the native vector size of each model.
+var openAIEmbeddingDimensions = map[openai.EmbeddingModel]int{
+	openai.AdaEmbeddingV2:  1536,
+	openai.SmallEmbedding3: 1536,
+	openai.LargeEmbedding3: 3072,
+}
+
+// Embedder turns texts into vectors. Embed returns one vector per input, in
+// input order, each of length Dimension().
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Dimension() int
+	Model() string
+}
+
+type OpenAIEmbedder struct {
+	client     *openai.Client
+	model      openai.EmbeddingModel
+	dimensions int
+	shortened  bool
+}
+
+// NewOpenAIEmbedder creates an embedder for an OpenAI embedding model.
+// dimensions <= 0 keeps the model's native size; text-embedding-3 models can be
+// shortened to any smaller size through the API's dimensions parameter.
+func NewOpenAIEmbedder(apiKey string, model openai.EmbeddingModel, dimensions int) (*OpenAIEmbedder, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not specified - make sure to set environment variable")
+	}
+
+	if model == "" {
+		model = openai.SmallEmbedding3
+	}
+
+	native, ok := openAIEmbeddingDimensions[model]
+	if !ok {
+		return nil, fmt.Errorf("unsupported embedding model %q", model)
+	}
+
+	shortened := dimensions > 0 && dimensions != native
+	if shortened && model == openai.AdaEmbeddingV2 {
+		return nil, fmt.Errorf("%s does not support custom dimensions", model)
+	}
+	if dimensions > native {
+		return nil, fmt.Errorf("%s supports at most %d dimensions, got %d", model, native, dimensions)
+	}
+	if dimensions <= 0 {
+		dimensions = native
+	}
+
+	return &OpenAIEmbedder{
+		client:     openai.NewClient(apiKey),
+		model:      model,
+		dimensions: dimensions,
+		shortened:  shortened,
+	}, nil
+}
+
+func (e *OpenAIEmbedder) Dimension() int { return e.dimensions }
+
+func (e *OpenAIEmbedder) Model() string { return string(e.model) }
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); {
+		// Grow the batch until either provider limit would be exceeded.
+		end, tokens := start, 0
+		for end < len(texts) && end-start < openAIEmbeddingMaxInputs {
+			estimate := estimateTokens(texts[end])
+			if end > start && tokens+estimate > openAIEmbeddingMaxTokens {
+				break
+			}
+			tokens += estimate
+			end++
+		}
+
+		req := openai.EmbeddingRequest{
+			Input: texts[start:end],
+			Model: e.model,
+		}
+		if e.shortened {
+			req.Dimensions = e.dimensions
+		}
+
+		log.Printf("[INFO] Requesting OpenAI embeddings - Model: %s, Inputs: %d, Estimated Tokens: %d", e.model, end-start, tokens)
+		resp, err := e.client.CreateEmbeddings(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embeddings: %w", err)
+		}
+
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, received %d", end-start, len(resp.Data))
+		}
+
+		batch := make([][]float32, len(resp.Data))
+		for _, item := range resp.Data {
+			if item.Index < 0 || item.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+			}
+			batch[item.Index] = item.Embedding
+		}
+		vectors = append(vectors, batch...)
+
+		start = end
+	}
+
+	return vectors, nil
+}
+
+// estimateTokens over-estimates the token count (about 3 bytes per token) so
+// batches stay under the provider limit without a tokenizer.
+func estimateTokens(text string) int {
+	return len(text)/3 + 1
+}
+
+type OllamaEmbedder struct {
+	client     *api.Client
+	model      string
+	dimensions int
+}
+
+// NewOllamaEmbedder creates an embedder for a local Ollama model. Ollama does
+// not report vector sizes, so a probe input is embedded once to learn it.
+func NewOllamaEmbedder(baseURL, model string) (*OllamaEmbedder, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("baseURL not specified")
+	}
+
+	if model == "" {
+		return nil, fmt.Errorf("model not specified")
+	}
+
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	embedder := &OllamaEmbedder{
+		client: api.NewClient(parsedURL, &http.Client{Timeout: 2 * time.Minute}),
+		model:  model,
+	}
+
+	probe, err := embedder.Embed(context.Background(), []string{"dimension probe"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe embedding dimension: %w", err)
+	}
+	embedder.dimensions = len(probe[0])
+
+	return embedder, nil
+}
+
+func (e *OllamaEmbedder) Dimension() int { return e.dimensions }
+
+func (e *OllamaEmbedder) Model() string { return e.model }
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += ollamaEmbeddingMaxInputs {
+		end := min(start+ollamaEmbeddingMaxInputs, len(texts))
+
+		log.Printf("[INFO] Requesting Ollama embeddings - Model: %s, Inputs: %d", e.model, end-start)
+		resp, err := e.client.Embed(ctx, &api.EmbedRequest{
+			Model: e.model,
+			Input: texts[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embeddings: %w", err)
+		}
+
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, received %d", end-start, len(resp.Embeddings))
+		}
+		vectors = append(vectors, resp.Embeddings...)
+	}
+
+	return vectors, nil
+}
+
+// CachedEmbedder remembers vectors by content hash, in memory and optionally
+// in the artifact store, so unchanged texts are never sent to the provider
+// twice. Stored vectors are embedding derivations of the text's artifact.
+type CachedEmbedder struct {
+	inner     Embedder
+	artifacts *ArtifactStore
+	mu        sync.RWMutex
+	memory    map[string][]float32
+}
+
+// NewCachedEmbedder wraps inner with a cache. artifacts may be nil for a
+// memory-only cache.
+func NewCachedEmbedder(inner Embedder, artifacts *ArtifactStore) (*CachedEmbedder, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("embedder not specified")
+	}
+
+	return &CachedEmbedder{
+		inner:     inner,
+		artifacts: artifacts,
+		memory:    make(map[string][]float32),
+	}, nil
+}
+
+func (c *CachedEmbedder) Dimension() int { return c.inner.Dimension() }
+
+func (c *CachedEmbedder) Model() string { return c.inner.Model() }
+
+func (c *CachedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+
+	// Only the first occurrence of each missing text is sent to the provider.
+	var missing []string
+	missingIndex := make(map[string]int)
+	for i, text := range texts {
+		keys[i] = c.key(text)
+		if vector, ok := c.lookup(keys[i], text); ok {
+			vectors[i] = vector
+			continue
+		}
+		if _, queued := missingIndex[keys[i]]; !queued {
+			missingIndex[keys[i]] = len(missing)
+			missing = append(missing, text)
+		}
+	}
+
+	log.Printf("[DEBUG] Embedding cache - Inputs: %d, Hits: %d, Misses: %d",
+		len(texts), len(texts)-len(missing), len(missing))
+
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.inner.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range texts {
+		if vectors[i] != nil {
+			continue
+		}
+		vectors[i] = embedded[missingIndex[keys[i]]]
+	}
+
+	for key, idx := range missingIndex {
+		c.store(key, missing[idx], embedded[idx])
+	}
+
+	return vectors, nil
+}
+
+// key includes the model and dimension so switching either never returns
+// vectors of the wrong shape.
+func (c *CachedEmbedder) key(text string) string {
+	sum := sha256.Sum256([]byte(c.inner.Model() + "\x00" + strconv.Itoa(c.inner.Dimension()) + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// derivation identifies vectors of the wrapped model and dimension.
+func (c *CachedEmbedder) derivation() Derivation {
+	return Derivation{
+		Kind:     DerivedEmbedding,
+		Producer: c.inner.Model(),
+		Version:  strconv.Itoa(c.inner.Dimension()),
+	}
+}
+
+func (c *CachedEmbedder) lookup(key, text string) ([]float32, bool) {
+	c.mu.RLock()
+	vector, ok := c.memory[key]
+	c.mu.RUnlock()
+	if ok || c.artifacts == nil {
+		return vector, ok
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	source, err := c.artifacts.Get(hex.EncodeToString(sum[:]) + ".txt")
+	if err != nil {
+		return nil, false
+	}
+	artifact, ok := c.artifacts.Derived(source, c.derivation())
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(artifact.Path)
+	if err != nil || len(data) != 4*c.inner.Dimension() {
+		return nil, false
+	}
+
+	vector = make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+
+	c.mu.Lock()
+	c.memory[key] = vector
+	c.mu.Unlock()
+	return vector, true
+}
+
+func (c *CachedEmbedder) store(key, text string, vector []float32) {
+	c.mu.Lock()
+	c.memory[key] = vector
+	c.mu.Unlock()
+
+	if c.artifacts == nil {
+		return
+	}
+
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+	source, err := c.artifacts.Put([]byte(text), ".txt")
+	if err == nil {
+		_, err = c.artifacts.PutDerived(source, c.derivation(), data, ".f32")
+	}
+	if err != nil {
+		log.Printf("[WARN] Failed to store embedding: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+type countingEmbedder struct {
+	texts int
+}
+
+func (e *countingEmbedder) Dimension() int { return 2 }
+
+func (e *countingEmbedder) Model() string { return "test-model" }
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.texts += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func TestCachedEmbedderStoresDerivedArtifacts(t *testing.T) {
+	artifacts, err := NewArtifactStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingEmbedder{}
+
+	first, err := NewCachedEmbedder(inner, artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Embed(context.Background(), []string{"abc", "de", "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache over the same store finds the vectors without the provider.
+	second, err := NewCachedEmbedder(inner, artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := second.Embed(context.Background(), []string{"de", "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.texts != 2 {
+		t.Errorf("provider embedded %d texts, want 2", inner.texts)
+	}
+	if vectors[0][0] != 2 || vectors[1][0] != 3 {
+		t.Errorf("vectors = %v", vectors)
+	}
+
+	source, err := artifacts.Put([]byte("abc"), ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, err := artifacts.Derivations(source.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(derived) != 1 || derived[0].Kind != DerivedEmbedding || derived[0].Producer != "test-model" {
+		t.Errorf("derivations = %+v, want one embedding", derived)
+	}
+}
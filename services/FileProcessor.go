@@ -1,68 +1,42 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
-// Add this function to check if unzip is available
-func init() {
-	_, err := exec.LookPath("unzip")
-	if err != nil {
-		log.Fatal("unzip command not found. Please install unzip to use this application.")
-	}
-}
-
-// DownloadFile downloads a file from URL to the specified filepath
+// DownloadFile downloads a file from URL to the specified filepath with a
+// DownloadManager, so failed downloads never end up at filepath.
 func DownloadFile(url string, filepath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath)
+	manager, err := NewDownloadManager(nil, 1)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if _, err := manager.Download(context.Background(), DownloadRequest{URL: url, Dest: filepath}); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
 	}
-
 	return nil
 }
 
-// UnzipFile extracts a ZIP file to the specified directory, optionally using a password
-func UnzipFile(zipPath, destDir string, password *string) error {
+// UnzipFile extracts a ZIP (or tar/gzip) file to the specified directory,
+// optionally using a password, and returns the extracted files.
+func UnzipFile(zipPath, destDir string, password *string) ([]ExtractedFile, error) {
 	log.Printf("[INFO] Unzipping %s to %s", zipPath, destDir)
 
-	// Ensure destination directory exists
-	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
-	}
-
-	args := []string{"-o", zipPath, "-d", destDir}
+	options := ExtractOptions{}
 	if password != nil {
-		args = append([]string{"-P", *password}, args...)
+		options.Password = *password
 	}
 
-	cmd := exec.Command("unzip", args...)
-	output, err := cmd.CombinedOutput()
+	files, err := ExtractArchive(zipPath, destDir, options)
 	if err != nil {
-		log.Printf("[ERROR] Unzip command failed: %s", string(output))
-		return fmt.Errorf("failed to unzip file: %w", err)
+		return nil, fmt.Errorf("failed to unzip file: %w", err)
 	}
-
-	log.Printf("[INFO] Successfully unzipped %s", zipPath)
-	return nil
+	return files, nil
 }
 
 // ListFiles returns a list of non-directory files in the specified directory
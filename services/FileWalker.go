@@ -0,0 +1,219 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// mimeSniffBytes is how much of a file is read to detect its type, matching
+// mimetype's default read limit.
+const mimeSniffBytes = 3072
+
+// WalkOptions filters the files returned by WalkFiles. Zero values disable
+// the corresponding filter.
+type WalkOptions struct {
+	// MaxDepth limits recursion: 1 lists only the root directory.
+	MaxDepth int
+	// Include and Exclude are globs matched against the slash-separated path
+	// relative to the root. Patterns without a "/" match the base name, and
+	// "**" matches any number of directories. Excluded directories are not
+	// entered.
+	Include []string
+	Exclude []string
+	// MIMETypes keeps files whose detected type (or one of its parents, e.g.
+	// "application/zip" for a .docx) is listed. "text/" or "text/*" matches
+	// every text type.
+	MIMETypes []string
+	// MinSize and MaxSize bound the file size in bytes.
+	MinSize int64
+	MaxSize int64
+}
+
+// FileEntry is one regular file found by WalkFiles.
+type FileEntry struct {
+	Path     string `json:"path"`
+	RelPath  string `json:"relPath"`
+	Dir      string `json:"dir"`
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mimeType"`
+	SHA256   string `json:"sha256"`
+}
+
+// WalkFiles lists the regular files under root matching options, sorted by
+// relative path. Symlinks are not followed.
+func WalkFiles(root string, options WalkOptions) ([]FileEntry, error) {
+	log.Printf("[DEBUG] Walking directory: %s", root)
+
+	var entries []FileEntry
+	err := filepath.WalkDir(root, func(current string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if current == root {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, current)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		depth := strings.Count(relative, "/") + 1
+
+		if d.IsDir() {
+			if matchesAnyGlob(options.Exclude, relative) || (options.MaxDepth > 0 && depth >= options.MaxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if matchesAnyGlob(options.Exclude, relative) {
+			return nil
+		}
+		if len(options.Include) > 0 && !matchesAnyGlob(options.Include, relative) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < options.MinSize || (options.MaxSize > 0 && info.Size() > options.MaxSize) {
+			return nil
+		}
+
+		entry, err := describeFile(current, relative, info.Size())
+		if err != nil {
+			return err
+		}
+		if len(options.MIMETypes) > 0 && !matchesMIMEType(entry.MIMEType, options.MIMETypes) {
+			return nil
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RelPath < entries[j].RelPath })
+	return entries, nil
+}
+
+// GroupByDir groups entries by their directory relative to the walk root;
+// files in the root itself are under ".".
+func GroupByDir(entries []FileEntry) map[string][]FileEntry {
+	groups := make(map[string][]FileEntry)
+	for _, entry := range entries {
+		groups[entry.Dir] = append(groups[entry.Dir], entry)
+	}
+	return groups
+}
+
+// EntryPaths returns the paths of entries, for code that works on plain paths.
+func EntryPaths(entries []FileEntry) []string {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.Path
+	}
+	return paths
+}
+
+// describeFile reads the file once to both detect its type and hash it.
+func describeFile(filePath, relative string, size int64) (FileEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, mimeSniffBytes)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileEntry{}, fmt.Errorf("failed to read %s: %w", relative, err)
+	}
+	header = header[:n]
+
+	hash := sha256.New()
+	hash.Write(header)
+	if _, err := io.Copy(hash, file); err != nil {
+		return FileEntry{}, fmt.Errorf("failed to hash %s: %w", relative, err)
+	}
+
+	return FileEntry{
+		Path:     filePath,
+		RelPath:  relative,
+		Dir:      path.Dir(relative),
+		Size:     size,
+		MIMEType: mimetype.Detect(header).String(),
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// matchesMIMEType checks the detected type and its parents against filters.
+func matchesMIMEType(detected string, filters []string) bool {
+	base, _, _ := strings.Cut(detected, ";")
+	for mime := mimetype.Lookup(base); mime != nil; mime = mime.Parent() {
+		base, _, _ := strings.Cut(mime.String(), ";")
+		for _, filter := range filters {
+			filter = strings.TrimSuffix(filter, "*")
+			if base == filter || (strings.HasSuffix(filter, "/") && strings.HasPrefix(base, filter)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAnyGlob(patterns []string, relative string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(relative)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(relative, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches path segments, letting a "**" segment stand for any
+// number of directories.
+func matchGlob(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchGlob(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
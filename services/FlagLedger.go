@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var flagPattern = regexp.MustCompile(`\{\{FLG:[^}]+\}\}`)
+
+// Flag is a flag found in a Centrala (or verify) response.
+type Flag struct {
+	Flag    string      `json:"flag"`
+	Task    string      `json:"task"`
+	RunID   string      `json:"runId,omitempty"`
+	Answer  interface{} `json:"answer,omitempty"`
+	FoundAt time.Time   `json:"foundAt"`
+}
+
+// ExtractFlags returns every {{FLG:...}} marker in text, in order of appearance.
+func ExtractFlags(text string) []string {
+	return flagPattern.FindAllString(text, -1)
+}
+
+// FlagLedger records found flags in an append-only JSONL file. Each flag is
+// kept once, with the task and run that first found it. Centrala returns the
+// same flag for every accepted answer, so repeats are logged too and only
+// update the task's latest accepted answer.
+type FlagLedger struct {
+	path    string
+	secrets []string
+	mu      sync.RWMutex
+	flags   []Flag
+	seen    map[string]bool
+	latest  map[string]Flag
+}
+
+// NewFlagLedger opens (or creates) the ledger at path. secrets are redacted
+// from stored answers, in addition to secret-looking JSON keys.
+func NewFlagLedger(path string, secrets ...string) (*FlagLedger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("flag ledger path not specified")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create flag ledger directory: %w", err)
+	}
+
+	ledger := &FlagLedger{
+		path:    path,
+		secrets: secrets,
+		seen:    make(map[string]bool),
+		latest:  make(map[string]Flag),
+	}
+
+	if err := ledger.load(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Loaded %d flags from %s", len(ledger.flags), path)
+	return ledger, nil
+}
+
+func (l *FlagLedger) load() error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open flag ledger: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var flag Flag
+		if err := json.Unmarshal(scanner.Bytes(), &flag); err != nil {
+			return fmt.Errorf("failed to parse flag ledger line %d: %w", line, err)
+		}
+		if !l.seen[flag.Flag] {
+			l.seen[flag.Flag] = true
+			l.flags = append(l.flags, flag)
+		}
+		l.latest[flag.Task] = flag
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read flag ledger: %w", err)
+	}
+	return nil
+}
+
+// Record stores every flag found in texts, with the redacted answer, and
+// returns the new ones. Flags already in the ledger only update the task's
+// latest accepted answer.
+func (l *FlagLedger) Record(task, runID string, answer interface{}, texts ...string) ([]Flag, error) {
+	answer = RedactValue(answer, l.secrets...)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var found []Flag
+	recorded := make(map[string]bool)
+	for _, text := range texts {
+		for _, value := range ExtractFlags(text) {
+			if recorded[value] {
+				continue
+			}
+			recorded[value] = true
+
+			flag := Flag{
+				Flag:    value,
+				Task:    task,
+				RunID:   runID,
+				Answer:  answer,
+				FoundAt: time.Now().UTC(),
+			}
+			if err := l.append(flag); err != nil {
+				return found, err
+			}
+			l.latest[task] = flag
+			if l.seen[value] {
+				continue
+			}
+
+			l.seen[value] = true
+			l.flags = append(l.flags, flag)
+			found = append(found, flag)
+			log.Printf("[INFO] Recorded flag for task %s (run %s)", task, runID)
+		}
+	}
+
+	return found, nil
+}
+
+func (l *FlagLedger) append(flag Flag) error {
+	line, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flag: %w", err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open flag ledger: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write flag ledger: %w", err)
+	}
+	return nil
+}
+
+// Flags returns the recorded flags, optionally limited to one task, oldest first.
+func (l *FlagLedger) Flags(task string) []Flag {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	flags := make([]Flag, 0, len(l.flags))
+	for _, flag := range l.flags {
+		if task == "" || flag.Task == task {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// Solved returns the first flag recorded for task, if any.
+func (l *FlagLedger) Solved(task string) (Flag, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, flag := range l.flags {
+		if flag.Task == task {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Latest returns the flag of the answer accepted last for task, if any.
+func (l *FlagLedger) Latest(task string) (Flag, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	flag, ok := l.latest[task]
+	return flag, ok
+}
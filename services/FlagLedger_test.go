@@ -0,0 +1,81 @@
+package services
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlagLedgerRedactsAnswers(t *testing.T) {
+	const apiKey = "0123456789abcdef-secret"
+	path := filepath.Join(t.TempDir(), "flags.jsonl")
+	ledger, err := NewFlagLedger(path, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer := CentralaData{APIKey: apiKey, Description: "uses " + apiKey}
+	if _, err := ledger.Record("json", "run-1", answer, "{{FLG:JSON}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload from disk so the stored line is checked, not just memory.
+	reloaded, err := NewFlagLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flag, ok := reloaded.Latest("json")
+	if !ok {
+		t.Fatal("flag not recorded")
+	}
+	want := map[string]interface{}{"apikey": "[REDACTED]", "description": "uses [REDACTED]", "copyright": "", "test-data": nil}
+	if !reflect.DeepEqual(flag.Answer, want) {
+		t.Errorf("stored answer = %#v, want %#v", flag.Answer, want)
+	}
+}
+
+func TestFlagLedgerLoadsLongAnswers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.jsonl")
+	ledger, err := NewFlagLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ledger.Record("documents", "run-1", strings.Repeat("x", 1<<20), "{{FLG:LONG}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFlagLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := reloaded.Flags(""); len(flags) != 1 {
+		t.Errorf("reloaded %d flags, want 1", len(flags))
+	}
+}
+
+func TestFlagLedgerLatestFollowsRepeatedFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.jsonl")
+	ledger, err := NewFlagLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.Record("loop", "run-1", "ELBLAG", "{{FLG:LOOP}}")
+	found, err := ledger.Record("loop", "run-2", "elblag", "{{FLG:LOOP}} {{FLG:LOOP}}")
+	if err != nil || len(found) != 0 {
+		t.Fatalf("Record() = %v, %v, want no new flags", found, err)
+	}
+
+	reloaded, err := NewFlagLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, l := range map[string]*FlagLedger{"ledger": ledger, "reloaded": reloaded} {
+		if flags := l.Flags("loop"); len(flags) != 1 || flags[0].RunID != "run-1" {
+			t.Errorf("%s: Flags() = %+v, want the first find only", name, flags)
+		}
+		if flag, _ := l.Latest("loop"); flag.Answer != "elblag" || flag.RunID != "run-2" {
+			t.Errorf("%s: Latest() = %+v, want the second answer", name, flag)
+		}
+	}
+}
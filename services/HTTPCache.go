@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type httpCacheBypassKey struct{}
+
+// BypassHTTPCache returns a context whose requests skip the HTTP cache, both
+// for reading and storing responses.
+func BypassHTTPCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, httpCacheBypassKey{}, true)
+}
+
+type httpCacheRevalidateKey struct{}
+
+// RevalidateHTTPCache returns a context whose requests are checked with the
+// server even when a fresh response is stored, like "Cache-Control: no-cache".
+func RevalidateHTTPCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, httpCacheRevalidateKey{}, true)
+}
+
+// HTTPCacheConfig configures an HTTPCache.
+type HTTPCacheConfig struct {
+	// DefaultMaxAge is how long a stored response is used without asking the
+	// server, unless the response says otherwise. Zero always revalidates.
+	DefaultMaxAge time.Duration
+	// HostMaxAge overrides the max-age (including the server's) per host.
+	HostMaxAge map[string]time.Duration
+	// Secrets are redacted from the URLs stored with cached responses, such
+	// as API keys in Centrala /data paths.
+	Secrets []string
+}
+
+// httpCacheEntry is the metadata stored next to a cached body.
+type httpCacheEntry struct {
+	URL          string      `json:"url"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	StoredAt     time.Time   `json:"storedAt"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+}
+
+// HTTPCache is an http.RoundTripper that keeps successful GET responses on
+// disk and revalidates them with If-None-Match / If-Modified-Since once they
+// are older than their max-age. Responses carry an X-Cache header of HIT,
+// REVALIDATED or MISS. Requests with "Cache-Control: no-cache" or a
+// RevalidateHTTPCache context are always revalidated; "no-store" or a
+// BypassHTTPCache context skips the cache.
+type HTTPCache struct {
+	dir    string
+	next   http.RoundTripper
+	config HTTPCacheConfig
+}
+
+func NewHTTPCache(dir string, next http.RoundTripper, config HTTPCacheConfig) (*HTTPCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("HTTP cache directory not specified")
+	}
+	if config.DefaultMaxAge < 0 {
+		return nil, fmt.Errorf("HTTP cache max-age must not be negative")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP cache directory: %w", err)
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &HTTPCache{dir: dir, next: next, config: config}, nil
+}
+
+func (c *HTTPCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestControl := req.Header.Get("Cache-Control")
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		strings.Contains(requestControl, "no-store") || req.Context().Value(httpCacheBypassKey{}) != nil {
+		return c.next.RoundTrip(req)
+	}
+
+	key := c.key(req)
+	entry, cached := c.load(key)
+
+	revalidate := strings.Contains(requestControl, "no-cache") || req.Context().Value(httpCacheRevalidateKey{}) != nil
+	if cached && !revalidate && time.Since(entry.StoredAt) < c.maxAge(req.URL.Hostname(), entry.Header) {
+		if resp, err := c.cachedResponse(req, key, entry, "HIT"); err == nil {
+			return resp, nil
+		}
+	}
+
+	outgoing := req
+	if cached && (entry.ETag != "" || entry.LastModified != "") {
+		outgoing = req.Clone(req.Context())
+		if entry.ETag != "" {
+			outgoing.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			outgoing.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := c.next.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached {
+		resp.Body.Close()
+		entry.StoredAt = time.Now().UTC()
+		if err := c.saveEntry(key, entry); err != nil {
+			log.Printf("[WARN] Failed to update HTTP cache entry: %v", err)
+		}
+		return c.cachedResponse(req, key, entry, "REVALIDATED")
+	}
+
+	resp.Header.Set("X-Cache", "MISS")
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	body, err := c.storingBody(key, req, resp)
+	if err != nil {
+		log.Printf("[WARN] Not caching %s: %v", RedactURL(req.URL.String(), c.config.Secrets...), err)
+		return resp, nil
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// maxAge returns the host override, else the response's own max-age, else
+// the default.
+func (c *HTTPCache) maxAge(host string, header http.Header) time.Duration {
+	if maxAge, ok := c.config.HostMaxAge[host]; ok {
+		return maxAge
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "no-cache" {
+			return 0
+		}
+		if value, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return c.config.DefaultMaxAge
+}
+
+func (c *HTTPCache) key(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *HTTPCache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *HTTPCache) bodyPath(key string) string {
+	return filepath.Join(c.dir, key+".body")
+}
+
+func (c *HTTPCache) load(key string) (httpCacheEntry, bool) {
+	content, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return httpCacheEntry{}, false
+	}
+
+	var entry httpCacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		log.Printf("[WARN] Ignoring corrupted HTTP cache entry %s: %v", key, err)
+		return httpCacheEntry{}, false
+	}
+	return entry, FileExists(c.bodyPath(key))
+}
+
+func (c *HTTPCache) saveEntry(key string, entry httpCacheEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal HTTP cache entry: %w", err)
+	}
+
+	tmp := c.entryPath(key) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("failed to write HTTP cache entry: %w", err)
+	}
+	return os.Rename(tmp, c.entryPath(key))
+}
+
+func (c *HTTPCache) cachedResponse(req *http.Request, key string, entry httpCacheEntry, result string) (*http.Response, error) {
+	body, err := os.Open(c.bodyPath(key))
+	if err != nil {
+		return nil, err
+	}
+	info, err := body.Stat()
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	header := entry.Header.Clone()
+	header.Set("X-Cache", result)
+	log.Printf("[DEBUG] HTTP cache %s for %s", result, RedactURL(req.URL.String()))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: info.Size(),
+		Request:       req,
+	}, nil
+}
+
+// storingBody wraps resp.Body so the body is written to the cache as it is
+// read, and committed only once it has been read to the end.
+func (c *HTTPCache) storingBody(key string, req *http.Request, resp *http.Response) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachingBody{
+		ReadCloser: resp.Body,
+		tmp:        tmp,
+		commit: func() error {
+			if err := os.Rename(tmp.Name(), c.bodyPath(key)); err != nil {
+				return err
+			}
+			return c.saveEntry(key, httpCacheEntry{
+				URL:          RedactURL(req.URL.String(), c.config.Secrets...),
+				Status:       resp.StatusCode,
+				Header:       resp.Header.Clone(),
+				StoredAt:     time.Now().UTC(),
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+			})
+		},
+	}, nil
+}
+
+type cachingBody struct {
+	io.ReadCloser
+	tmp    *os.File
+	commit func() error
+	failed bool
+	done   bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.failed {
+		if _, writeErr := b.tmp.Write(p[:n]); writeErr != nil {
+			b.failed = true
+		}
+	}
+	if err == io.EOF && !b.failed && !b.done {
+		b.done = true
+		if closeErr := b.tmp.Close(); closeErr != nil {
+			b.failed = true
+		} else if commitErr := b.commit(); commitErr != nil {
+			log.Printf("[WARN] Failed to store HTTP cache entry: %v", commitErr)
+		}
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	if !b.done {
+		b.tmp.Close()
+	}
+	os.Remove(b.tmp.Name())
+	return b.ReadCloser.Close()
+}
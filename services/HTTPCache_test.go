@@ -0,0 +1,124 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func cachedGet(t *testing.T, cache *HTTPCache, url string) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := cache.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp.Header.Get("X-Cache")
+}
+
+func TestHTTPCacheRedactsStoredURLs(t *testing.T) {
+	const apiKey = "0123456789abcdef-secret"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache, err := NewHTTPCache(dir, nil, HTTPCacheConfig{Secrets: []string{apiKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedGet(t, cache, server.URL+"/data/"+apiKey+"/json.txt")
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("nothing cached: %v", err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), apiKey) {
+			t.Errorf("%s contains the API key", filepath.Base(entry))
+		}
+	}
+}
+
+// etagServer serves body with a fixed ETag, answering If-None-Match with 304,
+// and counts the requests reaching it.
+func etagServer(t *testing.T, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestHTTPCacheRevalidates(t *testing.T) {
+	server, requests := etagServer(t, "payload")
+	cache, err := NewHTTPCache(t.TempDir(), nil, HTTPCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, result := cachedGet(t, cache, server.URL); body != "payload" || result != "MISS" {
+		t.Errorf("first GET = %q, %s", body, result)
+	}
+	if body, result := cachedGet(t, cache, server.URL); body != "payload" || result != "REVALIDATED" {
+		t.Errorf("second GET = %q, %s, want the stored body after a 304", body, result)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("server got %d requests, want 2", requests.Load())
+	}
+}
+
+func TestHTTPCacheHitWithinMaxAge(t *testing.T) {
+	server, requests := etagServer(t, "payload")
+	cache, err := NewHTTPCache(t.TempDir(), nil, HTTPCacheConfig{DefaultMaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedGet(t, cache, server.URL)
+	if body, result := cachedGet(t, cache, server.URL); body != "payload" || result != "HIT" {
+		t.Errorf("second GET = %q, %s", body, result)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("server got %d requests, want 1", requests.Load())
+	}
+
+	// Range requests are never answered from the cache.
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Range", "bytes=2-")
+	resp, err := cache.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests.Load() != 2 || resp.Header.Get("X-Cache") != "" {
+		t.Errorf("Range request answered with X-Cache %q", resp.Header.Get("X-Cache"))
+	}
+}
@@ -2,67 +2,408 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func GetRequestBody(url string) (string, error) {
-	resp, err := http.Get(url)
+const (
+	defaultHTTPTimeout      = 60 * time.Second
+	defaultHTTPMaxAttempts  = 3
+	defaultHTTPRetryDelay   = 500 * time.Millisecond
+	defaultHTTPMaxBodyBytes = 100 << 20
+	defaultHTTPUserAgent    = "bifrost-agent/1.0"
+
+	// httpErrorExcerptBytes is how much of an error response body is kept in
+	// HTTPError messages.
+	httpErrorExcerptBytes = 512
+	maxRetryAfter         = 30 * time.Second
+)
+
+// ErrResponseTooLarge is returned when a response body exceeds the client's
+// size cap.
+var ErrResponseTooLarge = errors.New("response body exceeds size limit")
+
+// HTTPError describes a failed HTTP call. StatusCode is 0 when no response
+// was received (Err then holds the transport error). URL and Body have known
+// secrets and secret-looking query parameters redacted.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	switch {
+	case e.StatusCode == 0:
+		return fmt.Sprintf("%s %s failed: %v", e.Method, e.URL, e.Err)
+	case e.Err != nil:
+		return fmt.Sprintf("%s %s: %s: %v", e.Method, e.URL, e.Status, e.Err)
+	case e.Body != "":
+		return fmt.Sprintf("%s %s: unexpected status %s: %s", e.Method, e.URL, e.Status, e.Body)
+	default:
+		return fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, e.Status)
+	}
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// AsHTTPError reports whether err wraps an *HTTPError and returns it.
+func AsHTTPError(err error) (*HTTPError, bool) {
+	var httpErr *HTTPError
+	ok := errors.As(err, &httpErr)
+	return httpErr, ok
+}
+
+// HTTPClientConfig configures an HTTPClient. Zero values select the defaults.
+type HTTPClientConfig struct {
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	MaxBodyBytes int64
+	UserAgent    string
+	Transport    http.RoundTripper
+	// Secrets are redacted from URLs and bodies in HTTPError.
+	Secrets []string
+}
+
+// HTTPClient is the shared client for plain HTTP calls. It applies a timeout,
+// sets a User-Agent, caps response sizes and retries idempotent requests
+// (GET, HEAD, OPTIONS) on transport errors, 429 and 5xx responses.
+type HTTPClient struct {
+	client       *http.Client
+	maxAttempts  int
+	retryDelay   time.Duration
+	maxBodyBytes int64
+	userAgent    string
+	secrets      []string
+}
+
+func NewHTTPClient(config HTTPClientConfig) (*HTTPClient, error) {
+	if config.Timeout < 0 || config.MaxAttempts < 0 || config.RetryDelay < 0 || config.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("HTTP client limits must not be negative")
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = defaultHTTPMaxAttempts
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = defaultHTTPRetryDelay
+	}
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = defaultHTTPMaxBodyBytes
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaultHTTPUserAgent
+	}
 
-	errorMessage := fmt.Errorf("could not get content")
+	return &HTTPClient{
+		client:       &http.Client{Timeout: config.Timeout, Transport: config.Transport},
+		maxAttempts:  config.MaxAttempts,
+		retryDelay:   config.RetryDelay,
+		maxBodyBytes: config.MaxBodyBytes,
+		userAgent:    config.UserAgent,
+		secrets:      config.Secrets,
+	}, nil
+}
+
+var (
+	defaultHTTPClientMu sync.RWMutex
+	defaultHTTPClient   *HTTPClient
+)
+
+func init() {
+	defaultHTTPClient, _ = NewHTTPClient(HTTPClientConfig{})
+}
+
+// DefaultHTTPClient returns the client used by the package-level helpers.
+func DefaultHTTPClient() *HTTPClient {
+	defaultHTTPClientMu.RLock()
+	defer defaultHTTPClientMu.RUnlock()
+	return defaultHTTPClient
+}
+
+// SetDefaultHTTPClient replaces the client used by the package-level helpers.
+func SetDefaultHTTPClient(client *HTTPClient) {
+	defaultHTTPClientMu.Lock()
+	defer defaultHTTPClientMu.Unlock()
+	defaultHTTPClient = client
+}
+
+// Do sends req, retrying idempotent requests, and returns the response with
+// its body capped at the size limit. Non-2xx responses are returned as an
+// *HTTPError after their body has been read and closed.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
 	if err != nil {
-		return "", errorMessage
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	if !successful(resp) {
+		defer resp.Body.Close()
+		body, readErr := io.ReadAll(resp.Body)
+		return nil, c.statusError(req, resp, body, readErr)
+	}
+	return resp, nil
+}
+
+// send performs the request with retries and returns the final response,
+// whatever its status. Only transport failures are returned as errors.
+func (c *HTTPClient) send(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	attempts := 1
+	if isIdempotent(req.Method) {
+		attempts = c.maxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.client.Do(req)
+		if attempt >= attempts || !retryable(resp, err) {
+			if err != nil {
+				return nil, c.transportError(req, err)
+			}
+			resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.maxBodyBytes}
+			return resp, nil
+		}
+
+		var failure error
+		if err != nil {
+			failure = c.transportError(req, err)
+		} else {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, httpErrorExcerptBytes))
+			resp.Body.Close()
+			failure = c.statusError(req, resp, body, nil)
+		}
+
+		delay := c.retryDelay << (attempt - 1)
+		if after := retryAfter(resp); after > 0 {
+			delay = after
+		}
+		log.Printf("[WARN] %v (attempt %d/%d), retrying in %s", failure, attempt, attempts, delay)
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, c.transportError(req, err)
+		}
+	}
+}
+
+func (c *HTTPClient) transportError(req *http.Request, err error) *HTTPError {
+	// url.Error repeats the full URL, which may contain a key.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return &HTTPError{
+		Method: req.Method,
+		URL:    RedactURL(req.URL.String(), c.secrets...),
+		Err:    err,
+	}
+}
+
+func (c *HTTPClient) statusError(req *http.Request, resp *http.Response, body []byte, err error) *HTTPError {
+	return &HTTPError{
+		Method:     req.Method,
+		URL:        RedactURL(req.URL.String(), c.secrets...),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       RedactString(excerpt(string(body), httpErrorExcerptBytes), c.secrets...),
+		Err:        err,
+	}
+}
+
+// Get returns the body of rawURL.
+func (c *HTTPClient) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
-		return "", errorMessage
+		return nil, fmt.Errorf("invalid URL %s", RedactURL(rawURL, c.secrets...))
 	}
+	return c.readBody(req)
+}
 
-	return string(body), nil
+// PostJSON posts body as JSON and returns the response body. A rejected
+// request returns its body alongside the *HTTPError, since APIs such as
+// Centrala explain the rejection in it.
+func (c *HTTPClient) PostJSON(ctx context.Context, rawURL string, body interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s", RedactURL(rawURL, c.secrets...))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.readBody(req)
 }
 
-func PostForm(url string, values url.Values) (string, error) {
-	resp, err := http.PostForm(url, values)
+// PostForm posts values as a form and returns the response body, like PostJSON.
+func (c *HTTPClient) PostForm(ctx context.Context, rawURL string, values url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s", RedactURL(rawURL, c.secrets...))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.readBody(req)
+}
 
+func (c *HTTPClient) readBody(req *http.Request) ([]byte, error) {
+	resp, err := c.send(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send form data")
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read the response from the server")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || !successful(resp) {
+		return body, c.statusError(req, resp, body, err)
 	}
+	return body, nil
+}
 
-	return string(responseBody), nil
+func successful(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
 }
 
-func PostJSON(url string, body interface{}) (string, error) {
-	errorMessage := fmt.Errorf("could not get content")
-	println("Preinner: ", fmt.Sprintf("%v", body))
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
 
-	jsonData, err := json.Marshal(body)
+func retryable(resp *http.Response, err error) bool {
 	if err != nil {
-		return "", errorMessage
+		// A cancelled or expired context will fail again.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
 	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
 
-	println("Inner: ", string(jsonData))
+// retryAfter returns the delay requested by a Retry-After header in seconds,
+// capped at maxRetryAfter.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedBody fails with ErrResponseTooLarge once more than remaining bytes
+// have been read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
+
+func excerpt(s string, limit int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "") + "..."
+}
+
+// RedactURL hides the given secrets and the values of secret-looking query
+// parameters (apikey, token...) in rawURL.
+func RedactURL(rawURL string, secrets ...string) string {
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
-		return "", errorMessage
+		return RedactString(rawURL, secrets...)
 	}
-	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
+	if parsed.User != nil {
+		parsed.User = url.User(parsed.User.Username())
+	}
+
+	query := parsed.Query()
+	redacted := false
+	for key := range query {
+		if secretKeyPattern.MatchString(key) {
+			query.Set(key, redactedValue)
+			redacted = true
+		}
+	}
+	if redacted {
+		parsed.RawQuery = query.Encode()
+	}
+
+	return RedactString(parsed.String(), secrets...)
+}
+
+// GetRequestBody returns the body of url, using the default HTTP client.
+func GetRequestBody(url string) (string, error) {
+	body, err := DefaultHTTPClient().Get(context.Background(), url)
 	if err != nil {
-		return "", errorMessage
+		return "", err
 	}
+	return string(body), nil
+}
+
+// PostForm posts values to url as a form, using the default HTTP client.
+// Rejected requests return their body alongside the *HTTPError.
+func PostForm(url string, values url.Values) (string, error) {
+	body, err := DefaultHTTPClient().PostForm(context.Background(), url, values)
+	return string(body), err
+}
 
-	return string(responseBody), nil
+// PostJSON posts body to url as JSON, using the default HTTP client.
+// Rejected requests return their body alongside the *HTTPError.
+func PostJSON(url string, body interface{}) (string, error) {
+	response, err := DefaultHTTPClient().PostJSON(context.Background(), url, body)
+	return string(response), err
 }
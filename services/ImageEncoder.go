@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// Vision models work on 512px tiles; low detail always costs a single tile.
+	visionTileSize       = 512
+	visionTileTokens     = 170
+	visionBaseTokens     = 85
+	visionLowDetailSide  = 512
+	visionHighDetailSide = 2048
+	visionShortSide      = 768
+	visionJPEGQuality    = 85
+)
+
+// EncodedImage is an image prepared for a vision request.
+type EncodedImage struct {
+	MIMEType string
+	Width    int
+	Height   int
+	Tokens   int
+	Data     []byte
+}
+
+// DataURL returns the image as a base64 data URL accepted by the chat API.
+func (e EncodedImage) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", e.MIMEType, base64.StdEncoding.EncodeToString(e.Data))
+}
+
+// EstimateImageTokens returns the number of prompt tokens an image of the given
+// size costs at the given detail level, after the API's own rescaling.
+func EstimateImageTokens(width, height int, detail openai.ImageURLDetail) int {
+	if detail == openai.ImageURLDetailLow {
+		return visionBaseTokens
+	}
+
+	width, height = fitWithin(width, height, visionHighDetailSide, visionHighDetailSide)
+	if short := min(width, height); short > visionShortSide {
+		width = width * visionShortSide / short
+		height = height * visionShortSide / short
+	}
+
+	tilesX := (width + visionTileSize - 1) / visionTileSize
+	tilesY := (height + visionTileSize - 1) / visionTileSize
+	return visionBaseTokens + visionTileTokens*tilesX*tilesY
+}
+
+// EncodeImageFile reads an image from disk, sniffs its real type and, when it is
+// larger than the detail level (or token budget) can make use of, downscales and
+// recompresses it. maxTokens <= 0 means no budget beyond the detail level.
+func EncodeImageFile(path string, detail openai.ImageURLDetail, maxTokens int) (*EncodedImage, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file %s: %w", path, err)
+	}
+
+	return EncodeImage(content, detail, maxTokens)
+}
+
+// EncodeImage is EncodeImageFile for an in-memory image.
+func EncodeImage(content []byte, detail openai.ImageURLDetail, maxTokens int) (*EncodedImage, error) {
+	mimeType := http.DetectContentType(content)
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+	case "image/webp":
+		// The standard library cannot decode WebP, so it is sent untouched.
+		return &EncodedImage{MIMEType: mimeType, Data: content}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image type %q", mimeType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+
+	width, height := targetImageSize(config.Width, config.Height, detail, maxTokens)
+	if width == config.Width && height == config.Height {
+		return &EncodedImage{
+			MIMEType: mimeType,
+			Width:    width,
+			Height:   height,
+			Tokens:   EstimateImageTokens(width, height, detail),
+			Data:     content,
+		}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	resized := downscale(src, width, height)
+
+	var buf bytes.Buffer
+	if isOpaque(resized) {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: visionJPEGQuality})
+	} else {
+		mimeType = "image/png"
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, resized)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resized image: %w", err)
+	}
+
+	return &EncodedImage{
+		MIMEType: mimeType,
+		Width:    width,
+		Height:   height,
+		Tokens:   EstimateImageTokens(width, height, detail),
+		Data:     buf.Bytes(),
+	}, nil
+}
+
+// targetImageSize returns the largest size that keeps the aspect ratio, does not
+// exceed what the API would scale the image to anyway and fits the token budget.
+func targetImageSize(width, height int, detail openai.ImageURLDetail, maxTokens int) (int, int) {
+	if detail == openai.ImageURLDetailLow {
+		return fitWithin(width, height, visionLowDetailSide, visionLowDetailSide)
+	}
+
+	width, height = fitWithin(width, height, visionHighDetailSide, visionHighDetailSide)
+	if short := min(width, height); short > visionShortSide {
+		width, height = max(1, width*visionShortSide/short), max(1, height*visionShortSide/short)
+	}
+
+	if maxTokens <= 0 {
+		return width, height
+	}
+
+	// Shrink in 10% steps until the image fits the budget or a single tile.
+	for EstimateImageTokens(width, height, detail) > maxTokens && max(width, height) > visionTileSize {
+		width, height = max(1, width*9/10), max(1, height*9/10)
+	}
+	return width, height
+}
+
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, height*maxWidth/width)
+	}
+	return max(1, width*maxHeight/height), maxHeight
+}
+
+// downscale resizes src to width x height by averaging every source pixel that
+// falls into each destination pixel, which avoids the aliasing of plain sampling.
+func downscale(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	in := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(in, in.Bounds(), src, bounds.Min, draw.Src)
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := in.Rect.Dx(), in.Rect.Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := in.Pix[sy*in.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			o := out.Pix[y*out.Stride+x*4:]
+			o[0], o[1], o[2], o[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+
+	return out
+}
+
+func isOpaque(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const maxImageEditInputBytes = 4 << 20
+
+// imageModelLimits lists what each image model accepts.
+var imageModelLimits = map[string]struct {
+	sizes     []string
+	qualities []string
+	styles    []string
+	maxN      int
+}{
+	openai.CreateImageModelDallE2: {
+		sizes: []string{openai.CreateImageSize256x256, openai.CreateImageSize512x512, openai.CreateImageSize1024x1024},
+		maxN:  10,
+	},
+	openai.CreateImageModelDallE3: {
+		sizes:     []string{openai.CreateImageSize1024x1024, openai.CreateImageSize1792x1024, openai.CreateImageSize1024x1792},
+		qualities: []string{openai.CreateImageQualityStandard, openai.CreateImageQualityHD},
+		styles:    []string{openai.CreateImageStyleVivid, openai.CreateImageStyleNatural},
+		maxN:      1,
+	},
+}
+
+// ImageGenerationRequest describes a text-to-image call. Empty fields fall back
+// to DALL·E 3, 1024x1024, N=1 and a base64 response.
+type ImageGenerationRequest struct {
+	Prompt         string
+	Model          string
+	Size           string
+	Quality        string
+	Style          string
+	N              int
+	ResponseFormat string
+}
+
+// ImageEditRequest changes an image according to the prompt. Transparent areas
+// of the mask (or of the image itself, without a mask) mark what to change.
+type ImageEditRequest struct {
+	ImagePath string
+	MaskPath  string
+	Prompt    string
+	Size      string
+	N         int
+}
+
+// ImageVariationRequest asks for variations of an existing image.
+type ImageVariationRequest struct {
+	ImagePath string
+	Size      string
+	N         int
+}
+
+// GeneratedImage is a generated image stored locally. URL is the stable bifrost
+// address (empty without a public base URL); SourceURL is the provider's
+// expiring link, when the provider returned one.
+type GeneratedImage struct {
+	Artifact      *Artifact `json:"artifact"`
+	URL           string    `json:"url,omitempty"`
+	SourceURL     string    `json:"sourceUrl,omitempty"`
+	RevisedPrompt string    `json:"revisedPrompt,omitempty"`
+}
+
+type ImageGenerationService struct {
+	client    *openai.Client
+	artifacts *ArtifactStore
+}
+
+func NewImageGenerationService(apiKey string, artifacts *ArtifactStore) (*ImageGenerationService, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not specified - make sure to set environment variable")
+	}
+
+	if artifacts == nil {
+		return nil, fmt.Errorf("artifact store not specified")
+	}
+
+	return &ImageGenerationService{
+		client:    openai.NewClient(apiKey),
+		artifacts: artifacts,
+	}, nil
+}
+
+// HasPublicURL reports whether stored images get a stable bifrost URL.
+func (s *ImageGenerationService) HasPublicURL() bool {
+	return s.artifacts.publicBaseURL != ""
+}
+
+// ValidateImageSize reports whether model can produce images of the given size.
+func ValidateImageSize(model, size string) error {
+	limits, ok := imageModelLimits[model]
+	if !ok {
+		return fmt.Errorf("unsupported image model %q", model)
+	}
+
+	if !slices.Contains(limits.sizes, size) {
+		return fmt.Errorf("size %q is not supported by %s (supported: %v)", size, model, limits.sizes)
+	}
+	return nil
+}
+
+func (r *ImageGenerationRequest) normalize() error {
+	if r.Prompt == "" {
+		return fmt.Errorf("image prompt not specified")
+	}
+
+	if r.Model == "" {
+		r.Model = openai.CreateImageModelDallE3
+	}
+	if r.Size == "" {
+		r.Size = openai.CreateImageSize1024x1024
+	}
+	if r.N == 0 {
+		r.N = 1
+	}
+	if r.ResponseFormat == "" {
+		r.ResponseFormat = openai.CreateImageResponseFormatB64JSON
+	}
+
+	if err := ValidateImageSize(r.Model, r.Size); err != nil {
+		return err
+	}
+
+	limits := imageModelLimits[r.Model]
+	if r.N < 1 || r.N > limits.maxN {
+		return fmt.Errorf("%s can generate between 1 and %d images, got %d", r.Model, limits.maxN, r.N)
+	}
+	if r.Quality != "" && !slices.Contains(limits.qualities, r.Quality) {
+		return fmt.Errorf("quality %q is not supported by %s", r.Quality, r.Model)
+	}
+	if r.Style != "" && !slices.Contains(limits.styles, r.Style) {
+		return fmt.Errorf("style %q is not supported by %s", r.Style, r.Model)
+	}
+
+	return validateResponseFormat(r.ResponseFormat)
+}
+
+func validateResponseFormat(format string) error {
+	switch format {
+	case openai.CreateImageResponseFormatURL, openai.CreateImageResponseFormatB64JSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported image response format %q", format)
+	}
+}
+
+func (s *ImageGenerationService) Generate(ctx context.Context, req ImageGenerationRequest) ([]GeneratedImage, error) {
+	if err := req.normalize(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Generating image - Model: %s, Size: %s, Quality: %s, Style: %s, N: %d",
+		req.Model, req.Size, req.Quality, req.Style, req.N)
+
+	resp, err := s.client.CreateImage(ctx, openai.ImageRequest{
+		Prompt:         req.Prompt,
+		Model:          req.Model,
+		Size:           req.Size,
+		Quality:        req.Quality,
+		Style:          req.Style,
+		N:              req.N,
+		ResponseFormat: req.ResponseFormat,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate image: %w", err)
+	}
+
+	return s.store(ctx, resp)
+}
+
+// Edit changes an image according to the prompt. Only DALL·E 2 supports edits;
+// the image (and mask) must be square PNGs under 4 MB.
+func (s *ImageGenerationService) Edit(ctx context.Context, req ImageEditRequest) ([]GeneratedImage, error) {
+	if req.Prompt == "" {
+		return nil, fmt.Errorf("image prompt not specified")
+	}
+
+	size, n, err := editParams(req.Size, req.N)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := openEditInput(req.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	var mask *os.File
+	if req.MaskPath != "" {
+		if mask, err = openEditInput(req.MaskPath); err != nil {
+			return nil, err
+		}
+		defer mask.Close()
+	}
+
+	log.Printf("[INFO] Editing image %s - Size: %s, N: %d", req.ImagePath, size, n)
+	resp, err := s.client.CreateEditImage(ctx, openai.ImageEditRequest{
+		Image:          img,
+		Mask:           mask,
+		Prompt:         req.Prompt,
+		Model:          openai.CreateImageModelDallE2,
+		N:              n,
+		Size:           size,
+		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit image: %w", err)
+	}
+
+	return s.store(ctx, resp)
+}
+
+// Variation produces variations of an image. Only DALL·E 2 supports variations.
+func (s *ImageGenerationService) Variation(ctx context.Context, req ImageVariationRequest) ([]GeneratedImage, error) {
+	size, n, err := editParams(req.Size, req.N)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := openEditInput(req.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	log.Printf("[INFO] Creating image variations of %s - Size: %s, N: %d", req.ImagePath, size, n)
+	resp, err := s.client.CreateVariImage(ctx, openai.ImageVariRequest{
+		Image:          img,
+		Model:          openai.CreateImageModelDallE2,
+		N:              n,
+		Size:           size,
+		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image variation: %w", err)
+	}
+
+	return s.store(ctx, resp)
+}
+
+func editParams(size string, n int) (string, int, error) {
+	if size == "" {
+		size = openai.CreateImageSize1024x1024
+	}
+	if n == 0 {
+		n = 1
+	}
+
+	model := openai.CreateImageModelDallE2
+	if err := ValidateImageSize(model, size); err != nil {
+		return "", 0, err
+	}
+	if limit := imageModelLimits[model].maxN; n < 1 || n > limit {
+		return "", 0, fmt.Errorf("%s can generate between 1 and %d images, got %d", model, limit, n)
+	}
+	return size, n, nil
+}
+
+// openEditInput opens an image for the edit endpoints after checking the
+// constraints the API would otherwise reject it for.
+func openEditInput(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat image %s: %w", path, err)
+	}
+	if info.Size() > maxImageEditInputBytes {
+		file.Close()
+		return nil, fmt.Errorf("image %s is %d bytes, edits accept at most %d", path, info.Size(), maxImageEditInputBytes)
+	}
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil || format != "png" {
+		file.Close()
+		return nil, fmt.Errorf("image %s must be a PNG", path)
+	}
+	if config.Width != config.Height {
+		file.Close()
+		return nil, fmt.Errorf("image %s must be square, got %dx%d", path, config.Width, config.Height)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to rewind image %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// store saves every returned image in the artifact store, downloading it first
+// when the provider answered with a URL.
+func (s *ImageGenerationService) store(ctx context.Context, resp openai.ImageResponse) ([]GeneratedImage, error) {
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no image data received from DALL-E")
+	}
+
+	images := make([]GeneratedImage, 0, len(resp.Data))
+	for _, item := range resp.Data {
+		var data []byte
+		var err error
+		if item.B64JSON != "" {
+			data, err = base64.StdEncoding.DecodeString(item.B64JSON)
+		} else {
+			data, err = fetchImage(ctx, item.URL)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generated image: %w", err)
+		}
+
+		artifact, err := s.artifacts.Put(data, "")
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, GeneratedImage{
+			Artifact:      artifact,
+			URL:           s.artifacts.URL(artifact),
+			SourceURL:     item.URL,
+			RevisedPrompt: item.RevisedPrompt,
+		})
+	}
+
+	return images, nil
+}
+
+func fetchImage(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := DefaultHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
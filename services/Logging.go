@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// legacyLogPattern splits a std log line written with log.Lshortfile into its
+// source, "[LEVEL]" tag and message.
+var legacyLogPattern = regexp.MustCompile(`^(?s)(?:(\S+\.go:\d+): )?(?:\[([A-Z]+)\] ?)?(.*)$`)
+
+// LogConfig configures the process logger.
+type LogConfig struct {
+	// Level is the minimum level written: "debug", "info", "warn" or "error".
+	Level string
+	// Format is "text" (the default) or "json".
+	Format string
+	// Secrets are replaced wherever they appear in messages and attributes.
+	Secrets []string
+	// PIIPatterns are regular expressions whose matches are replaced too.
+	PIIPatterns []string
+}
+
+// NewLogger builds a slog logger writing to w. Every record passes through a
+// redaction layer that masks the configured secrets and PII patterns, and the
+// values of secret-looking attributes (apikey, password, token...).
+func NewLogger(w io.Writer, config LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", config.Level)
+		}
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(config.PIIPatterns))
+	for _, pattern := range config.PIIPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch config.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", config.Format)
+	}
+
+	return slog.New(&redactingHandler{
+		next:     handler,
+		secrets:  config.Secrets,
+		patterns: patterns,
+	}), nil
+}
+
+// InstallLogger makes logger the slog default and routes the std log package
+// into it, mapping the "[DEBUG]"/"[INFO]"/"[WARN]"/"[ERROR]" prefixes used
+// across the code base to levels.
+func InstallLogger(logger *slog.Logger) {
+	slog.SetDefault(logger)
+	log.SetFlags(log.Lshortfile)
+	log.SetOutput(&legacyLogWriter{logger: logger})
+}
+
+type redactingHandler struct {
+	next     slog.Handler
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted), secrets: h.secrets, patterns: h.patterns}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), secrets: h.secrets, patterns: h.patterns}
+}
+
+func (h *redactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if secretKeyPattern.MatchString(attr.Key) {
+		return slog.String(attr.Key, redactedValue)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = h.redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, h.redact(err.Error()))
+		}
+		return slog.Any(attr.Key, RedactValue(value.Any(), h.secrets...))
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
+
+func (h *redactingHandler) redact(s string) string {
+	s = RedactString(s, h.secrets...)
+	for _, pattern := range h.patterns {
+		s = pattern.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// LogOutput writes message, tagged with "[DEBUG]", "[INFO]", "[WARN]" or
+// "[ERROR]" like the std log lines, to logger at the matching level. Like
+// log.Output, calldepth counts the frames to skip for the source location,
+// 1 being the caller of LogOutput. Request handlers use it to log through
+// their run's logger.
+func LogOutput(logger *slog.Logger, calldepth int, message string) {
+	source := ""
+	if _, file, line, ok := runtime.Caller(calldepth); ok {
+		source = fmt.Sprintf("%s:%d: ", filepath.Base(file), line)
+	}
+	logLegacyLine(logger, source+message)
+}
+
+// legacyLogWriter turns std log lines into slog records.
+type legacyLogWriter struct {
+	logger *slog.Logger
+}
+
+func (w *legacyLogWriter) Write(p []byte) (int, error) {
+	logLegacyLine(w.logger, string(bytes.TrimRight(p, "\n")))
+	return len(p), nil
+}
+
+func logLegacyLine(logger *slog.Logger, line string) {
+	parts := legacyLogPattern.FindStringSubmatch(line)
+
+	level := slog.LevelInfo
+	switch parts[2] {
+	case "DEBUG":
+		level = slog.LevelDebug
+	case "WARN", "WARNING":
+		level = slog.LevelWarn
+	case "ERROR", "FATAL":
+		level = slog.LevelError
+	}
+
+	var attrs []slog.Attr
+	if parts[1] != "" {
+		attrs = append(attrs, slog.String("source", parts[1]))
+	}
+	logger.LogAttrs(context.Background(), level, strings.TrimSpace(parts[3]), attrs...)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogOutputKeepsLoggerAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogConfig{Format: "json", Level: "debug", Secrets: []string{"sekret-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	LogOutput(logger.With("run_id", "run-1"), 1, "[WARN] Download of sekret-key failed")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid record %q: %v", buf.String(), err)
+	}
+	if record["level"] != "WARN" || record["run_id"] != "run-1" || record["msg"] != "Download of [REDACTED] failed" {
+		t.Errorf("record = %v", record)
+	}
+	if source, _ := record["source"].(string); !strings.HasPrefix(source, "Logging_test.go:") {
+		t.Errorf("source = %q, want the caller of LogOutput", source)
+	}
+}
@@ -0,0 +1,765 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Office document types, as detected by mimetype.
+const (
+	DOCXMIMEType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	XLSXMIMEType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	ODTMIMEType  = "application/vnd.oasis.opendocument.text"
+)
+
+// maxOfficePartBytes bounds each XML part read from an office document, so a
+// small but highly compressed file cannot exhaust memory.
+const maxOfficePartBytes = 64 << 20
+
+// ErrOfficePartMissing is returned when a document lacks a required part,
+// e.g. word/document.xml.
+var ErrOfficePartMissing = errors.New("office document part not found")
+
+// ReadDOCX returns the text of a Word document: headings prefixed with "#"
+// by level, list items with "- ", paragraphs separated by blank lines and
+// table rows as cells joined by " | ".
+func ReadDOCX(filePath string) (string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX: %w", err)
+	}
+	defer reader.Close()
+
+	headings := make(map[string]int)
+	if styles, err := readOfficePart(&reader.Reader, "word/styles.xml"); err == nil {
+		headings = docxHeadingStyles(styles)
+	}
+
+	document, err := readOfficePart(&reader.Reader, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	writer := &officeWriter{}
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	var inText bool
+	var styles []string
+	var outlines []int
+	var lists []bool
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse DOCX: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "Fallback", "delText", "instrText":
+				// Alternate renderings and deleted or field code text would
+				// repeat or add to the visible text.
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse DOCX: %w", err)
+				}
+			case "p":
+				writer.startParagraph()
+				styles, outlines, lists = append(styles, ""), append(outlines, 0), append(lists, false)
+			case "pStyle":
+				if len(styles) > 0 {
+					styles[len(styles)-1] = officeAttr(token, "val")
+				}
+			case "outlineLvl":
+				if level, err := strconv.Atoi(officeAttr(token, "val")); err == nil && len(outlines) > 0 && level < 9 {
+					outlines[len(outlines)-1] = level + 1
+				}
+			case "numPr":
+				if len(lists) > 0 {
+					lists[len(lists)-1] = true
+				}
+			case "t":
+				inText = true
+			case "tab":
+				writer.write("\t")
+			case "br", "cr":
+				writer.write("\n")
+			case "tbl":
+				writer.startTable()
+			case "tr":
+				writer.startRow()
+			case "tc":
+				writer.startCell()
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if len(styles) == 0 {
+					continue
+				}
+				n := len(styles) - 1
+				level := headings[styles[n]]
+				if outlines[n] > 0 {
+					level = outlines[n]
+				}
+				writer.endParagraph(level, lists[n])
+				styles, outlines, lists = styles[:n], outlines[:n], lists[:n]
+			case "tc":
+				writer.endCell(1)
+			case "tr":
+				writer.endRow()
+			case "tbl":
+				writer.endTable()
+			}
+		case xml.CharData:
+			if inText {
+				writer.write(string(token))
+			}
+		}
+	}
+	return writer.String(), nil
+}
+
+var docxHeadingName = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// docxHeadingStyles maps style IDs to heading levels. Style IDs are localised
+// ("Nagwek1") but built-in style names are not ("heading 1").
+func docxHeadingStyles(styles []byte) map[string]int {
+	headings := make(map[string]int)
+	decoder := xml.NewDecoder(bytes.NewReader(styles))
+	var styleID string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return headings
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "style":
+			styleID = officeAttr(start, "styleId")
+		case "name":
+			name := officeAttr(start, "val")
+			if match := docxHeadingName.FindStringSubmatch(name); match != nil {
+				headings[styleID], _ = strconv.Atoi(match[1])
+			} else if strings.EqualFold(name, "Title") {
+				headings[styleID] = 1
+			}
+		case "outlineLvl":
+			if level, err := strconv.Atoi(officeAttr(start, "val")); err == nil && level < 9 && styleID != "" {
+				headings[styleID] = level + 1
+			}
+		}
+	}
+}
+
+// ReadODT returns the text of an OpenDocument text file in the same layout
+// as ReadDOCX.
+func ReadODT(filePath string) (string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open ODT: %w", err)
+	}
+	defer reader.Close()
+
+	content, err := readOfficePart(&reader.Reader, "content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	writer := &officeWriter{}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	var levels []int
+	var repeats []int
+	listItems := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse ODT: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "tracked-changes", "annotation", "note-citation":
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse ODT: %w", err)
+				}
+			case "h":
+				level, err := strconv.Atoi(officeAttr(token, "outline-level"))
+				if err != nil || level < 1 {
+					level = 1
+				}
+				writer.startParagraph()
+				levels = append(levels, level)
+			case "p":
+				writer.startParagraph()
+				levels = append(levels, 0)
+			case "list-item":
+				listItems++
+			case "s":
+				count, err := strconv.Atoi(officeAttr(token, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				writer.write(strings.Repeat(" ", min(count, 100)))
+			case "tab":
+				writer.write("\t")
+			case "line-break":
+				writer.write("\n")
+			case "table":
+				writer.startTable()
+			case "table-row":
+				writer.startRow()
+			case "table-cell", "covered-table-cell":
+				repeat, err := strconv.Atoi(officeAttr(token, "number-columns-repeated"))
+				if err != nil || repeat < 1 {
+					repeat = 1
+				}
+				writer.startCell()
+				repeats = append(repeats, repeat)
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "h", "p":
+				if len(levels) == 0 {
+					continue
+				}
+				writer.endParagraph(levels[len(levels)-1], listItems > 0)
+				levels = levels[:len(levels)-1]
+			case "list-item":
+				listItems--
+			case "table-cell", "covered-table-cell":
+				if len(repeats) == 0 {
+					continue
+				}
+				writer.endCell(repeats[len(repeats)-1])
+				repeats = repeats[:len(repeats)-1]
+			case "table-row":
+				writer.endRow()
+			case "table":
+				writer.endTable()
+			}
+		case xml.CharData:
+			writer.write(string(token))
+		}
+	}
+	return writer.String(), nil
+}
+
+// Spreadsheet is the cell text of a workbook, sheet by sheet.
+type Spreadsheet struct {
+	Sheets []Sheet `json:"sheets"`
+}
+
+// Sheet holds the non-empty rows of a worksheet. Rows keep their cells'
+// columns, with empty strings for blank cells.
+type Sheet struct {
+	Name string     `json:"name"`
+	Rows [][]string `json:"rows"`
+}
+
+// Text returns every sheet as CSV under a "## Sheet: <name>" heading.
+func (s *Spreadsheet) Text() string {
+	var text strings.Builder
+	for i, sheet := range s.Sheets {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+		fmt.Fprintf(&text, "## Sheet: %s\n", sheet.Name)
+		writer := csv.NewWriter(&text)
+		writer.WriteAll(sheet.Rows)
+	}
+	return text.String()
+}
+
+// ReadXLSX returns the cell values of every sheet of an Excel workbook, in
+// workbook order. Shared strings are resolved and date-formatted numbers are
+// written as ISO dates; formulas are represented by their cached values.
+func ReadXLSX(filePath string) (*Spreadsheet, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX: %w", err)
+	}
+	defer reader.Close()
+
+	workbook, err := readOfficePart(&reader.Reader, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	relationships, err := readOfficePart(&reader.Reader, "xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings []string
+	if part, err := readOfficePart(&reader.Reader, "xl/sharedStrings.xml"); err == nil {
+		if sharedStrings, err = xlsxSharedStrings(part); err != nil {
+			return nil, err
+		}
+	}
+
+	var dateStyles map[int]string
+	if part, err := readOfficePart(&reader.Reader, "xl/styles.xml"); err == nil {
+		dateStyles = xlsxDateStyles(part)
+	}
+
+	var book struct {
+		Properties struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbook, &book); err != nil {
+		return nil, fmt.Errorf("failed to parse XLSX workbook: %w", err)
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(relationships, &rels); err != nil {
+		return nil, fmt.Errorf("failed to parse XLSX relationships: %w", err)
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if book.Properties.Date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	spreadsheet := &Spreadsheet{}
+	for _, entry := range book.Sheets {
+		target, ok := targets[entry.ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: sheet %s", ErrOfficePartMissing, entry.Name)
+		}
+		part, err := readOfficePart(&reader.Reader, target)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := xlsxRows(part, sharedStrings, dateStyles, epoch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s: %w", entry.Name, err)
+		}
+		spreadsheet.Sheets = append(spreadsheet.Sheets, Sheet{Name: entry.Name, Rows: rows})
+	}
+	return spreadsheet, nil
+}
+
+func xlsxSharedStrings(part []byte) ([]string, error) {
+	var strs []string
+	var current strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(bytes.NewReader(part))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XLSX shared strings: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "rPh":
+				// Phonetic guides repeat the text in another script.
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to parse XLSX shared strings: %w", err)
+				}
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(token)
+			}
+		}
+	}
+}
+
+// Date formats are told from numeric ones by their date and time codes,
+// ignoring quoted literals and [colour] blocks. "m" next to "h" or "s" means
+// minutes.
+var (
+	xlsxFormatLiterals = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+	xlsxDateCodes      = regexp.MustCompile(`[dmyhs]`)
+	xlsxMinuteCodes    = regexp.MustCompile(`h+[^dmy]*?m+|m+[^dmy]*?s`)
+	xlsxDayCodes       = regexp.MustCompile(`[dmy]`)
+)
+
+// xlsxDateStyles maps cell style indexes with date or time formats to the
+// Go layout their values are written with.
+func xlsxDateStyles(part []byte) map[int]string {
+	var styles struct {
+		Formats []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellFormats []struct {
+			FormatID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := xml.Unmarshal(part, &styles); err != nil {
+		return nil
+	}
+
+	layouts := make(map[int]string)
+	for id := 14; id <= 17; id++ {
+		layouts[id] = "2006-01-02"
+	}
+	layouts[22] = "2006-01-02 15:04:05"
+	for _, id := range []int{18, 19, 20, 21, 45, 46, 47} {
+		layouts[id] = "15:04:05"
+	}
+	for _, format := range styles.Formats {
+		code := strings.ToLower(xlsxFormatLiterals.ReplaceAllString(format.Code, ""))
+		switch {
+		case !xlsxDateCodes.MatchString(code):
+			delete(layouts, format.ID)
+		case !xlsxDayCodes.MatchString(xlsxMinuteCodes.ReplaceAllString(code, "")):
+			layouts[format.ID] = "15:04:05"
+		case strings.ContainsAny(code, "hs"):
+			layouts[format.ID] = "2006-01-02 15:04:05"
+		default:
+			layouts[format.ID] = "2006-01-02"
+		}
+	}
+
+	dateStyles := make(map[int]string)
+	for i, cellFormat := range styles.CellFormats {
+		if layout, ok := layouts[cellFormat.FormatID]; ok {
+			dateStyles[i] = layout
+		}
+	}
+	return dateStyles
+}
+
+// xlsxMaxColumns is Excel's column limit (XFD), so references have at most
+// three letters.
+const xlsxMaxColumns = 16384
+
+var xlsxCellReference = regexp.MustCompile(`^([A-Z]{1,3})(\d+)$`)
+
+// xlsxMaxCells bounds the cells, padding included, kept from one worksheet:
+// a small part can still place one value per row in the last column.
+const xlsxMaxCells = 1 << 20
+
+// xlsxRows reads the cell values of a worksheet, placing each cell in its
+// referenced column and dropping empty rows and trailing empty cells.
+func xlsxRows(part []byte, sharedStrings []string, dateStyles map[int]string, epoch time.Time) ([][]string, error) {
+	var rows [][]string
+	var row []string
+	var cellType, cellValue string
+	var cellStyle, column, cells int
+	inValue := false
+	decoder := xml.NewDecoder(bytes.NewReader(part))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XLSX sheet: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				cellType, cellValue = officeAttr(token, "t"), ""
+				cellStyle, _ = strconv.Atoi(officeAttr(token, "s"))
+				column = len(row)
+				if match := xlsxCellReference.FindStringSubmatch(officeAttr(token, "r")); match != nil {
+					column = xlsxColumnIndex(match[1])
+				}
+			case "v", "t":
+				inValue = true
+			case "rPh":
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to parse XLSX sheet: %w", err)
+				}
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				value := xlsxCellText(cellType, cellValue, cellStyle, sharedStrings, dateStyles, epoch)
+				if value == "" || column < 0 || column >= xlsxMaxColumns {
+					continue
+				}
+				if cells+column >= xlsxMaxCells {
+					return nil, fmt.Errorf("%w: XLSX sheet has more than %d cells", ErrArchiveLimit, xlsxMaxCells)
+				}
+				for len(row) < column {
+					row = append(row, "")
+				}
+				if column < len(row) {
+					row[column] = value
+				} else {
+					row = append(row, value)
+				}
+			case "row":
+				if len(row) > 0 {
+					rows = append(rows, row)
+					cells += len(row)
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				cellValue += string(token)
+			}
+		}
+	}
+}
+
+func xlsxCellText(cellType, value string, style int, sharedStrings []string, dateStyles map[int]string, epoch time.Time) string {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || index < 0 || index >= len(sharedStrings) {
+			return ""
+		}
+		return sharedStrings[index]
+	case "b":
+		if strings.TrimSpace(value) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "inlineStr", "str", "e":
+		return value
+	}
+
+	layout, isDate := dateStyles[style]
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if !isDate || err != nil || number < 0 || number > 2958465 {
+		return value
+	}
+	days, fraction := math.Modf(number)
+	date := epoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round(fraction*86400)) * time.Second)
+	return date.Format(layout)
+}
+
+// xlsxColumnIndex converts a column name ("A", "AB") to a zero-based index,
+// or -1 past Excel's last column.
+func xlsxColumnIndex(name string) int {
+	index := 0
+	for _, c := range name {
+		if c < 'A' || c > 'Z' {
+			return -1
+		}
+		index = index*26 + int(c-'A'+1)
+		if index > xlsxMaxColumns {
+			return -1
+		}
+	}
+	return index - 1
+}
+
+func readOfficePart(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		part, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer part.Close()
+
+		content, err := io.ReadAll(io.LimitReader(part, maxOfficePartBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if len(content) > maxOfficePartBytes {
+			return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrArchiveLimit, name, maxOfficePartBytes)
+		}
+		return content, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrOfficePartMissing, name)
+}
+
+// officeAttr returns an attribute by local name, ignoring its namespace.
+func officeAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// officeWriter lays out paragraphs and tables as plain text. Paragraphs
+// nested in another one (text boxes, notes) are appended to it, and tables
+// nested in a cell are written into that cell.
+type officeWriter struct {
+	blocks     []string
+	paragraphs []*strings.Builder
+	tables     []*officeTable
+}
+
+type officeTable struct {
+	rows [][]string
+	row  []string
+	cell []string
+}
+
+func (w *officeWriter) startParagraph() {
+	w.paragraphs = append(w.paragraphs, &strings.Builder{})
+}
+
+func (w *officeWriter) write(text string) {
+	if n := len(w.paragraphs); n > 0 {
+		w.paragraphs[n-1].WriteString(text)
+	}
+}
+
+// endParagraph closes a paragraph, as a heading of the given level when
+// level > 0 or as a list item.
+func (w *officeWriter) endParagraph(level int, listItem bool) {
+	n := len(w.paragraphs)
+	if n == 0 {
+		return
+	}
+	text := strings.TrimSpace(w.paragraphs[n-1].String())
+	w.paragraphs = w.paragraphs[:n-1]
+	if text == "" {
+		return
+	}
+
+	switch {
+	case n > 1:
+		w.write(" " + text + " ")
+	case len(w.tables) > 0:
+		table := w.tables[len(w.tables)-1]
+		table.cell = append(table.cell, text)
+	case level > 0:
+		w.blocks = append(w.blocks, strings.Repeat("#", level)+" "+text)
+	case listItem:
+		w.blocks = append(w.blocks, "- "+text)
+	default:
+		w.blocks = append(w.blocks, text)
+	}
+}
+
+func (w *officeWriter) startTable() {
+	w.tables = append(w.tables, &officeTable{})
+}
+
+func (w *officeWriter) startRow() {
+	if n := len(w.tables); n > 0 {
+		w.tables[n-1].row = nil
+	}
+}
+
+func (w *officeWriter) startCell() {
+	if n := len(w.tables); n > 0 {
+		w.tables[n-1].cell = nil
+	}
+}
+
+// endCell adds the cell to its row repeat times; trailing empty cells are
+// trimmed when the row ends.
+func (w *officeWriter) endCell(repeat int) {
+	n := len(w.tables)
+	if n == 0 {
+		return
+	}
+	table := w.tables[n-1]
+	// Keep one line per row.
+	text := strings.Join(strings.Fields(strings.Join(table.cell, " ")), " ")
+	for i := 0; i < min(repeat, 1024); i++ {
+		table.row = append(table.row, text)
+	}
+	table.cell = nil
+}
+
+func (w *officeWriter) endRow() {
+	n := len(w.tables)
+	if n == 0 {
+		return
+	}
+	table := w.tables[n-1]
+	for len(table.row) > 0 && table.row[len(table.row)-1] == "" {
+		table.row = table.row[:len(table.row)-1]
+	}
+	if len(table.row) > 0 {
+		table.rows = append(table.rows, table.row)
+	}
+	table.row = nil
+}
+
+func (w *officeWriter) endTable() {
+	n := len(w.tables)
+	if n == 0 {
+		return
+	}
+	table := w.tables[n-1]
+	w.tables = w.tables[:n-1]
+
+	lines := make([]string, len(table.rows))
+	for i, row := range table.rows {
+		lines[i] = strings.Join(row, " | ")
+	}
+	text := strings.Join(lines, "\n")
+	if text == "" {
+		return
+	}
+
+	if n > 1 {
+		parent := w.tables[n-2]
+		parent.cell = append(parent.cell, text)
+		return
+	}
+	w.blocks = append(w.blocks, text)
+}
+
+func (w *officeWriter) String() string {
+	return strings.Join(w.blocks, "\n\n")
+}
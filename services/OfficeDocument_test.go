@@ -0,0 +1,141 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const wordNamespace = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+
+// writeZipFixture writes entries uncompressed and in order, as office suites
+// do for the parts mimetype sniffs.
+func writeZipFixture(t *testing.T, name string, entries [][2]string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		part, err := writer.CreateHeader(&zip.FileHeader{Name: entry[0], Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(entry[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func xlsxFixture(t *testing.T, sheet string) string {
+	return writeZipFixture(t, "book.xlsx", [][2]string{
+		{"[Content_Types].xml", `<Types/>`},
+		{"xl/workbook.xml", `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Raporty" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`},
+		{"xl/sharedStrings.xml", `<sst><si><t>Data</t></si><si><r><t>Opis, </t></r><r><t>"ważny"</t></r><rPh><t>X</t></rPh></si></sst>`},
+		{"xl/styles.xml", `<styleSheet><numFmts><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="20"/></cellXfs></styleSheet>`},
+		{"xl/worksheets/sheet1.xml", `<worksheet><sheetData>` + sheet + `</sheetData></worksheet>`},
+	})
+}
+
+func TestReadXLSX(t *testing.T) {
+	filePath := xlsxFixture(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>`+
+		`<row r="2"><c r="A2" s="1"><v>45607</v></c><c r="B2" s="2"><v>0.5</v></c><c r="D2" t="b"><v>1</v></c></row>`+
+		`<row r="3"/><row r="4"><c r="B4" t="inlineStr"><is><t>inline</t></is></c></row>`)
+
+	spreadsheet, err := ReadXLSX(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Sheet: Raporty\nData,,\"Opis, \"\"ważny\"\"\"\n2024-11-11,12:00:00,,TRUE\n,inline\n"
+	if got := spreadsheet.Text(); got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXRejectsOutOfRangeColumns(t *testing.T) {
+	filePath := xlsxFixture(t, `<row r="1"><c r="ZZZZZZZZZZZZZZ1"><v>1</v></c><c r="XFE1"><v>2</v></c><c r="B1"><v>3</v></c></row>`)
+
+	spreadsheet, err := ReadXLSX(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range spreadsheet.Sheets[0].Rows {
+		if len(row) > xlsxMaxColumns {
+			t.Fatalf("row has %d columns", len(row))
+		}
+	}
+}
+
+func TestReadXLSXLimitsPaddedCells(t *testing.T) {
+	sheet := strings.Repeat(`<row><c r="XFD1"><v>1</v></c></row>`, xlsxMaxCells/xlsxMaxColumns+1)
+
+	if _, err := ReadXLSX(xlsxFixture(t, sheet)); !errors.Is(err, ErrArchiveLimit) {
+		t.Errorf("ReadXLSX() error = %v, want ErrArchiveLimit", err)
+	}
+}
+
+func TestReadDOCX(t *testing.T) {
+	filePath := writeZipFixture(t, "report.docx", [][2]string{
+		{"[Content_Types].xml", `<Types/>`},
+		{"word/document.xml", `<w:document ` + wordNamespace + `><w:body>` +
+			`<w:p><w:pPr><w:pStyle w:val="Nagwek1"/></w:pPr><w:r><w:t>Raport z sektora C4</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t xml:space="preserve">Zatrzymano </w:t></w:r><w:r><w:t>Adama</w:t></w:r><w:r><w:delText>usunięte</w:delText></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr/></w:pPr><w:r><w:t>punkt listy</w:t></w:r></w:p>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Imię</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Rola</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>Adam</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>programista</w:t><w:br/><w:t>Java</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`</w:body></w:document>`},
+		{"word/styles.xml", `<w:styles ` + wordNamespace + `><w:style w:styleId="Nagwek1"><w:name w:val="heading 1"/></w:style></w:styles>`},
+	})
+
+	extraction, err := NewContentExtractors(nil).Extract(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Raport z sektora C4\n\nZatrzymano Adama\n\n- punkt listy\n\nImię | Rola\nAdam | programista Java"
+	if extraction.Text != want {
+		t.Errorf("Text = %q, want %q", extraction.Text, want)
+	}
+}
+
+func TestReadODT(t *testing.T) {
+	filePath := writeZipFixture(t, "report.odt", [][2]string{
+		{"mimetype", ODTMIMEType},
+		{"content.xml", `<office:document-content xmlns:office="o" xmlns:text="t" xmlns:table="tb"><office:body><office:text>` +
+			`<text:h text:outline-level="2">Nagłówek</text:h><text:p>Ala<text:s text:c="2"/>ma <text:span>kota</text:span></text:p>` +
+			`<text:list><text:list-item><text:p>element</text:p></text:list-item></text:list>` +
+			`<table:table><table:table-row><table:table-cell><text:p>a</text:p></table:table-cell>` +
+			`<table:table-cell table:number-columns-repeated="2"/><table:table-cell><text:p>d</text:p></table:table-cell>` +
+			`<table:table-cell table:number-columns-repeated="1000000"/></table:table-row></table:table>` +
+			`</office:text></office:body></office:document-content>`},
+	})
+
+	extraction, err := NewContentExtractors(nil).Extract(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Nagłówek\n\nAla  ma kota\n\n- element\n\na |  |  | d"
+	if extraction.Text != want {
+		t.Errorf("Text = %q, want %q", extraction.Text, want)
+	}
+}
+
+func TestReadDOCXMissingDocument(t *testing.T) {
+	filePath := writeZipFixture(t, "empty.docx", [][2]string{{"word/styles.xml", `<w:styles/>`}})
+	if _, err := ReadDOCX(filePath); err == nil || !strings.Contains(err.Error(), "word/document.xml") {
+		t.Errorf("ReadDOCX() error = %v, want missing part", err)
+	}
+}
@@ -2,11 +2,11 @@ package services
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -16,6 +16,10 @@ const (
 	defaultMaxTokens = 4096
 	defaultTimeout   = 30 * time.Second
 	defaultModel     = openai.GPT4o
+	visionModel      = openai.GPT4Turbo
+	// ocrPrompt asks the vision model for a page's text only, so results read
+	// like an extracted text layer.
+	ocrPrompt = "Transcribe all text in this image exactly as written, preserving reading order and line breaks. Reply with the text only."
 )
 
 type LLMService interface {
@@ -28,6 +32,7 @@ type OpenAiService struct {
 	SystemPrompt string
 	Model        string
 	client       *openai.Client
+	artifacts    *ArtifactStore
 }
 
 func NewOpenAIService(apiKey string, systemPrompt string, model string) (*OpenAiService, error) {
@@ -106,6 +111,29 @@ func (s *OpenAiService) SetSystemPrompt(prompt string) {
 	s.SystemPrompt = prompt
 }
 
+// WithArtifacts makes Transcript keep transcripts in the artifact store,
+// linked to the audio they were made from.
+func (s *OpenAiService) WithArtifacts(artifacts *ArtifactStore) *OpenAiService {
+	s.artifacts = artifacts
+	return s
+}
+
+// TranscriptDerivation describes the transcripts made by TranscribeAudio.
+func TranscriptDerivation() Derivation {
+	return Derivation{Kind: DerivedTranscript, Producer: "openai-transcription", Version: openai.Whisper1}
+}
+
+// ImageDescriptionDerivation describes image descriptions made by
+// AnalyzeImages with prompt.
+func ImageDescriptionDerivation(prompt string) Derivation {
+	return Derivation{Kind: DerivedImageDescription, Producer: "openai-vision", Version: visionModel, Params: prompt}
+}
+
+// OCRDerivation describes text transcribed from images by ImageText.
+func OCRDerivation() Derivation {
+	return Derivation{Kind: DerivedOCRText, Producer: "openai-vision", Version: visionModel, Params: ocrPrompt}
+}
+
 func (s OpenAiService) TranscribeAudio(audioPath string) (string, error) {
 	log.Printf("[INFO] Starting audio transcription for file: %s", audioPath)
 
@@ -133,46 +161,33 @@ func (s OpenAiService) TranscribeAudio(audioPath string) (string, error) {
 	return resp.Text, nil
 }
 
-func (s OpenAiService) readTranscriptionFile(filePath string) (string, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read transcription file: %w", err)
-	}
-	return string(content), nil
-}
-
-func (s OpenAiService) writeTranscriptionFile(audioPath string, transcription string) error {
-	// Create markdown file path by replacing audio extension with .md
-	mdPath := audioPath[:len(audioPath)-len(filepath.Ext(audioPath))] + ".md"
-
-	err := os.WriteFile(mdPath, []byte(transcription), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write transcription file: %w", err)
+// Transcript returns the transcript of an audio file, transcribing it only
+// when the artifact store has none for the same content and model. Without
+// an artifact store every call transcribes the file.
+func (s OpenAiService) Transcript(audioPath string) (string, error) {
+	if s.artifacts == nil {
+		return s.TranscribeAudio(audioPath)
 	}
-	return nil
+	return s.artifacts.DeriveText(audioPath, TranscriptDerivation(), func() (string, error) {
+		return s.TranscribeAudio(audioPath)
+	})
 }
 
-func (s OpenAiService) getTranscription(audioPath string) (string, error) {
-	// Check for existing markdown transcription
-	mdPath := audioPath[:len(audioPath)-len(filepath.Ext(audioPath))] + ".md"
-
-	// Try to read existing transcription
-	if transcription, err := s.readTranscriptionFile(mdPath); err == nil {
-		return transcription, nil
-	}
-
-	// If no transcription exists, create new one
-	transcription, err := s.TranscribeAudio(audioPath)
-	if err != nil {
-		return "", err
+// ImageText transcribes the text in an image, such as a scanned page, with
+// the vision model. Like Transcript, it reuses results kept in the artifact
+// store.
+func (s OpenAiService) ImageText(imagePath string) (string, error) {
+	read := func() (string, error) {
+		return s.AnalyzeImages(ImageAnalysisRequest{
+			Prompt: ocrPrompt,
+			Images: []ImageInput{{Path: imagePath}},
+			Detail: openai.ImageURLDetailHigh,
+		})
 	}
-
-	// Save the new transcription
-	if err := s.writeTranscriptionFile(audioPath, transcription); err != nil {
-		return "", err
+	if s.artifacts == nil {
+		return read()
 	}
-
-	return transcription, nil
+	return s.artifacts.DeriveText(imagePath, OCRDerivation(), read)
 }
 
 func (s OpenAiService) TranscribeDirectory(dirPath string) (map[string]string, error) {
@@ -195,7 +210,7 @@ func (s OpenAiService) TranscribeDirectory(dirPath string) (map[string]string, e
 		}
 
 		fullPath := filepath.Join(dirPath, file.Name())
-		transcription, err := s.getTranscription(fullPath)
+		transcription, err := s.Transcript(fullPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get transcription for %s: %w", file.Name(), err)
 		}
@@ -206,62 +221,106 @@ func (s OpenAiService) TranscribeDirectory(dirPath string) (map[string]string, e
 	return transcriptions, nil
 }
 
-func (s *OpenAiService) GenerateImage(prompt string, width, height int) (string, error) {
-	resp, err := s.client.CreateImage(context.Background(), openai.ImageRequest{
-		Prompt:         prompt,
-		Size:           fmt.Sprintf("%dx%d", width, height),
-		ResponseFormat: openai.CreateImageResponseFormatURL,
-		Model:          openai.CreateImageModelDallE3,
-		Quality:        openai.CreateImageQualityStandard,
-		Style:          openai.CreateImageStyleNatural,
-		N:              1,
-	})
+// ImageInput is one image passed to AnalyzeImages. Exactly one of Path or URL
+// must be set; Label is shown to the model right before the image.
+type ImageInput struct {
+	Path  string
+	URL   string
+	Label string
+}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to generate image: %v", err)
+// ImageAnalysisRequest describes a vision call. Detail defaults to auto and
+// MaxImageTokens, when set, caps the prompt tokens spent on each local image.
+type ImageAnalysisRequest struct {
+	Prompt         string
+	Images         []ImageInput
+	Detail         openai.ImageURLDetail
+	MaxImageTokens int
+}
+
+// ImageFiles wraps local image paths, labelling each with its file name.
+func ImageFiles(paths ...string) []ImageInput {
+	images := make([]ImageInput, len(paths))
+	for i, path := range paths {
+		images[i] = ImageInput{Path: path, Label: filepath.Base(path)}
+	}
+	return images
+}
+
+func (r ImageAnalysisRequest) validate() error {
+	if strings.TrimSpace(r.Prompt) == "" {
+		return fmt.Errorf("no prompt provided for image analysis")
+	}
+
+	if len(r.Images) == 0 {
+		return fmt.Errorf("no images provided for analysis")
 	}
 
-	if len(resp.Data) == 0 {
-		return "", fmt.Errorf("no image data received from DALL-E")
+	for i, img := range r.Images {
+		if (img.Path == "") == (img.URL == "") {
+			return fmt.Errorf("image %d must have exactly one of path or URL", i+1)
+		}
 	}
 
-	return resp.Data[0].URL, nil
+	switch r.Detail {
+	case "", openai.ImageURLDetailLow, openai.ImageURLDetailHigh, openai.ImageURLDetailAuto:
+		return nil
+	default:
+		return fmt.Errorf("unsupported image detail level %q", r.Detail)
+	}
 }
 
-func (s *OpenAiService) AnalyzeImages(prompt string, imagePaths ...string) (string, error) {
-	if len(imagePaths) == 0 {
-		log.Println("[ERROR] No images provided for analysis")
-		return "", fmt.Errorf("no images provided for analysis")
+func (s *OpenAiService) AnalyzeImages(req ImageAnalysisRequest) (string, error) {
+	if err := req.validate(); err != nil {
+		log.Printf("[ERROR] Invalid image analysis request: %v", err)
+		return "", err
 	}
 
-	log.Printf("[INFO] Starting image analysis - Number of Images: %d, Prompt Length: %d", len(imagePaths), len(prompt))
+	detail := req.Detail
+	if detail == "" {
+		detail = openai.ImageURLDetailAuto
+	}
 
-	// Create multi-content message parts
-	var parts []openai.ChatMessagePart
+	log.Printf("[INFO] Starting image analysis - Number of Images: %d, Prompt Length: %d, Detail: %s",
+		len(req.Images), len(req.Prompt), detail)
 
-	// Adjust prompt based on number of images
-	if len(imagePaths) > 1 {
-		prompt = "Describe what you see in these images. Compare them if there are multiple images."
+	parts := []openai.ChatMessagePart{
+		{
+			Type: openai.ChatMessagePartTypeText,
+			Text: req.Prompt,
+		},
 	}
 
-	parts = append(parts, openai.ChatMessagePart{
-		Type: openai.ChatMessagePartTypeText,
-		Text: prompt,
-	})
+	for i, img := range req.Images {
+		// Caption every image when there are several so the model can refer to them.
+		if img.Label != "" || len(req.Images) > 1 {
+			caption := fmt.Sprintf("Image %d", i+1)
+			if img.Label != "" {
+				caption += ": " + img.Label
+			}
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: caption,
+			})
+		}
 
-	// Add each image as a part
-	for _, imagePath := range imagePaths {
-		content, err := os.ReadFile(imagePath)
-		if err != nil {
-			return "", fmt.Errorf("failed to read image file %s: %w", imagePath, err)
+		imageURL := img.URL
+		if img.Path != "" {
+			encoded, err := EncodeImageFile(img.Path, detail, req.MaxImageTokens)
+			if err != nil {
+				return "", err
+			}
+
+			log.Printf("[DEBUG] Encoded image %s - Type: %s, Size: %dx%d, Bytes: %d, Estimated Tokens: %d",
+				img.Path, encoded.MIMEType, encoded.Width, encoded.Height, len(encoded.Data), encoded.Tokens)
+			imageURL = encoded.DataURL()
 		}
 
-		base64Image := base64.StdEncoding.EncodeToString(content)
 		parts = append(parts, openai.ChatMessagePart{
 			Type: openai.ChatMessagePartTypeImageURL,
 			ImageURL: &openai.ChatMessageImageURL{
-				URL:    fmt.Sprintf("data:image/jpeg;base64,%s", base64Image),
-				Detail: "low",
+				URL:    imageURL,
+				Detail: detail,
 			},
 		})
 	}
@@ -280,14 +339,21 @@ func (s *OpenAiService) AnalyzeImages(prompt string, imagePaths ...string) (stri
 	resp, err := s.client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
-			Model:     openai.GPT4Turbo, // Using GPT4Turbo consistently
+			Model:     visionModel,
 			Messages:  messages,
-			MaxTokens: 4096,
+			MaxTokens: defaultMaxTokens,
 		},
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to analyze images: %w", err)
 	}
 
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned from API")
+	}
+
+	log.Printf("[INFO] Received image analysis - Prompt Tokens: %d, Completion Tokens: %d",
+		resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
 	return resp.Choices[0].Message.Content, nil
 }
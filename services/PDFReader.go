@@ -0,0 +1,1604 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	// maxPDFFormDepth bounds nested form XObjects, which may reference each other.
+	maxPDFFormDepth = 8
+	// maxPDFStreamBytes bounds a single decoded stream and maxPDFDecodedBytes
+	// all streams decoded from one document, so a small file of highly
+	// compressed or repeatedly drawn streams cannot exhaust memory.
+	maxPDFStreamBytes  = 64 << 20
+	maxPDFDecodedBytes = 512 << 20
+	// maxPDFImagePixels bounds the size of images converted to PNG.
+	maxPDFImagePixels = 25_000_000
+)
+
+var (
+	// ErrPDFEncrypted is returned for password-protected PDFs.
+	ErrPDFEncrypted = errors.New("encrypted PDFs are not supported")
+	// ErrPDFLimit is returned for streams or images over the size limits.
+	ErrPDFLimit = errors.New("PDF exceeds extraction limits")
+)
+
+var pdfObjectPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// PDFDocument is the text and images of a PDF, page by page.
+type PDFDocument struct {
+	Pages []PDFPage `json:"pages"`
+}
+
+// PDFPage holds a page's text in reading order (top to bottom, left to right)
+// and the images drawn on it.
+type PDFPage struct {
+	Number int        `json:"number"`
+	Text   string     `json:"text"`
+	Images []PDFImage `json:"images,omitempty"`
+}
+
+// PDFImage is an embedded image, re-encoded as PNG unless it was stored as
+// JPEG or JPEG 2000.
+type PDFImage struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mimeType"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Data     []byte `json:"-"`
+}
+
+// Text returns the text of all pages, separated by blank lines.
+func (d *PDFDocument) Text() string {
+	texts := make([]string, 0, len(d.Pages))
+	for _, page := range d.Pages {
+		if text := strings.TrimSpace(page.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// ReadPDF extracts the text and images of every page of a PDF. It reads the
+// objects directly rather than through the cross-reference table, so files
+// with damaged tables still work. Encrypted files are rejected.
+func ReadPDF(path string) (*PDFDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\r "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("%s is not a PDF file", filepath.Base(path))
+	}
+
+	file := &pdfFile{data: data, objects: make(map[int]interface{})}
+	if err := file.load(); err != nil {
+		return nil, err
+	}
+
+	pages, err := file.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	document := &PDFDocument{}
+	for i, page := range pages {
+		document.Pages = append(document.Pages, file.readPage(i+1, page))
+	}
+
+	log.Printf("[DEBUG] Read %d PDF pages from %s", len(document.Pages), filepath.Base(path))
+	return document, nil
+}
+
+// ExtractPDFImages writes the embedded images of a PDF to destDir.
+func ExtractPDFImages(path, destDir string) ([]ExtractedFile, error) {
+	document, err := ReadPDF(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	var files []ExtractedFile
+	for _, page := range document.Pages {
+		for _, img := range page.Images {
+			target := filepath.Join(destDir, img.Name)
+			if err := os.WriteFile(target, img.Data, 0644); err != nil {
+				return files, fmt.Errorf("failed to write %s: %w", img.Name, err)
+			}
+			files = append(files, ExtractedFile{Name: img.Name, Path: target, Size: int64(len(img.Data))})
+		}
+	}
+	return files, nil
+}
+
+// PDF object model.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[pdfName]interface{}
+	pdfArray   []interface{}
+	pdfString  []byte
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+type pdfFile struct {
+	data    []byte
+	objects map[int]interface{}
+	trailer pdfDict
+	// decoded counts the bytes decoded so far, against maxPDFDecodedBytes.
+	decoded int64
+}
+
+type pdfDefinition struct {
+	offset int
+	num    int
+	value  interface{}
+}
+
+// load finds every "N G obj" definition, including those packed in object
+// streams. Later definitions (incremental updates) replace earlier ones.
+func (f *pdfFile) load() error {
+	var definitions []pdfDefinition
+	end := 0
+	for _, match := range pdfObjectPattern.FindAllSubmatchIndex(f.data, -1) {
+		if match[0] < end {
+			continue // inside the previous object, e.g. in stream data
+		}
+		num, _ := strconv.Atoi(string(f.data[match[2]:match[3]]))
+
+		lexer := &pdfLexer{data: f.data, pos: match[1]}
+		value, err := lexer.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := value.(pdfDict); ok {
+			if stream, ok := lexer.stream(dict, f.directLength(dict)); ok {
+				value = stream
+			}
+		}
+		end = lexer.pos
+		definitions = append(definitions, pdfDefinition{offset: match[0], num: num, value: value})
+	}
+
+	for _, definition := range definitions {
+		f.objects[definition.num] = definition.value
+	}
+
+	// Object streams are unpacked once all direct objects are known, since
+	// their lengths and filters may be references.
+	var packed []pdfDefinition
+	for _, definition := range definitions {
+		stream, ok := definition.value.(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		for _, object := range f.unpackObjectStream(stream) {
+			packed = append(packed, pdfDefinition{offset: definition.offset, num: object.num, value: object.value})
+		}
+	}
+	if len(packed) > 0 {
+		definitions = append(definitions, packed...)
+		sort.SliceStable(definitions, func(i, j int) bool { return definitions[i].offset < definitions[j].offset })
+		for _, definition := range definitions {
+			f.objects[definition.num] = definition.value
+		}
+	}
+
+	f.trailer = f.findTrailer(definitions)
+	if f.trailer["Encrypt"] != nil {
+		return ErrPDFEncrypted
+	}
+	return nil
+}
+
+// directLength returns a stream's /Length when it can be known while the file
+// is still being scanned.
+func (f *pdfFile) directLength(dict pdfDict) int {
+	switch length := dict["Length"].(type) {
+	case int64:
+		return int(length)
+	case pdfRef:
+		if value, ok := f.objects[length.num].(int64); ok {
+			return int(value)
+		}
+	}
+	return -1
+}
+
+func (f *pdfFile) unpackObjectStream(stream *pdfStream) []pdfDefinition {
+	data, err := f.decode(stream)
+	if err != nil {
+		log.Printf("[DEBUG] Skipping unreadable PDF object stream: %v", err)
+		return nil
+	}
+
+	count := int(f.number(stream.dict["N"]))
+	first := int(f.number(stream.dict["First"]))
+	if first <= 0 || first > len(data) {
+		return nil
+	}
+
+	header := &pdfLexer{data: data[:first]}
+	var objects []pdfDefinition
+	for i := 0; i < count; i++ {
+		num, err1 := header.object()
+		offset, err2 := header.object()
+		n, ok1 := num.(int64)
+		o, ok2 := offset.(int64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 || o < 0 || o >= int64(len(data)-first) {
+			break
+		}
+
+		lexer := &pdfLexer{data: data, pos: first + int(o)}
+		if value, err := lexer.object(); err == nil {
+			objects = append(objects, pdfDefinition{num: int(n), value: value})
+		}
+	}
+	return objects
+}
+
+// findTrailer returns the last trailer dictionary, or cross-reference stream
+// dictionary, that names the document catalog.
+func (f *pdfFile) findTrailer(definitions []pdfDefinition) pdfDict {
+	var trailer pdfDict
+	trailerOffset := -1
+
+	for offset := 0; ; {
+		i := bytes.Index(f.data[offset:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		offset += i + len("trailer")
+		lexer := &pdfLexer{data: f.data, pos: offset}
+		if dict, err := lexer.object(); err == nil {
+			if dict, ok := dict.(pdfDict); ok && dict["Root"] != nil {
+				trailer, trailerOffset = dict, offset
+			}
+		}
+	}
+
+	for _, definition := range definitions {
+		stream, ok := definition.value.(*pdfStream)
+		if ok && stream.dict["Type"] == pdfName("XRef") && stream.dict["Root"] != nil && definition.offset > trailerOffset {
+			trailer, trailerOffset = stream.dict, definition.offset
+		}
+	}
+
+	if trailer == nil {
+		// No usable trailer: look for the catalog itself.
+		for num, value := range f.objects {
+			if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				return pdfDict{"Root": pdfRef{num: num}}
+			}
+		}
+	}
+	return trailer
+}
+
+func (f *pdfFile) resolve(value interface{}) interface{} {
+	for depth := 0; depth < 16; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = f.objects[ref.num]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(value interface{}) pdfDict {
+	switch value := f.resolve(value).(type) {
+	case pdfDict:
+		return value
+	case *pdfStream:
+		return value.dict
+	}
+	return nil
+}
+
+func (f *pdfFile) array(value interface{}) pdfArray {
+	array, _ := f.resolve(value).(pdfArray)
+	return array
+}
+
+func (f *pdfFile) number(value interface{}) float64 {
+	switch value := f.resolve(value).(type) {
+	case int64:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return 0
+}
+
+func (f *pdfFile) name(value interface{}) pdfName {
+	name, _ := f.resolve(value).(pdfName)
+	return name
+}
+
+// pdfPageNode is a page dictionary with its inherited resources.
+type pdfPageNode struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func (f *pdfFile) pages() ([]pdfPageNode, error) {
+	catalog := f.dict(f.trailer["Root"])
+	if catalog == nil {
+		return nil, fmt.Errorf("PDF document catalog not found")
+	}
+
+	var pages []pdfPageNode
+	visited := make(map[interface{}]bool)
+	var walk func(node interface{}, resources pdfDict)
+	walk = func(node interface{}, resources pdfDict) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := f.dict(node)
+		if dict == nil {
+			return
+		}
+		if own := f.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+
+		if kids := f.array(dict["Kids"]); kids != nil || dict["Type"] == pdfName("Pages") {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		pages = append(pages, pdfPageNode{dict: dict, resources: resources})
+	}
+	walk(catalog["Pages"], nil)
+
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("PDF has no pages")
+	}
+	return pages, nil
+}
+
+// decode applies a stream's filters. Image-only filters (DCT, JPX...) are
+// left in place and reported through the returned error.
+func (f *pdfFile) decode(stream *pdfStream) ([]byte, error) {
+	filters := f.filters(stream.dict)
+	params := f.array(stream.dict["DecodeParms"])
+	if params == nil && stream.dict["DecodeParms"] != nil {
+		params = pdfArray{stream.dict["DecodeParms"]}
+	}
+
+	data := stream.data
+	for i, filter := range filters {
+		var parms pdfDict
+		if i < len(params) {
+			parms = f.dict(params[i])
+		}
+
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflatePDF(data, min(maxPDFStreamBytes, maxPDFDecodedBytes-f.decoded))
+			if err == nil {
+				data, err = f.unpredict(data, parms)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodePDFHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodePDFASCII85(data)
+		default:
+			return data, &pdfImageFilterError{filter: filter}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s stream: %w", filter, err)
+		}
+		f.decoded += int64(len(data))
+	}
+	return data, nil
+}
+
+type pdfImageFilterError struct {
+	filter pdfName
+}
+
+func (e *pdfImageFilterError) Error() string {
+	return fmt.Sprintf("unsupported PDF filter %s", e.filter)
+}
+
+func (f *pdfFile) filters(dict pdfDict) []pdfName {
+	switch filter := f.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		return []pdfName{filter}
+	case pdfArray:
+		names := make([]pdfName, 0, len(filter))
+		for _, name := range filter {
+			names = append(names, f.name(name))
+		}
+		return names
+	}
+	return nil
+}
+
+// inflatePDF inflates zlib data up to limit bytes, keeping what could be
+// read from truncated streams, which are common in generated PDFs.
+func inflatePDF(data []byte, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return nil, ErrPDFLimit
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w: stream inflates past %d bytes", ErrPDFLimit, limit)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict reverses PNG predictors (Predictor >= 10).
+func (f *pdfFile) unpredict(data []byte, parms pdfDict) ([]byte, error) {
+	predictor := int(f.number(parms["Predictor"]))
+	if predictor < 10 {
+		return data, nil
+	}
+
+	colors, bits, columns := int(f.number(parms["Colors"])), int(f.number(parms["BitsPerComponent"])), int(f.number(parms["Columns"]))
+	if colors == 0 {
+		colors = 1
+	}
+	if bits == 0 {
+		bits = 8
+	}
+	if columns == 0 {
+		columns = 1
+	}
+	if colors < 1 || colors > 32 || bits < 1 || bits > 16 || columns < 1 || columns > len(data)*8 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+	bpp := max(1, colors*bits/8)
+	rowLength := (colors*bits*columns + 7) / 8
+
+	out := make([]byte, 0, len(data))
+	previous := make([]byte, rowLength)
+	for start := 0; start+1+rowLength <= len(data); start += 1 + rowLength {
+		kind, row := data[start], append([]byte(nil), data[start+1:start+1+rowLength]...)
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], previous[i-bpp]
+			}
+			up = previous[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		previous = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func decodePDFHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isPDFWhitespace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func decodePDFASCII85(data []byte) ([]byte, error) {
+	var out []byte
+	var group [5]byte
+	n := 0
+	for _, c := range data {
+		switch {
+		case c == '~':
+			goto done
+		case isPDFWhitespace(c):
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return nil, fmt.Errorf("invalid ASCII85 character %q", c)
+		}
+		group[n] = c - '!'
+		n++
+		if n == 5 {
+			out = append(out, ascii85Group(group, 4)...)
+			n = 0
+		}
+	}
+done:
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u' - '!'
+		}
+		out = append(out, ascii85Group(group, n-1)...)
+	}
+	return out, nil
+}
+
+func ascii85Group(group [5]byte, count int) []byte {
+	var value uint32
+	for _, digit := range group {
+		value = value*85 + uint32(digit)
+	}
+	return []byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}[:count]
+}
+
+// readPage interprets a page's content streams.
+func (f *pdfFile) readPage(number int, page pdfPageNode) PDFPage {
+	var content []byte
+	switch contents := f.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = f.decode(contents)
+	case pdfArray:
+		for _, part := range contents {
+			if stream, ok := f.resolve(part).(*pdfStream); ok {
+				data, err := f.decode(stream)
+				if err != nil {
+					continue
+				}
+				content = append(append(content, data...), '\n')
+			}
+		}
+	}
+
+	reader := &pdfPageReader{file: f, page: number, fonts: make(map[interface{}]*pdfFont), seenImages: make(map[interface{}]bool)}
+	reader.run(content, page.resources, identityMatrix, 0)
+
+	return PDFPage{Number: number, Text: layoutPDFText(reader.spans), Images: reader.images}
+}
+
+type pdfMatrix [6]float64
+
+var identityMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n in PDF's row-vector convention.
+func (m pdfMatrix) multiply(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translation(x, y float64) pdfMatrix {
+	return pdfMatrix{1, 0, 0, 1, x, y}
+}
+
+// pdfTextSpan is a run of text drawn at one position, in page space.
+type pdfTextSpan struct {
+	x, y, endX, size float64
+	text             string
+}
+
+type pdfGraphicsState struct {
+	ctm                                       pdfMatrix
+	font                                      *pdfFont
+	fontSize, charSpacing, wordSpacing, scale float64
+	leading, rise                             float64
+}
+
+type pdfPageReader struct {
+	file       *pdfFile
+	page       int
+	fonts      map[interface{}]*pdfFont
+	seenImages map[interface{}]bool
+	spans      []pdfTextSpan
+	images     []PDFImage
+}
+
+func (r *pdfPageReader) run(content []byte, resources pdfDict, ctm pdfMatrix, depth int) {
+	state := pdfGraphicsState{ctm: ctm, scale: 1}
+	var stack []pdfGraphicsState
+	var tm, tlm pdfMatrix
+	var operands []interface{}
+
+	number := func(i int) float64 {
+		if i < len(operands) {
+			return r.file.number(operands[i])
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = translation(tx, ty).multiply(tlm)
+		tm = tlm
+	}
+	show := func(s pdfString) {
+		if state.font == nil {
+			state.font = &pdfFont{encoding: winAnsiEncoding, defaultWidth: 500, codeLength: 1}
+		}
+		text, width := state.font.decode(s, state)
+		trm := pdfMatrix{state.fontSize * state.scale, 0, 0, state.fontSize, 0, state.rise}.multiply(tm).multiply(state.ctm)
+		size := math.Sqrt(math.Abs(trm[0]*trm[3] - trm[1]*trm[2]))
+		tm = translation(width, 0).multiply(tm)
+		end := pdfMatrix{1, 0, 0, 1, 0, state.rise}.multiply(tm).multiply(state.ctm)
+		if strings.TrimSpace(text) != "" || text == " " {
+			r.spans = append(r.spans, pdfTextSpan{x: trm[4], y: trm[5], endX: end[4], size: size, text: text})
+		}
+	}
+
+	lexer := &pdfLexer{data: content}
+	for {
+		token, err := lexer.object()
+		if err != nil {
+			break
+		}
+		keyword, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch keyword {
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case "cm":
+			state.ctm = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}.multiply(state.ctm)
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(operands) >= 2 {
+				state.font = r.font(resources, operands[0])
+				state.fontSize = number(1)
+			}
+		case "Td":
+			moveLine(number(0), number(1))
+		case "TD":
+			state.leading = -number(1)
+			moveLine(number(0), number(1))
+		case "Tm":
+			tlm = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+			tm = tlm
+		case "T*":
+			moveLine(0, -state.leading)
+		case "TL":
+			state.leading = number(0)
+		case "Tc":
+			state.charSpacing = number(0)
+		case "Tw":
+			state.wordSpacing = number(0)
+		case "Tz":
+			state.scale = number(0) / 100
+		case "Ts":
+			state.rise = number(0)
+		case "Tj", "'", "\"":
+			if keyword == "\"" && len(operands) == 3 {
+				state.wordSpacing, state.charSpacing = number(0), number(1)
+			}
+			if keyword != "Tj" {
+				moveLine(0, -state.leading)
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			items, _ := operands[0].(pdfArray)
+			for _, item := range items {
+				switch item := item.(type) {
+				case pdfString:
+					show(item)
+				case int64, float64:
+					tm = translation(-r.file.number(item)/1000*state.fontSize*state.scale, 0).multiply(tm)
+				}
+			}
+		case "Do":
+			if len(operands) > 0 {
+				r.xobject(resources, operands[0], state.ctm, depth)
+			}
+		case "BI":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func (r *pdfPageReader) xobject(resources pdfDict, name interface{}, ctm pdfMatrix, depth int) {
+	ref := r.file.dict(resources["XObject"])[r.file.name(name)]
+	stream, ok := r.file.resolve(ref).(*pdfStream)
+	if !ok {
+		return
+	}
+
+	switch r.file.name(stream.dict["Subtype"]) {
+	case "Image":
+		if ref != nil && r.seenImages[ref] {
+			return
+		}
+		if ref != nil {
+			r.seenImages[ref] = true
+		}
+		if img, err := r.file.image(stream); err == nil {
+			img.Name = fmt.Sprintf("page%d-image%d%s", r.page, len(r.images)+1, pdfImageExt(img.MIMEType))
+			r.images = append(r.images, img)
+		} else {
+			log.Printf("[DEBUG] Skipping PDF image on page %d: %v", r.page, err)
+		}
+	case "Form":
+		if depth >= maxPDFFormDepth {
+			return
+		}
+		content, err := r.file.decode(stream)
+		if err != nil {
+			return
+		}
+		formResources := r.file.dict(stream.dict["Resources"])
+		if formResources == nil {
+			formResources = resources
+		}
+		matrix := identityMatrix
+		if values := r.file.array(stream.dict["Matrix"]); len(values) == 6 {
+			for i := range matrix {
+				matrix[i] = r.file.number(values[i])
+			}
+		}
+		r.run(content, formResources, matrix.multiply(ctm), depth+1)
+	}
+}
+
+func (r *pdfPageReader) font(resources pdfDict, name interface{}) *pdfFont {
+	fontName := r.file.name(name)
+	ref := r.file.dict(resources["Font"])[fontName]
+	key := ref
+	if _, isRef := ref.(pdfRef); !isRef {
+		key = fontName
+	}
+	if font, ok := r.fonts[key]; ok {
+		return font
+	}
+	font := r.file.loadFont(r.file.dict(ref))
+	r.fonts[key] = font
+	return font
+}
+
+func pdfImageExt(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/jp2":
+		return ".jp2"
+	default:
+		return ".png"
+	}
+}
+
+// image converts an image XObject to JPEG (as stored) or PNG.
+func (f *pdfFile) image(stream *pdfStream) (PDFImage, error) {
+	w, h := f.number(stream.dict["Width"]), f.number(stream.dict["Height"])
+	if w < 1 || h < 1 || w*h > maxPDFImagePixels {
+		return PDFImage{}, fmt.Errorf("%w: image size %.0fx%.0f", ErrPDFLimit, w, h)
+	}
+	width, height := int(w), int(h)
+	img := PDFImage{Width: width, Height: height}
+
+	data, err := f.decode(stream)
+	var filterErr *pdfImageFilterError
+	if errors.As(err, &filterErr) {
+		switch filterErr.filter {
+		case "DCTDecode", "DCT":
+			img.MIMEType, img.Data = "image/jpeg", data
+			return img, nil
+		case "JPXDecode":
+			img.MIMEType, img.Data = "image/jp2", data
+			return img, nil
+		}
+	}
+	if err != nil {
+		return PDFImage{}, err
+	}
+
+	bits := int(f.number(stream.dict["BitsPerComponent"]))
+	if stream.dict["ImageMask"] == true {
+		bits = 1
+	}
+
+	decoded, err := f.rasterize(data, stream.dict, width, height, bits)
+	if err != nil {
+		return PDFImage{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, decoded); err != nil {
+		return PDFImage{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+	img.MIMEType, img.Data = "image/png", buf.Bytes()
+	return img, nil
+}
+
+// rasterize turns raw samples into an image for 8-bit gray, RGB, CMYK and
+// indexed color spaces and for 1-bit gray images.
+func (f *pdfFile) rasterize(data []byte, dict pdfDict, width, height, bits int) (image.Image, error) {
+	space := f.resolve(dict["ColorSpace"])
+	var palette []color.Color
+	components := 1
+
+	baseName := func(space interface{}) pdfName {
+		if array, ok := space.(pdfArray); ok && len(array) > 0 {
+			if f.name(array[0]) == "ICCBased" && len(array) > 1 {
+				switch int(f.number(f.dict(array[1])["N"])) {
+				case 3:
+					return "DeviceRGB"
+				case 4:
+					return "DeviceCMYK"
+				}
+				return "DeviceGray"
+			}
+			return f.name(array[0])
+		}
+		return f.name(space)
+	}
+
+	switch baseName(space) {
+	case "DeviceRGB", "CalRGB":
+		components = 3
+	case "DeviceCMYK":
+		components = 4
+	case "Indexed", "I":
+		array, ok := space.(pdfArray)
+		if !ok || len(array) < 4 {
+			return nil, fmt.Errorf("invalid indexed color space")
+		}
+		var lookup []byte
+		switch table := f.resolve(array[3]).(type) {
+		case pdfString:
+			lookup = table
+		case *pdfStream:
+			lookup, _ = f.decode(table)
+		}
+		baseComponents := 1
+		switch baseName(f.resolve(array[1])) {
+		case "DeviceRGB", "CalRGB":
+			baseComponents = 3
+		case "DeviceCMYK":
+			baseComponents = 4
+		}
+		for i := 0; (i+1)*baseComponents <= len(lookup); i++ {
+			palette = append(palette, pdfColor(lookup[i*baseComponents:(i+1)*baseComponents]))
+		}
+	}
+
+	if bits == 1 && palette == nil && components == 1 {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		rowLength := (width + 7) / 8
+		for y := 0; y < height && (y+1)*rowLength <= len(data); y++ {
+			for x := 0; x < width; x++ {
+				if data[y*rowLength+x/8]&(0x80>>(x%8)) != 0 {
+					img.Pix[y*img.Stride+x] = 0xff
+				}
+			}
+		}
+		return img, nil
+	}
+	if bits != 8 {
+		return nil, fmt.Errorf("unsupported image depth %d", bits)
+	}
+
+	if palette != nil {
+		img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		copy(img.Pix, data)
+		return img, nil
+	}
+
+	if len(data) < width*height*components {
+		return nil, fmt.Errorf("image data is truncated")
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.Set(i%width, i/width, pdfColor(data[i*components:(i+1)*components]))
+	}
+	return img, nil
+}
+
+func pdfColor(samples []byte) color.Color {
+	switch len(samples) {
+	case 3:
+		return color.RGBA{samples[0], samples[1], samples[2], 0xff}
+	case 4:
+		return color.CMYK{samples[0], samples[1], samples[2], samples[3]}
+	default:
+		return color.Gray{samples[0]}
+	}
+}
+
+// layoutPDFText orders spans into lines, top to bottom and left to right,
+// inserting spaces at horizontal gaps and blank lines at paragraph breaks.
+func layoutPDFText(spans []pdfTextSpan) string {
+	if len(spans) == 0 {
+		return ""
+	}
+
+	sorted := append([]pdfTextSpan(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		tolerance := math.Max(sorted[i].size, sorted[j].size) * 0.5
+		if math.Abs(sorted[i].y-sorted[j].y) > tolerance {
+			return sorted[i].y > sorted[j].y
+		}
+		return sorted[i].x < sorted[j].x
+	})
+
+	var lines [][]pdfTextSpan
+	for _, span := range sorted {
+		if n := len(lines); n > 0 {
+			first := lines[n-1][0]
+			if math.Abs(first.y-span.y) <= math.Max(first.size, span.size)*0.5 {
+				lines[n-1] = append(lines[n-1], span)
+				continue
+			}
+		}
+		lines = append(lines, []pdfTextSpan{span})
+	}
+
+	var text strings.Builder
+	for i, line := range lines {
+		sort.SliceStable(line, func(a, b int) bool { return line[a].x < line[b].x })
+		if i > 0 {
+			previous := lines[i-1][0]
+			text.WriteString("\n")
+			if previous.y-line[0].y > math.Max(previous.size, line[0].size)*1.8 {
+				text.WriteString("\n")
+			}
+		}
+
+		var lineText strings.Builder
+		for j, span := range line {
+			if j > 0 {
+				gap := span.x - line[j-1].endX
+				current := lineText.String()
+				if gap > span.size*0.2 && !strings.HasSuffix(current, " ") && !strings.HasPrefix(span.text, " ") {
+					lineText.WriteString(" ")
+				}
+			}
+			lineText.WriteString(span.text)
+		}
+		text.WriteString(strings.TrimSpace(lineText.String()))
+	}
+	return text.String()
+}
+
+// pdfFont maps character codes to text and widths.
+type pdfFont struct {
+	composite    bool
+	codeLength   int
+	toUnicode    map[uint32]string
+	encoding     *[256]string
+	widths       map[uint32]float64
+	defaultWidth float64
+}
+
+func (f *pdfFile) loadFont(dict pdfDict) *pdfFont {
+	font := &pdfFont{encoding: winAnsiEncoding, defaultWidth: 500, codeLength: 1, widths: make(map[uint32]float64)}
+	if dict == nil {
+		return font
+	}
+
+	if f.name(dict["Subtype"]) == "Type0" {
+		font.composite, font.codeLength, font.defaultWidth = true, 2, 1000
+		if descendants := f.array(dict["DescendantFonts"]); len(descendants) > 0 {
+			descendant := f.dict(descendants[0])
+			if dw := f.resolve(descendant["DW"]); dw != nil {
+				font.defaultWidth = f.number(dw)
+			}
+			f.loadCIDWidths(font, f.array(descendant["W"]))
+		}
+	} else {
+		font.encoding = f.simpleEncoding(dict)
+		first := uint32(f.number(dict["FirstChar"]))
+		for i, width := range f.array(dict["Widths"]) {
+			font.widths[first+uint32(i)] = f.number(width)
+		}
+		if descriptor := f.dict(dict["FontDescriptor"]); descriptor != nil && descriptor["MissingWidth"] != nil {
+			font.defaultWidth = f.number(descriptor["MissingWidth"])
+		}
+	}
+
+	if stream, ok := f.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decode(stream); err == nil {
+			font.toUnicode, font.codeLength = parseToUnicode(data, font.codeLength)
+		}
+	}
+	return font
+}
+
+func (f *pdfFile) loadCIDWidths(font *pdfFont, w pdfArray) {
+	for i := 0; i < len(w); {
+		first := uint32(f.number(w[i]))
+		if i+1 >= len(w) {
+			return
+		}
+		if widths := f.array(w[i+1]); widths != nil {
+			for j, width := range widths {
+				font.widths[first+uint32(j)] = f.number(width)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, width := uint32(f.number(w[i+1])), f.number(w[i+2])
+		for code := first; code <= last && code-first < 65536; code++ {
+			font.widths[code] = width
+		}
+		i += 3
+	}
+}
+
+func (f *pdfFile) simpleEncoding(dict pdfDict) *[256]string {
+	encoding := f.resolve(dict["Encoding"])
+	base := winAnsiEncoding
+	if f.name(encoding) == "MacRomanEncoding" {
+		base = macRomanEncoding
+	}
+
+	encodingDict := f.dict(encoding)
+	if encodingDict == nil {
+		return base
+	}
+	if f.name(encodingDict["BaseEncoding"]) == "MacRomanEncoding" {
+		base = macRomanEncoding
+	}
+
+	custom := *base
+	code := 0
+	for _, item := range f.array(encodingDict["Differences"]) {
+		switch item := f.resolve(item).(type) {
+		case int64:
+			code = int(item)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				custom[code] = glyphText(string(item))
+			}
+			code++
+		}
+	}
+	return &custom
+}
+
+func (font *pdfFont) decode(s pdfString, state pdfGraphicsState) (string, float64) {
+	var text strings.Builder
+	var width float64
+	for i := 0; i < len(s); {
+		n := max(font.codeLength, 1)
+		if i+n > len(s) {
+			n = len(s) - i
+		}
+		var code uint32
+		for _, b := range s[i : i+n] {
+			code = code<<8 | uint32(b)
+		}
+		i += n
+
+		switch {
+		case font.toUnicode != nil && font.toUnicode[code] != "":
+			text.WriteString(font.toUnicode[code])
+		case !font.composite && code < 256:
+			text.WriteString(font.encoding[code])
+		}
+
+		glyphWidth, ok := font.widths[code]
+		if !ok {
+			glyphWidth = font.defaultWidth
+		}
+		width += glyphWidth / 1000 * state.fontSize
+		width += state.charSpacing
+		if n == 1 && code == ' ' {
+			width += state.wordSpacing
+		}
+	}
+	return text.String(), width * state.scale
+}
+
+// parseToUnicode reads the bfchar and bfrange sections of a ToUnicode CMap
+// and the code length declared by its codespace ranges.
+func parseToUnicode(data []byte, codeLength int) (map[uint32]string, int) {
+	mapping := make(map[uint32]string)
+	lexer := &pdfLexer{data: data}
+	var operands []interface{}
+
+	code := func(value interface{}) (uint32, int) {
+		s, _ := value.(pdfString)
+		var c uint32
+		for _, b := range s {
+			c = c<<8 | uint32(b)
+		}
+		return c, len(s)
+	}
+
+	section := pdfKeyword("")
+	for {
+		token, err := lexer.object()
+		if err != nil {
+			break
+		}
+		keyword, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch keyword {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = keyword
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if _, n := code(operands[0]); n > 0 {
+					codeLength = n
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := code(operands[i])
+				if dst, ok := operands[i+1].(pdfString); ok {
+					mapping[src] = decodeUTF16(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, _ := code(operands[i])
+				high, _ := code(operands[i+1])
+				if high < low || high-low > 65535 {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					units := decodeUTF16Units(dst)
+					for c := low; c <= high; c++ {
+						shifted := append([]uint16(nil), units...)
+						if len(shifted) > 0 {
+							shifted[len(shifted)-1] += uint16(c - low)
+						}
+						mapping[c] = string(utf16.Decode(shifted))
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && low+uint32(j) <= high {
+							mapping[low+uint32(j)] = decodeUTF16(s)
+						}
+					}
+				}
+			}
+		}
+		if section != "" && strings.HasPrefix(string(keyword), "end") {
+			section = ""
+		}
+		operands = operands[:0]
+	}
+	return mapping, codeLength
+}
+
+func decodeUTF16Units(s []byte) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func decodeUTF16(s []byte) string {
+	if len(s) == 1 {
+		return string(rune(s[0]))
+	}
+	return string(utf16.Decode(decodeUTF16Units(s)))
+}
+
+var (
+	winAnsiEncoding  = charmapEncoding(charmap.Windows1252)
+	macRomanEncoding = charmapEncoding(charmap.Macintosh)
+)
+
+func charmapEncoding(table *charmap.Charmap) *[256]string {
+	var encoding [256]string
+	for code := 32; code < 256; code++ {
+		if r := table.DecodeByte(byte(code)); r != 0xFFFD {
+			encoding[code] = string(r)
+		}
+	}
+	return &encoding
+}
+
+// pdfGlyphNames covers glyph names used in /Differences beyond single
+// characters and uniXXXX names.
+var pdfGlyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "colon": ":",
+	"semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9",
+	"quoteleft": "‘", "quoteright": "’", "quotedblleft": "“", "quotedblright": "”", "quotedblbase": "„",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…", "degree": "°", "section": "§",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"aogonek": "ą", "Aogonek": "Ą", "cacute": "ć", "Cacute": "Ć", "eogonek": "ę", "Eogonek": "Ę",
+	"lslash": "ł", "Lslash": "Ł", "nacute": "ń", "Nacute": "Ń", "oacute": "ó", "Oacute": "Ó",
+	"sacute": "ś", "Sacute": "Ś", "zacute": "ź", "Zacute": "Ź", "zdotaccent": "ż", "Zdotaccent": "Ż",
+	"adieresis": "ä", "Adieresis": "Ä", "odieresis": "ö", "Odieresis": "Ö", "udieresis": "ü",
+	"Udieresis": "Ü", "germandbls": "ß", "eacute": "é", "Eacute": "É", "egrave": "è", "agrave": "à",
+	"ccedilla": "ç",
+}
+
+func glyphText(name string) string {
+	if text, ok := pdfGlyphNames[name]; ok {
+		return text
+	}
+	if len(name) == 1 {
+		return name
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if hexDigits, ok := strings.CutPrefix(name, prefix); ok && len(hexDigits) >= 4 && len(hexDigits) <= 6 {
+			if value, err := strconv.ParseUint(hexDigits[:4*(len(hexDigits)/4)], 16, 32); err == nil {
+				return string(rune(value))
+			}
+		}
+	}
+	return ""
+}
+
+// pdfLexer reads PDF objects from file or content stream syntax.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEnd = errors.New("end of PDF data")
+
+func isPDFWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFWhitespace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *pdfLexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// object reads one object. Integers followed by "G R" become references;
+// anything else that is not a number, name or literal is a keyword.
+func (l *pdfLexer) object() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEnd
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return pdfName(decodePDFName(l.regular())), nil
+	case '(':
+		return l.literalString(), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dictionary()
+		}
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFEnd
+		}
+		s, _ := decodePDFHex(l.data[l.pos : l.pos+end])
+		l.pos += end + 1
+		return pdfString(s), nil
+	case '[':
+		l.pos++
+		var array pdfArray
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return array, nil
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return array, nil
+			}
+			item, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+	case ']', '>', ')', '{', '}':
+		l.pos++
+		if c == '>' && l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(string(c)), nil
+	}
+
+	token := l.regular()
+	if token == "" {
+		l.pos++
+		return pdfKeyword(""), nil
+	}
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if value, err := strconv.ParseInt(token, 10, 64); err == nil {
+		// Look ahead for "gen R".
+		save := l.pos
+		l.skipSpace()
+		gen := l.regular()
+		l.skipSpace()
+		if generation, err := strconv.Atoi(gen); err == nil && l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isPDFWhitespace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+			l.pos++
+			return pdfRef{num: int(value), gen: generation}, nil
+		}
+		l.pos = save
+		return value, nil
+	}
+	if value, err := strconv.ParseFloat(token, 64); err == nil {
+		return value, nil
+	}
+	return pdfKeyword(token), nil
+}
+
+func (l *pdfLexer) dictionary() (pdfDict, error) {
+	dict := make(pdfDict)
+	for {
+		key, err := l.object()
+		if err != nil {
+			return dict, nil
+		}
+		if key == pdfKeyword(">>") {
+			return dict, nil
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+		value, err := l.object()
+		if err != nil {
+			return dict, nil
+		}
+		if value == pdfKeyword(">>") {
+			return dict, nil
+		}
+		dict[name] = value
+	}
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if c >= '0' && c <= '7' {
+					value := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(value))
+				} else {
+					out = append(out, c)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// stream reads the stream data following dict, if any. length is the
+// declared length, or -1 to search for "endstream".
+func (l *pdfLexer) stream(dict pdfDict, length int) (*pdfStream, bool) {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return nil, false
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	if length >= 0 && length <= len(l.data)-start {
+		rest := bytes.TrimLeft(l.data[start+length:min(len(l.data), start+length+32)], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = start + length
+			return &pdfStream{dict: dict, data: l.data[start : start+length]}, true
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, data: l.data[start:]}, true
+	}
+	data := bytes.TrimRight(l.data[start:start+end], "\r\n")
+	l.pos = start + end + len("endstream")
+	return &pdfStream{dict: dict, data: data}, true
+}
+
+// skipInlineImage moves past the data of an inline image (BI ... ID ... EI).
+func (l *pdfLexer) skipInlineImage() {
+	for {
+		token, err := l.object()
+		if err != nil || token == pdfKeyword("ID") {
+			break
+		}
+	}
+	for l.pos+2 < len(l.data) {
+		if isPDFWhitespace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 == len(l.data) || isPDFWhitespace(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+func decodePDFName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var out strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if value, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				out.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		out.WriteByte(name[i])
+	}
+	return out.String()
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pdfStreamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// writePDFFixture numbers objects from 1; the first must be the catalog.
+func writePDFFixture(t *testing.T, trailer string, objects ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+	for i, object := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Root 1 0 R %s >>\n%%%%EOF\n", trailer)
+
+	filePath := filepath.Join(t.TempDir(), "document.pdf")
+	if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// imagePDF draws a single image XObject, described by imageDict, on one page.
+func imagePDF(t *testing.T, imageDict string, samples []byte) string {
+	return writePDFFixture(t, "",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /Im1 5 0 R >> >> >>",
+		pdfStreamObject("", []byte("q 100 0 0 100 0 0 cm /Im1 Do Q")),
+		pdfStreamObject("/Type /XObject /Subtype /Image "+imageDict, samples),
+	)
+}
+
+type fakeImageReader struct {
+	calls int
+}
+
+func (r *fakeImageReader) ImageText(imagePath string) (string, error) {
+	r.calls++
+	return "scanned " + filepath.Base(imagePath), nil
+}
+
+func TestReadPDFText(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 700 Td (Hello) Tj ( world) Tj 0 -14 Td [(Sec)-20(ond)-400(line)] TJ ET\n" +
+		"BT /F1 12 Tf 300 800 Td (Title) Tj ET\n" +
+		"BT /F1 12 Tf 72 600 Td (Paragraph \\(two\\) ) Tj (A) Tj ET")
+	filePath := writePDFFixture(t, "",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStreamObject("/Filter /FlateDecode", deflate(t, content)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [65 /lslash] >> >>",
+	)
+
+	document, err := ReadPDF(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Title\n\nHello world\nSecond line\n\nParagraph (two) ł"
+	if got := document.Text(); got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestReadPDFObjectStreamAndToUnicode(t *testing.T) {
+	cmap := []byte("1 begincodespacerange <0000> <FFFF> endcodespacerange " +
+		"2 beginbfchar <0001> <0105> <0002> <017C> endbfchar 1 beginbfrange <0010> <0012> <0041> endbfrange")
+	page := "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >> "
+	font := "<< /Type /Font /Subtype /Type0 /ToUnicode 6 0 R /DescendantFonts [<< /DW 500 >>] >>"
+	header := fmt.Sprintf("3 0 5 %d ", len(page))
+
+	filePath := writePDFFixture(t, "",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"null",
+		pdfStreamObject("", []byte("BT /F1 10 Tf 10 10 Td <000100020010001100120001> Tj ET")),
+		"null",
+		pdfStreamObject("", cmap),
+		pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate(t, []byte(header+page+font))),
+	)
+
+	document, err := ReadPDF(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := document.Text(); got != "ążABCą" {
+		t.Errorf("Text() = %q, want %q", got, "ążABCą")
+	}
+}
+
+func TestPDFExtractorReadsScannedPages(t *testing.T) {
+	samples := make([]byte, 4*4*3)
+	filePath := imagePDF(t, "/Width 4 /Height 4 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", deflate(t, samples))
+
+	reader := &fakeImageReader{}
+	extraction, err := NewExtractorRegistry().Register("application/pdf", PDFExtractor{Reader: reader}).Extract(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extraction.Text != "scanned page1-image1.png" || reader.calls != 1 {
+		t.Errorf("Text = %q after %d calls, want the OCR text of one image", extraction.Text, reader.calls)
+	}
+	if extraction.Metadata["ocrPages"] != "1" {
+		t.Errorf("ocrPages = %q, want 1", extraction.Metadata["ocrPages"])
+	}
+}
+
+func TestReadPDFSkipsInvalidImages(t *testing.T) {
+	cases := map[string]string{
+		"bare indexed color space":  "/Width 2 /Height 2 /ColorSpace /Indexed /BitsPerComponent 8",
+		"short indexed color space": "/Width 2 /Height 2 /ColorSpace /I /BitsPerComponent 8",
+		"oversized":                 "/Width 100000 /Height 100000 /ColorSpace /DeviceGray /BitsPerComponent 8",
+		"huge predictor columns":    "/Width 2 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 99999999999 >>",
+	}
+	for name, dict := range cases {
+		t.Run(name, func(t *testing.T) {
+			document, err := ReadPDF(imagePDF(t, dict, deflate(t, []byte{0, 1, 2, 3})))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if images := document.Pages[0].Images; len(images) != 0 {
+				t.Errorf("got %d images, want the invalid image skipped", len(images))
+			}
+		})
+	}
+}
+
+func TestInflatePDFLimit(t *testing.T) {
+	bomb := make([]byte, maxPDFStreamBytes+1)
+	if _, err := inflatePDF(deflate(t, bomb), maxPDFStreamBytes); !errors.Is(err, ErrPDFLimit) {
+		t.Errorf("inflatePDF() error = %v, want ErrPDFLimit", err)
+	}
+}
+
+func TestReadPDFEncrypted(t *testing.T) {
+	filePath := writePDFFixture(t, "/Encrypt 3 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Filter /Standard >>",
+	)
+	if _, err := ReadPDF(filePath); !errors.Is(err, ErrPDFEncrypted) {
+		t.Errorf("ReadPDF() error = %v, want ErrPDFEncrypted", err)
+	}
+}
+
+func TestReadPDFWithoutFont(t *testing.T) {
+	cases := map[string]string{
+		"text before Tf":   "BT 72 700 Td (Hello) Tj ET",
+		"string font name": "BT (F1) 12 Tf 72 700 Td (Hello) Tj ET",
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			filePath := writePDFFixture(t, "",
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+				pdfStreamObject("", []byte(content)),
+			)
+			document, err := ReadPDF(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := document.Text(); got != "Hello" {
+				t.Errorf("Text() = %q, want %q", got, "Hello")
+			}
+		})
+	}
+}
+
+func FuzzReadPDF(f *testing.F) {
+	f.Add([]byte("BT 72 700 Td (Hello) Tj ET"))
+	f.Add([]byte("BT /F1 12 Tf 72 700 Td [(Sec)-20(ond)] TJ ET"))
+	f.Add([]byte("BT (F1) 12 Tf <0001> Tj ET"))
+	f.Add([]byte("q 100 0 0 100 0 0 cm /Im1 Do Q"))
+	f.Fuzz(func(t *testing.T, content []byte) {
+		filePath := writePDFFixture(t, "",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+			"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+			pdfStreamObject("", content),
+			"<< /Type /Font /Subtype /Type0 /DescendantFonts [<< /DW 500 >>] >>",
+		)
+		ReadPDF(filePath)
+	})
+}
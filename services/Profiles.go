@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Profile holds one team member's Centrala key, service URLs and form
+// credentials. Each profile keeps its own flag ledger, submission log and
+// Centrala mirror under its data directory. The server adds an HTTP client
+// and an embedder whose caches are kept there too.
+type Profile struct {
+	Name            string `json:"name"`
+	CentralaAPIKey  string `json:"centralaApiKey"`
+	CentralaBaseURL string `json:"centralaBaseUrl"`
+	XYZBaseURL      string `json:"xyzBaseUrl,omitempty"`
+	SoftoBaseURL    string `json:"softoBaseUrl,omitempty"`
+	FormUsername    string `json:"formUsername,omitempty"`
+	FormPassword    string `json:"formPassword,omitempty"`
+
+	DataDir     string          `json:"-"`
+	Ledger      *FlagLedger     `json:"-"`
+	Submissions *SubmissionLog  `json:"-"`
+	Mirror      *CentralaMirror `json:"-"`
+	HTTPClient  *HTTPClient     `json:"-"`
+	Embedder    Embedder        `json:"-"`
+}
+
+func (p *Profile) validate() error {
+	if !profileNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid profile name %q (letters, digits, '-' and '_' only)", p.Name)
+	}
+	if p.CentralaAPIKey == "" {
+		return fmt.Errorf("profile %s: centralaApiKey not specified", p.Name)
+	}
+	if p.CentralaBaseURL == "" {
+		return fmt.Errorf("profile %s: centralaBaseUrl not specified", p.Name)
+	}
+
+	p.CentralaBaseURL = strings.TrimRight(p.CentralaBaseURL, "/")
+	p.XYZBaseURL = strings.TrimRight(p.XYZBaseURL, "/")
+	return nil
+}
+
+// ProfileConfig is the format of the profiles file.
+type ProfileConfig struct {
+	Default  string    `json:"default"`
+	Profiles []Profile `json:"profiles"`
+}
+
+// LoadProfileConfig reads a profiles file. With a single profile and no
+// default, that profile is the default.
+func LoadProfileConfig(path string) (*ProfileConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var config ProfileConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+
+	if config.Default == "" && len(config.Profiles) == 1 {
+		config.Default = config.Profiles[0].Name
+	}
+	return &config, nil
+}
+
+// ProfileSet is the set of configured profiles.
+type ProfileSet struct {
+	profiles    map[string]*Profile
+	defaultName string
+}
+
+// NewProfileSet validates the profiles and opens each one's ledger,
+// submission log and mirror under dataDir/<name>. secrets shared by all
+// profiles (such as the OpenAI key) are redacted from every ledger and
+// submission log along with the profile's own key and password.
+func NewProfileSet(config *ProfileConfig, dataDir string, secrets ...string) (*ProfileSet, error) {
+	if config == nil || len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles configured")
+	}
+
+	set := &ProfileSet{
+		profiles:    make(map[string]*Profile, len(config.Profiles)),
+		defaultName: config.Default,
+	}
+
+	for i := range config.Profiles {
+		profile := config.Profiles[i]
+		if err := profile.validate(); err != nil {
+			return nil, err
+		}
+		if _, duplicate := set.profiles[profile.Name]; duplicate {
+			return nil, fmt.Errorf("profile %s defined more than once", profile.Name)
+		}
+
+		profile.DataDir = filepath.Join(dataDir, profile.Name)
+
+		var err error
+		profileSecrets := append([]string{profile.CentralaAPIKey, profile.FormPassword}, secrets...)
+		if profile.Ledger, err = NewFlagLedger(filepath.Join(profile.DataDir, "flags.jsonl"), profileSecrets...); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+
+		if profile.Submissions, err = NewSubmissionLog(filepath.Join(profile.DataDir, "submissions.jsonl"), profileSecrets...); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+		if profile.Mirror, err = NewCentralaMirror(filepath.Join(profile.DataDir, "mirror")); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+
+		set.profiles[profile.Name] = &profile
+	}
+
+	if _, ok := set.profiles[set.defaultName]; !ok {
+		return nil, fmt.Errorf("default profile %q is not defined", set.defaultName)
+	}
+
+	log.Printf("[INFO] Loaded %d profiles (default: %s)", len(set.profiles), set.defaultName)
+	return set, nil
+}
+
+// Get returns the named profile, or the default one for an empty name.
+func (s *ProfileSet) Get(name string) (*Profile, error) {
+	if name == "" {
+		name = s.defaultName
+	}
+
+	profile, ok := s.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// All returns every profile, sorted by name.
+func (s *ProfileSet) All() []*Profile {
+	profiles := make([]*Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
@@ -3,11 +3,11 @@ package services
 import (
 	"context"
 	"fmt"
-	"os"
+	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/qdrant/go-client/qdrant"
-	"github.com/sashabaranov/go-openai"
 )
 
 type SearchResult struct {
@@ -23,19 +23,15 @@ type Document struct {
 }
 
 type QdrantService struct {
-	client       *openai.Client
+	embedder     Embedder
 	qdrantClient *qdrant.Client
-	modelName    string
 	collection   string
 }
 
-func NewQdrantService() (*QdrantService, error) {
-	// Initialize OpenAI client for embeddings
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY not set")
+func NewQdrantService(embedder Embedder) (*QdrantService, error) {
+	if embedder == nil {
+		return nil, fmt.Errorf("embedder not specified")
 	}
-	client := openai.NewClient(apiKey)
 
 	// Initialize Qdrant client - using gRPC port as per docs
 	qdrantClient, err := qdrant.NewClient(
@@ -48,20 +44,13 @@ func NewQdrantService() (*QdrantService, error) {
 		return nil, fmt.Errorf("failed to create Qdrant client: %w", err)
 	}
 
-	collectionName := "weapons_reports"
+	// Vectors from different models (or sizes) are not comparable, so each
+	// embedder gets its own collection.
+	collectionName := collectionNameFor("weapons_reports", embedder)
 
-	// Check if collection exists
-	collections, err := qdrantClient.ListCollections(context.Background())
+	collectionExists, err := qdrantClient.CollectionExists(context.Background(), collectionName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list collections: %w", err)
-	}
-
-	collectionExists := false
-	for _, collection := range collections {
-		if collection == collectionName {
-			collectionExists = true
-			break
-		}
+		return nil, fmt.Errorf("failed to check collection: %w", err)
 	}
 
 	// Create collection only if it doesn't exist
@@ -69,7 +58,7 @@ func NewQdrantService() (*QdrantService, error) {
 		err = qdrantClient.CreateCollection(context.Background(), &qdrant.CreateCollection{
 			CollectionName: collectionName,
 			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-				Size:     1536, // OpenAI embedding size
+				Size:     uint64(embedder.Dimension()),
 				Distance: qdrant.Distance_Cosine,
 			}),
 		})
@@ -79,61 +68,81 @@ func NewQdrantService() (*QdrantService, error) {
 	}
 
 	return &QdrantService{
-		client:       client,
+		embedder:     embedder,
 		qdrantClient: qdrantClient,
-		modelName:    string(openai.AdaEmbeddingV2),
 		collection:   collectionName,
 	}, nil
 }
 
-func (s *QdrantService) getEmbedding(text string) ([]float32, error) {
-	resp, err := s.client.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.EmbeddingModel(s.modelName),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding: %w", err)
-	}
+func collectionNameFor(base string, embedder Embedder) string {
+	model := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, embedder.Model())
+	return fmt.Sprintf("%s_%s_%d", base, model, embedder.Dimension())
+}
+
+func (s *QdrantService) IndexDocument(content string, metadata map[string]interface{}) error {
+	return s.IndexDocuments([]Document{{Content: content, Metadata: metadata}})
+}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data received")
+// IndexDocuments embeds all documents in as few requests as the embedder allows
+// and upserts them in one call. Documents without an ID get a random one, so
+// give them a stable ID to make re-indexing idempotent.
+func (s *QdrantService) IndexDocuments(documents []Document) error {
+	if len(documents) == 0 {
+		return nil
 	}
 
-	return resp.Data[0].Embedding, nil
-}
+	contents := make([]string, len(documents))
+	for i, doc := range documents {
+		contents[i] = doc.Content
+	}
 
-func (s *QdrantService) IndexDocument(content string, metadata map[string]interface{}) error {
-	embedding, err := s.getEmbedding(content)
+	embeddings, err := s.embedder.Embed(context.Background(), contents)
 	if err != nil {
 		return err
 	}
 
+	points := make([]*qdrant.PointStruct, len(documents))
+	for i, doc := range documents {
+		id := doc.ID
+		if id == "" {
+			id = uuid.New().String()
+		} else if _, err := uuid.Parse(id); err != nil {
+			// Qdrant only accepts UUIDs, so other IDs are mapped to a stable one.
+			id = uuid.NewSHA1(uuid.NameSpaceURL, []byte(id)).String()
+		}
+
+		points[i] = &qdrant.PointStruct{
+			Id:      qdrant.NewID(id),
+			Vectors: qdrant.NewVectors(embeddings[i]...),
+			Payload: qdrant.NewValueMap(map[string]interface{}{
+				"content":  doc.Content,
+				"metadata": doc.Metadata,
+			}),
+		}
+	}
+
 	_, err = s.qdrantClient.Upsert(context.Background(), &qdrant.UpsertPoints{
 		CollectionName: s.collection,
-		Points: []*qdrant.PointStruct{
-			{
-				Id:      &qdrant.PointId{PointIdOptions: &qdrant.PointId_Uuid{Uuid: uuid.New().String()}},
-				Vectors: qdrant.NewVectors(embedding...),
-				Payload: qdrant.NewValueMap(map[string]interface{}{
-					"content":  content,
-					"metadata": metadata,
-				}),
-			},
-		},
+		Points:         points,
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to index document: %w", err)
+		return fmt.Errorf("failed to index documents: %w", err)
 	}
 
 	return nil
 }
 
 func (s *QdrantService) Search(query string, limit int) ([]*qdrant.ScoredPoint, error) {
-	queryEmbedding, err := s.getEmbedding(query)
+	embeddings, err := s.embedder.Embed(context.Background(), []string{query})
 	if err != nil {
 		return nil, err
 	}
+	queryEmbedding := embeddings[0]
 
 	newLimit := uint64(limit)
 
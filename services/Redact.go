@@ -0,0 +1,83 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// minSecretLength keeps short values (e.g. an empty or one-letter password)
+// from redacting unrelated text.
+const minSecretLength = 4
+
+var secretKeyPattern = regexp.MustCompile(`(?i)^(api_?key|password|passwd|secret|token|access_?token|authorization)$`)
+
+// RedactString replaces every occurrence of the given secrets in s.
+func RedactString(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// RedactValue returns a JSON-normalised copy of v with the given secrets
+// replaced in all strings and the values of secret-looking keys (apikey,
+// password, token...) hidden.
+func RedactValue(v interface{}, secrets ...string) interface{} {
+	return redactJSONValue(normalizeJSONValue(v), secrets)
+}
+
+// ContainsRedacted reports whether any string in v, such as an answer read back
+// from the submission log, had something redacted from it.
+func ContainsRedacted(v interface{}) bool {
+	return containsRedacted(normalizeJSONValue(v))
+}
+
+func containsRedacted(v interface{}) bool {
+	switch value := v.(type) {
+	case string:
+		return strings.Contains(value, redactedValue)
+	case []interface{}:
+		for _, item := range value {
+			if containsRedacted(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			if containsRedacted(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func redactJSONValue(v interface{}, secrets []string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return RedactString(value, secrets...)
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = redactJSONValue(item, secrets)
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			if secretKeyPattern.MatchString(key) {
+				redacted[key] = redactedValue
+				continue
+			}
+			redacted[key] = redactJSONValue(item, secrets)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReviseFunc produces a new answer after Centrala rejected the previous one.
+type ReviseFunc func(answer interface{}, rejection *CentralaError) (interface{}, error)
+
+// ReportAttempt is one submission made by SubmitWithRetry.
+type ReportAttempt struct {
+	Answer   interface{}    `json:"answer"`
+	Response EntityResponse `json:"response"`
+}
+
+// SubmitWithRetry posts answer to /report and, while Centrala rejects it,
+// asks revise for a better one, up to maxAttempts submissions in total.
+// Transport errors are returned immediately; if every attempt is rejected the
+// last *CentralaError is returned with all attempts.
+func (s *CentralaService) SubmitWithRetry(task string, answer interface{}, maxAttempts int, revise ReviseFunc) (EntityResponse, []ReportAttempt, error) {
+	if maxAttempts < 1 {
+		return EntityResponse{}, nil, fmt.Errorf("maxAttempts must be at least 1, got %d", maxAttempts)
+	}
+
+	var attempts []ReportAttempt
+	for attempt := 1; ; attempt++ {
+		response, err := s.PostReport(task, answer)
+		attempts = append(attempts, ReportAttempt{Answer: answer, Response: response})
+
+		rejection, rejected := AsCentralaError(err)
+		if !rejected {
+			return response, attempts, err
+		}
+
+		if attempt >= maxAttempts || revise == nil {
+			s.logger.Warn("Report rejected after all attempts", "task", task, "attempts", attempt)
+			return response, attempts, err
+		}
+
+		s.logger.Info("Report rejected, revising answer", "task", task, "attempt", attempt, "code", rejection.Code)
+		answer, err = revise(answer, rejection)
+		if err != nil {
+			return response, attempts, fmt.Errorf("failed to revise answer for task %s: %w", task, err)
+		}
+	}
+}
+
+// LLMReviser returns a ReviseFunc that shows the model the rejected answer,
+// Centrala's message and hints, and the task context, and expects a corrected
+// answer of the same shape. JSON replies are decoded; anything else is used as
+// a plain string answer.
+func LLMReviser(llm LLMService, context string) ReviseFunc {
+	return func(answer interface{}, rejection *CentralaError) (interface{}, error) {
+		previous, err := json.Marshal(answer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal rejected answer: %w", err)
+		}
+
+		prompt := fmt.Sprintf(`Our answer was rejected. Correct it using the feedback and the context below.
+
+Rejected answer (JSON):
+%s
+
+Feedback: %s
+Hints:
+- %s
+
+Context:
+%s
+
+Return only the corrected answer as JSON with exactly the same structure, without markdown.`,
+			previous, rejection.Message, strings.Join(rejection.Hints, "\n- "), context)
+
+		revised, err := llm.SendChatMessage(prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(revised)), &decoded); err != nil {
+			if _, isString := answer.(string); isString {
+				return strings.TrimSpace(revised), nil
+			}
+			return nil, fmt.Errorf("failed to parse revised answer '%s': %w", revised, err)
+		}
+		return decoded, nil
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Submission is one /report request and what Centrala answered. Answers and
+// messages are stored redacted.
+type Submission struct {
+	ID          string      `json:"id"`
+	Task        string      `json:"task"`
+	RunID       string      `json:"runId,omitempty"`
+	Answer      interface{} `json:"answer"`
+	Code        int         `json:"code"`
+	Message     string      `json:"message,omitempty"`
+	Hints       []string    `json:"hints,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	LatencyMS   int64       `json:"latencyMs"`
+	SubmittedAt time.Time   `json:"submittedAt"`
+}
+
+// SubmissionLog is an append-only JSONL audit log of report submissions.
+type SubmissionLog struct {
+	path    string
+	secrets []string
+	mu      sync.Mutex
+}
+
+// NewSubmissionLog opens (or creates) the log at path. secrets are redacted
+// from everything written, in addition to secret-looking JSON keys.
+func NewSubmissionLog(path string, secrets ...string) (*SubmissionLog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("submission log path not specified")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create submission log directory: %w", err)
+	}
+
+	return &SubmissionLog{
+		path:    path,
+		secrets: secrets,
+	}, nil
+}
+
+// Record redacts and appends a submission, assigning its ID and timestamp when
+// unset. extraSecrets are redacted along with the log's own.
+func (l *SubmissionLog) Record(submission Submission, extraSecrets ...string) (Submission, error) {
+	if submission.ID == "" {
+		submission.ID = uuid.NewString()
+	}
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+
+	secrets := append(append([]string{}, l.secrets...), extraSecrets...)
+	submission.Answer = RedactValue(submission.Answer, secrets...)
+	submission.Message = RedactString(submission.Message, secrets...)
+	if submission.Hints != nil {
+		hints := make([]string, len(submission.Hints))
+		for i, hint := range submission.Hints {
+			hints[i] = RedactString(hint, secrets...)
+		}
+		submission.Hints = hints
+	}
+	submission.Error = RedactString(submission.Error, secrets...)
+
+	line, err := json.Marshal(submission)
+	if err != nil {
+		return submission, fmt.Errorf("failed to marshal submission: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return submission, fmt.Errorf("failed to open submission log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return submission, fmt.Errorf("failed to write submission log: %w", err)
+	}
+	return submission, nil
+}
+
+// Submissions returns logged submissions, optionally limited to one task,
+// oldest first.
+func (l *SubmissionLog) Submissions(task string) ([]Submission, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return []Submission{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open submission log: %w", err)
+	}
+	defer file.Close()
+
+	submissions := []Submission{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var submission Submission
+		if err := json.Unmarshal(scanner.Bytes(), &submission); err != nil {
+			return nil, fmt.Errorf("failed to parse submission log line %d: %w", line, err)
+		}
+		if task == "" || submission.Task == task {
+			submissions = append(submissions, submission)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read submission log: %w", err)
+	}
+	return submissions, nil
+}
+
+// Get returns the submission with the given ID.
+func (l *SubmissionLog) Get(id string) (*Submission, error) {
+	submissions, err := l.Submissions("")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range submissions {
+		if submissions[i].ID == id {
+			return &submissions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("submission %s not found", id)
+}
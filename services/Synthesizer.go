@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrInvalidSpeechRequest is wrapped by errors about the request itself, such
+// as empty text or an unsupported voice, as opposed to provider failures.
+var ErrInvalidSpeechRequest = errors.New("invalid speech request")
+
+const (
+	maxSpeechInputLength = 4096
+	minSpeechSpeed       = 0.25
+	maxSpeechSpeed       = 4.0
+)
+
+var (
+	speechFormats = []openai.SpeechResponseFormat{
+		openai.SpeechResponseFormatMp3,
+		openai.SpeechResponseFormatWav,
+		openai.SpeechResponseFormatOpus,
+	}
+
+	openAISpeechVoices = []openai.SpeechVoice{
+		openai.VoiceAlloy,
+		openai.VoiceEcho,
+		openai.VoiceFable,
+		openai.VoiceOnyx,
+		openai.VoiceNova,
+		openai.VoiceShimmer,
+	}
+)
+
+// SpeechRequest describes text to render. Empty fields default to the alloy
+// voice, normal speed and mp3.
+type SpeechRequest struct {
+	Text   string                      `json:"text"`
+	Voice  openai.SpeechVoice          `json:"voice,omitempty"`
+	Speed  float64                     `json:"speed,omitempty"`
+	Format openai.SpeechResponseFormat `json:"format,omitempty"`
+}
+
+// Synthesizer renders text to audio and returns the stored recording.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, req SpeechRequest) (*Artifact, error)
+}
+
+// OpenAISynthesizer speaks through the OpenAI speech endpoint or any server
+// exposing the same API, such as a local TTS stub.
+type OpenAISynthesizer struct {
+	client    *openai.Client
+	model     openai.SpeechModel
+	custom    bool
+	artifacts *ArtifactStore
+}
+
+// NewOpenAISynthesizer creates a synthesizer. An empty baseURL targets OpenAI;
+// any other value points the client at an OpenAI-compatible server, for which
+// voice names are not checked since such servers define their own.
+func NewOpenAISynthesizer(apiKey, baseURL string, model openai.SpeechModel, artifacts *ArtifactStore) (*OpenAISynthesizer, error) {
+	if apiKey == "" && baseURL == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not specified - make sure to set environment variable")
+	}
+
+	if artifacts == nil {
+		return nil, fmt.Errorf("artifact store not specified")
+	}
+
+	if model == "" {
+		model = openai.TTSModel1
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+
+	return &OpenAISynthesizer{
+		client:    openai.NewClientWithConfig(config),
+		model:     model,
+		custom:    baseURL != "",
+		artifacts: artifacts,
+	}, nil
+}
+
+func (s *OpenAISynthesizer) validate(req *SpeechRequest) error {
+	if req.Text == "" {
+		return fmt.Errorf("%w: no text provided for speech synthesis", ErrInvalidSpeechRequest)
+	}
+	if n := utf8.RuneCountInString(req.Text); n > maxSpeechInputLength {
+		return fmt.Errorf("%w: text is %d characters, speech synthesis accepts at most %d", ErrInvalidSpeechRequest, n, maxSpeechInputLength)
+	}
+
+	if req.Voice == "" {
+		req.Voice = openai.VoiceAlloy
+	}
+	if !s.custom && !slices.Contains(openAISpeechVoices, req.Voice) {
+		return fmt.Errorf("%w: unsupported voice %q", ErrInvalidSpeechRequest, req.Voice)
+	}
+
+	if req.Speed == 0 {
+		req.Speed = 1.0
+	}
+	if req.Speed < minSpeechSpeed || req.Speed > maxSpeechSpeed {
+		return fmt.Errorf("%w: speed must be between %.2f and %.1f, got %.2f", ErrInvalidSpeechRequest, minSpeechSpeed, maxSpeechSpeed, req.Speed)
+	}
+
+	if req.Format == "" {
+		req.Format = openai.SpeechResponseFormatMp3
+	}
+	if !slices.Contains(speechFormats, req.Format) {
+		return fmt.Errorf("%w: unsupported audio format %q (supported: %v)", ErrInvalidSpeechRequest, req.Format, speechFormats)
+	}
+
+	return nil
+}
+
+func (s *OpenAISynthesizer) Synthesize(ctx context.Context, req SpeechRequest) (*Artifact, error) {
+	if err := s.validate(&req); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Synthesizing speech - Model: %s, Voice: %s, Speed: %.2f, Format: %s, Text Length: %d",
+		s.model, req.Voice, req.Speed, req.Format, len(req.Text))
+
+	resp, err := s.client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          s.model,
+		Input:          req.Text,
+		Voice:          req.Voice,
+		ResponseFormat: req.Format,
+		Speed:          req.Speed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to synthesize speech: %w", err)
+	}
+	defer resp.Close()
+
+	audio, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synthesized audio: %w", err)
+	}
+
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("received empty audio from speech endpoint")
+	}
+
+	return s.artifacts.Put(audio, "."+string(req.Format))
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSynthesizeSeparatesValidationErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	artifacts, err := NewArtifactStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	openAI, err := NewOpenAISynthesizer("key", "", "", artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]SpeechRequest{
+		"empty text": {},
+		"too long":   {Text: strings.Repeat("a", maxSpeechInputLength+1)},
+		"voice":      {Text: "hej", Voice: "robot"},
+		"speed":      {Text: "hej", Speed: 5},
+		"format":     {Text: "hej", Format: "flac"},
+	}
+	for name, req := range invalid {
+		if _, err := openAI.Synthesize(context.Background(), req); !errors.Is(err, ErrInvalidSpeechRequest) {
+			t.Errorf("%s: error = %v, want ErrInvalidSpeechRequest", name, err)
+		}
+	}
+
+	custom, err := NewOpenAISynthesizer("", server.URL, "", artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = custom.Synthesize(context.Background(), SpeechRequest{Text: "hej"})
+	if err == nil || errors.Is(err, ErrInvalidSpeechRequest) {
+		t.Errorf("provider failure error = %v, want a non-validation error", err)
+	}
+}
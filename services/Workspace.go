@@ -0,0 +1,328 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// workspaceIDPattern keeps run IDs, which may come from a request header, and
+// profile names usable as a single directory name.
+var workspaceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+
+const (
+	workspaceMetaFile = ".workspace.json"
+	// workspaceSharedDir holds the links to the shared caches in a workspace.
+	workspaceSharedDir = "shared"
+)
+
+// WorkspaceConfig configures a WorkspaceManager.
+type WorkspaceConfig struct {
+	// Root holds one directory per profile, each with one directory per run.
+	Root string
+	// TTL is how long an idle workspace is kept for inspection. Zero keeps
+	// workspaces until MaxBytes is exceeded.
+	TTL time.Duration
+	// MaxBytes bounds the total size of idle workspaces; the oldest are
+	// removed first. Zero disables the limit.
+	MaxBytes int64
+	// Shared returns, for a profile, the cache directories linked into each
+	// of its workspaces under shared/<name>. Tasks must treat them as
+	// read-only.
+	Shared func(profile string) map[string]string
+}
+
+// Workspace is the private working directory of one run.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Profile   string    `json:"profile"`
+	Task      string    `json:"task"`
+	Dir       string    `json:"dir"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Path joins elem to the workspace directory.
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.Dir}, elem...)...)
+}
+
+// Shared returns the path of the shared cache linked as name.
+func (w *Workspace) Shared(name string) string {
+	return w.Path(workspaceSharedDir, name)
+}
+
+// WorkspaceManager gives each run its own directory under the root, apart
+// from the runs of other profiles, and garbage-collects idle ones by age and
+// total size. Workspaces in use are never collected.
+type WorkspaceManager struct {
+	config WorkspaceConfig
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func NewWorkspaceManager(config WorkspaceConfig) (*WorkspaceManager, error) {
+	if config.Root == "" {
+		return nil, fmt.Errorf("workspace directory not specified")
+	}
+	if config.TTL < 0 || config.MaxBytes < 0 {
+		return nil, fmt.Errorf("workspace TTL and size limit must not be negative")
+	}
+
+	if err := os.MkdirAll(config.Root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+
+	return &WorkspaceManager{config: config, active: make(map[string]int)}, nil
+}
+
+// Acquire returns the workspace of the profile's runID, creating it for task
+// if needed, and marks it in use until Release. A run reusing its ID (e.g. a
+// retry with the same X-Run-ID) gets the same directory.
+func (m *WorkspaceManager) Acquire(profile, runID, task string) (*Workspace, error) {
+	dir, err := m.workspaceDir(profile, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.active[dir]++
+	m.mu.Unlock()
+
+	if _, _, err := m.Collect(); err != nil {
+		log.Printf("[WARN] Workspace garbage collection failed: %v", err)
+	}
+
+	workspace, err := m.Get(profile, runID)
+	if err == nil {
+		return workspace, nil
+	}
+
+	workspace, err = m.create(profile, runID, task)
+	if err != nil {
+		m.Release(profile, runID)
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// Release marks one use of the run's workspace as finished.
+func (m *WorkspaceManager) Release(profile, runID string) {
+	dir := filepath.Join(profile, runID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.active[dir] <= 1 {
+		delete(m.active, dir)
+		return
+	}
+	m.active[dir]--
+}
+
+// workspaceDir returns the directory of a run relative to the root.
+func (m *WorkspaceManager) workspaceDir(profile, runID string) (string, error) {
+	if !workspaceIDPattern.MatchString(profile) {
+		return "", fmt.Errorf("invalid profile name %q", profile)
+	}
+	if !workspaceIDPattern.MatchString(runID) {
+		return "", fmt.Errorf("invalid run ID %q", runID)
+	}
+	return filepath.Join(profile, runID), nil
+}
+
+func (m *WorkspaceManager) create(profile, runID, task string) (*Workspace, error) {
+	workspace := &Workspace{
+		ID:        runID,
+		Profile:   profile,
+		Task:      task,
+		Dir:       filepath.Join(m.config.Root, profile, runID),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := os.MkdirAll(workspace.Path(workspaceSharedDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	if err := m.linkShared(workspace); err != nil {
+		return nil, err
+	}
+
+	content, err := json.MarshalIndent(workspace, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workspace metadata: %w", err)
+	}
+	if err := os.WriteFile(workspace.Path(workspaceMetaFile), content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write workspace metadata: %w", err)
+	}
+
+	log.Printf("[INFO] Created workspace %s for %s", workspace.Dir, task)
+	return workspace, nil
+}
+
+// linkShared links the profile's shared caches into the workspace.
+func (m *WorkspaceManager) linkShared(workspace *Workspace) error {
+	if m.config.Shared == nil {
+		return nil
+	}
+	for name, dir := range m.config.Shared(workspace.Profile) {
+		if !workspaceIDPattern.MatchString(name) {
+			return fmt.Errorf("invalid shared cache name %q", name)
+		}
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve shared cache %s: %w", name, err)
+		}
+		if err := os.MkdirAll(absolute, 0755); err != nil {
+			return fmt.Errorf("failed to create shared cache %s: %w", name, err)
+		}
+		if err := os.Symlink(absolute, workspace.Shared(name)); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to link shared cache %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Get returns an existing workspace of the profile.
+func (m *WorkspaceManager) Get(profile, runID string) (*Workspace, error) {
+	dir, err := m.workspaceDir(profile, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(m.config.Root, dir, workspaceMetaFile))
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s not found: %w", runID, err)
+	}
+
+	var workspace Workspace
+	if err := json.Unmarshal(content, &workspace); err != nil {
+		return nil, fmt.Errorf("failed to parse workspace metadata: %w", err)
+	}
+	workspace.Profile = profile
+	workspace.Dir = filepath.Join(m.config.Root, dir)
+	return &workspace, nil
+}
+
+// Files lists the files a run of the profile left in its workspace, without
+// the shared caches.
+func (m *WorkspaceManager) Files(profile, runID string) ([]FileEntry, error) {
+	workspace, err := m.Get(profile, runID)
+	if err != nil {
+		return nil, err
+	}
+	return WalkFiles(workspace.Dir, WalkOptions{Exclude: []string{workspaceSharedDir, workspaceMetaFile}})
+}
+
+// Collect removes idle workspaces older than the TTL, then the oldest idle
+// ones until the total size fits MaxBytes. It returns how many workspaces
+// were removed and the bytes freed.
+func (m *WorkspaceManager) Collect() (int, int64, error) {
+	dirs, err := m.workspaceDirs()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type candidate struct {
+		id       string
+		size     int64
+		modified time.Time
+	}
+
+	var candidates []candidate
+	var total int64
+	for _, dir := range dirs {
+		size, modified, err := workspaceUsage(filepath.Join(m.config.Root, dir))
+		if err != nil {
+			log.Printf("[WARN] Failed to inspect workspace %s: %v", dir, err)
+			continue
+		}
+		total += size
+
+		m.mu.Lock()
+		inUse := m.active[dir] > 0
+		m.mu.Unlock()
+		if !inUse {
+			candidates = append(candidates, candidate{id: dir, size: size, modified: modified})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].modified.Before(candidates[j].modified) })
+
+	removed := 0
+	var freed int64
+	for _, c := range candidates {
+		expired := m.config.TTL > 0 && time.Since(c.modified) > m.config.TTL
+		oversized := m.config.MaxBytes > 0 && total > m.config.MaxBytes
+		if !expired && !oversized {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(m.config.Root, c.id)); err != nil {
+			return removed, freed, fmt.Errorf("failed to remove workspace %s: %w", c.id, err)
+		}
+		total -= c.size
+		freed += c.size
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("[INFO] Removed %d idle workspaces (%d bytes)", removed, freed)
+	}
+	return removed, freed, nil
+}
+
+// workspaceDirs lists every workspace as "<profile>/<run ID>" relative to the
+// root. Only directories with workspace metadata are included.
+func (m *WorkspaceManager) workspaceDirs() ([]string, error) {
+	profiles, err := os.ReadDir(m.config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace directory: %w", err)
+	}
+
+	var dirs []string
+	for _, profile := range profiles {
+		if !profile.IsDir() {
+			continue
+		}
+		runs, err := os.ReadDir(filepath.Join(m.config.Root, profile.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workspace directory: %w", err)
+		}
+		for _, run := range runs {
+			dir := filepath.Join(profile.Name(), run.Name())
+			if run.IsDir() && FileExists(filepath.Join(m.config.Root, dir, workspaceMetaFile)) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// workspaceUsage returns the size of a workspace and the time it was last
+// written to. Links to shared caches are not followed.
+func workspaceUsage(dir string) (int64, time.Time, error) {
+	var size int64
+	var modified time.Time
+	err := filepath.WalkDir(dir, func(current string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			size += info.Size()
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		return nil
+	})
+	return size, modified, err
+}
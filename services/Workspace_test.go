@@ -0,0 +1,55 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspacesAreSeparatePerProfile(t *testing.T) {
+	caches := t.TempDir()
+	workspaces, err := NewWorkspaceManager(WorkspaceConfig{
+		Root: t.TempDir(),
+		Shared: func(profile string) map[string]string {
+			return map[string]string{"mirror": filepath.Join(caches, profile)}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := workspaces.Acquire("alice", "run-1", "task7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workspaces.Release("alice", "run-1")
+	if err := os.WriteFile(alice.Path("notes.txt"), []byte("private"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := workspaces.Get("bob", "run-1"); err == nil {
+		t.Error("Get() found another profile's workspace")
+	}
+	bob, err := workspaces.Acquire("bob", "run-1", "task7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workspaces.Release("bob", "run-1")
+	if bob.Dir == alice.Dir {
+		t.Fatalf("both profiles got %s", bob.Dir)
+	}
+	if target, err := os.Readlink(bob.Shared("mirror")); err != nil || target != filepath.Join(caches, "bob") {
+		t.Errorf("bob's mirror links to %q, %v", target, err)
+	}
+
+	files, err := workspaces.Files("alice", "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Files() = %v, want only notes.txt", files)
+	}
+	if _, err := workspaces.Get("../alice", "run-1"); err == nil {
+		t.Error("Get() accepted a path as profile name")
+	}
+}
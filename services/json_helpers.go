@@ -11,3 +11,17 @@ func InterfaceToJSON(data interface{}) ([]byte, error) {
 func JSONToStruct(data []byte, v interface{}) error {
 	return json.Unmarshal(data, v)
 }
+
+// normalizeJSONValue round-trips v through JSON so values compare the way they
+// look on the wire (structs become maps, all numbers float64).
+func normalizeJSONValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return v
+	}
+	return normalized
+}
@@ -0,0 +1,153 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lumenn/bifrost-agent/services"
+)
+
+// fileNamePattern matches a bare file name with an extension. Task7 reports
+// any file type the content extractors handle, so the extension is not
+// restricted.
+const fileNamePattern = `^[^/\\]+\.[A-Za-z0-9]+$`
+
+// answerRules declares the answer shape of each Centrala task. Every client
+// made by newCentralaService checks answers against it before submitting.
+var answerRules = services.NewAnswerRegistry().
+	Register("CENZURA", services.AnswerRule{
+		Schema: &services.AnswerSchema{Type: "string", MinLength: 1},
+		Check: func(answer interface{}) error {
+			if !strings.Contains(answer.(string), "CENZURA") {
+				return fmt.Errorf("censored text contains no CENZURA marker")
+			}
+			return nil
+		},
+	}).
+	Register("kategorie", services.AnswerRule{
+		Schema: &services.AnswerSchema{
+			Type: "object",
+			Properties: map[string]*services.AnswerSchema{
+				"people":   {Type: "array", Items: &services.AnswerSchema{Type: "string", Pattern: fileNamePattern}},
+				"hardware": {Type: "array", Items: &services.AnswerSchema{Type: "string", Pattern: fileNamePattern}},
+			},
+			Required:               []string{"people", "hardware"},
+			NoAdditionalProperties: true,
+		},
+		Normalize: normalizeCategories,
+	}).
+	Register("arxiv", services.AnswerRule{
+		Schema: &services.AnswerSchema{
+			Type:                 "object",
+			PropertyNames:        &services.AnswerSchema{Pattern: `^\d{2}$`},
+			AdditionalProperties: &services.AnswerSchema{Type: "string", MinLength: 1},
+		},
+		Normalize: normalizeQuestionIDs,
+	}).
+	Register("dokumenty", services.AnswerRule{
+		Schema: &services.AnswerSchema{
+			Type:                 "object",
+			PropertyNames:        &services.AnswerSchema{Pattern: extensionPattern(documentGlobs)},
+			AdditionalProperties: &services.AnswerSchema{Type: "string", MinLength: 1},
+		},
+	}).
+	Register("wektory", services.AnswerRule{
+		Schema: &services.AnswerSchema{Type: "string", Pattern: `^\d{4}-\d{2}-\d{2}$`},
+		Normalize: func(answer interface{}) (interface{}, error) {
+			if date, ok := answer.(string); ok {
+				return strings.ReplaceAll(strings.TrimSpace(date), "_", "-"), nil
+			}
+			return answer, nil
+		},
+	}).
+	Register("database", services.AnswerRule{
+		Schema:    &services.AnswerSchema{Type: "array", Items: &services.AnswerSchema{Type: "integer"}, MinItems: 1},
+		Normalize: normalizeIntegers,
+	}).
+	Register("loop", services.AnswerRule{
+		Schema: &services.AnswerSchema{Type: "string", Pattern: `^[A-Z]+( [A-Z]+)*$`},
+		Normalize: func(answer interface{}) (interface{}, error) {
+			if city, ok := answer.(string); ok {
+				return normalizeString(city), nil
+			}
+			return answer, nil
+		},
+	}).
+	Register("connections", services.AnswerRule{
+		Schema: &services.AnswerSchema{Type: "string", Pattern: `^[^,]+(, [^,]+)+$`},
+	})
+
+// extensionPattern matches names ending in one of the extensions of globs
+// such as "*.txt".
+func extensionPattern(globs []string) string {
+	extensions := make([]string, len(globs))
+	for i, glob := range globs {
+		extensions[i] = regexp.QuoteMeta(strings.TrimPrefix(glob, "*."))
+	}
+	return `\.(` + strings.Join(extensions, "|") + `)$`
+}
+
+// normalizeCategories turns missing categories into empty lists and sorts them.
+func normalizeCategories(answer interface{}) (interface{}, error) {
+	report, ok := answer.(map[string]interface{})
+	if !ok {
+		return answer, nil
+	}
+
+	for _, category := range []string{"people", "hardware"} {
+		files, _ := report[category].([]interface{})
+		if files == nil {
+			files = []interface{}{}
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return fmt.Sprint(files[i]) < fmt.Sprint(files[j])
+		})
+		report[category] = files
+	}
+	return report, nil
+}
+
+// normalizeQuestionIDs zero-pads numeric keys, so "1" becomes "01".
+func normalizeQuestionIDs(answer interface{}) (interface{}, error) {
+	answers, ok := answer.(map[string]interface{})
+	if !ok {
+		return answer, nil
+	}
+
+	normalized := make(map[string]interface{}, len(answers))
+	for id, value := range answers {
+		key := strings.TrimSpace(id)
+		if n, err := strconv.Atoi(key); err == nil && n >= 0 && n < 100 {
+			key = fmt.Sprintf("%02d", n)
+		}
+		if _, duplicate := normalized[key]; duplicate {
+			return nil, fmt.Errorf("question id %q appears more than once", key)
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
+
+// normalizeIntegers converts numeric strings in a list to numbers.
+func normalizeIntegers(answer interface{}) (interface{}, error) {
+	values, ok := answer.([]interface{})
+	if !ok {
+		return answer, nil
+	}
+
+	for i, value := range values {
+		text, isString := value.(string)
+		if !isString {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("/%d: %q is not an integer", i, text)
+		}
+		values[i] = float64(n)
+	}
+	return values, nil
+}
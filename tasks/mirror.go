@@ -0,0 +1,32 @@
+package tasks
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MirrorResources fetches every known Centrala resource into the mirror for
+// the current profile. ?refresh=true fetches resources already mirrored again.
+func MirrorResources(ctx *gin.Context, centralaBaseURL, centralaAPIKey string) {
+	mirror := centralaMirror(ctx)
+	if mirror == nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "mirror not configured"})
+		return
+	}
+
+	logf(ctx, "[INFO] Mirroring known Centrala resources")
+
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+	results, err := centralaService.MirrorKnownResources()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to mirror resources: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"results":  results,
+		"manifest": mirror.Manifest(),
+	})
+}
@@ -0,0 +1,280 @@
+package tasks
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lumenn/bifrost-agent/services"
+)
+
+const (
+	runIDKey   = "runID"
+	profileKey = "profile"
+	dryRunKey  = "dryRun"
+	loggerKey  = "logger"
+
+	artifactsKey  = "artifacts"
+	workspacesKey = "workspaces"
+	workspaceKey  = "workspace"
+)
+
+// RunContext tags each request with a run ID (reusing the caller's X-Run-ID
+// header when present) and selects the profile named by the X-Bifrost-Profile
+// header or ?profile= (the default profile otherwise). dryRun is the default,
+// overridable per request with ?dryRun= or X-Dry-Run.
+func RunContext(profiles *services.ProfileSet, dryRun bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		name := ctx.GetHeader("X-Bifrost-Profile")
+		if name == "" {
+			name = ctx.Query("profile")
+		}
+
+		profile, err := profiles.Get(name)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		runID := ctx.GetHeader("X-Run-ID")
+		if runID == "" {
+			runID = uuid.NewString()
+		}
+
+		ctx.Set(runIDKey, runID)
+		ctx.Set(profileKey, profile)
+		ctx.Set(loggerKey, slog.Default().With("run_id", runID, "profile", profile.Name))
+		ctx.Set(dryRunKey, requestDryRun(ctx, dryRun))
+		ctx.Header("X-Run-ID", runID)
+		ctx.Header("X-Bifrost-Profile", profile.Name)
+		ctx.Next()
+	}
+}
+
+// LogRequests logs every request once it has been handled, with the run ID
+// assigned by RunContext. Secret-looking query parameters are redacted.
+func LogRequests() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+		ctx.Next()
+
+		level := slog.LevelInfo
+		if ctx.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Default().LogAttrs(ctx.Request.Context(), level, "Handled request",
+			slog.String("method", ctx.Request.Method),
+			slog.String("url", services.RedactURL(ctx.Request.URL.RequestURI())),
+			slog.Int("status", ctx.Writer.Status()),
+			slog.Int64("latency_ms", time.Since(started).Milliseconds()),
+			slog.String("run_id", ctx.GetString(runIDKey)),
+		)
+	}
+}
+
+// Logger returns the request's logger, which tags records with the run ID
+// and profile.
+func Logger(ctx *gin.Context) *slog.Logger {
+	value, _ := ctx.Get(loggerKey)
+	if logger, ok := value.(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logf logs a "[LEVEL] message" line like log.Printf, through the run's
+// logger so the record carries its run ID and profile.
+func logf(ctx *gin.Context, format string, args ...interface{}) {
+	services.LogOutput(Logger(ctx), 2, fmt.Sprintf(format, args...))
+}
+
+// ArtifactContext gives tasks the shared artifact store, where derived data
+// such as transcripts and image descriptions is kept.
+func ArtifactContext(artifacts *services.ArtifactStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(artifactsKey, artifacts)
+		ctx.Next()
+	}
+}
+
+// WorkspaceContext lets tasks get a private working directory for their run
+// (see runWorkspace), released when the request is done.
+func WorkspaceContext(workspaces *services.WorkspaceManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(workspacesKey, workspaces)
+		ctx.Next()
+
+		if value, ok := ctx.Get(workspaceKey); ok {
+			workspace := value.(*services.Workspace)
+			workspaces.Release(workspace.Profile, workspace.ID)
+		}
+	}
+}
+
+// runWorkspace returns the workspace of the current run, creating it on first
+// use.
+func runWorkspace(ctx *gin.Context, task string) (*services.Workspace, error) {
+	if value, ok := ctx.Get(workspaceKey); ok {
+		return value.(*services.Workspace), nil
+	}
+
+	value, _ := ctx.Get(workspacesKey)
+	workspaces, ok := value.(*services.WorkspaceManager)
+	if !ok {
+		return nil, fmt.Errorf("no workspace manager configured")
+	}
+
+	workspace, err := workspaces.Acquire(CurrentProfile(ctx).Name, ctx.GetString(runIDKey), task)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Set(workspaceKey, workspace)
+	return workspace, nil
+}
+
+func requestDryRun(ctx *gin.Context, fallback bool) bool {
+	value := ctx.Query("dryRun")
+	if value == "" {
+		value = ctx.GetHeader("X-Dry-Run")
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return enabled
+}
+
+// SkipIfSolved answers with the recorded flag instead of running the task
+// again, unless the request asks for ?force=true or is a dry run.
+func SkipIfSolved(task string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ledger := flagLedger(ctx)
+		if ledger == nil || ctx.Query("force") == "true" || ctx.GetBool(dryRunKey) {
+			ctx.Next()
+			return
+		}
+
+		if flag, ok := ledger.Solved(task); ok {
+			ctx.AbortWithStatusJSON(http.StatusOK, gin.H{
+				"skipped": true,
+				"task":    task,
+				"flag":    flag,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// newCentralaService creates a Centrala client that records flags for the
+// current run, audits its submissions, validates answers against answerRules,
+// reads through the profile's mirror and HTTP client and honours its dry-run
+// setting. ?refresh=true fetches mirrored resources again.
+func newCentralaService(ctx *gin.Context, baseURL, apiKey string, openAIService *services.OpenAiService) *services.CentralaService {
+	return services.NewCentralaService(baseURL, apiKey, openAIService).
+		WithRun(ctx.GetString(runIDKey), flagLedger(ctx)).
+		WithSubmissionLog(submissionLog(ctx)).
+		WithAnswerRegistry(answerRules).
+		WithMirror(centralaMirror(ctx), ctx.Query("refresh") == "true").
+		WithHTTPClient(httpClient(ctx)).
+		WithDryRun(ctx.GetBool(dryRunKey))
+}
+
+// respond writes a task's result. In dry-run mode the withheld report payloads
+// and their diffs against the accepted answers are included.
+func respond(ctx *gin.Context, centralaService *services.CentralaService, body gin.H) {
+	if centralaService.DryRun() {
+		body["dryRun"] = centralaService.DryRunReports()
+	}
+	ctx.JSON(http.StatusOK, body)
+}
+
+// respondRejected answers a run whose report Centrala rejected with a
+// *CentralaError: body, which should carry the parsed response, is sent with
+// the error as 422 so the message and hints reach the caller. It reports false
+// for any other error, which the task handles itself.
+func respondRejected(ctx *gin.Context, centralaService *services.CentralaService, err error, body gin.H) bool {
+	rejection, ok := services.AsCentralaError(err)
+	if !ok {
+		return false
+	}
+
+	Logger(ctx).Warn("Report rejected", "task", rejection.Task, "code", rejection.Code)
+	body["error"] = rejection.Error()
+	if centralaService.DryRun() {
+		body["dryRun"] = centralaService.DryRunReports()
+	}
+	ctx.JSON(http.StatusUnprocessableEntity, body)
+	return true
+}
+
+// recordFlags stores flags found in responses that do not go through
+// CentralaService, such as the XYZ verify endpoint.
+func recordFlags(ctx *gin.Context, task string, answer interface{}, texts ...string) {
+	ledger := flagLedger(ctx)
+	if ledger == nil {
+		return
+	}
+	if _, err := ledger.Record(task, ctx.GetString(runIDKey), answer, texts...); err != nil {
+		Logger(ctx).Error("Failed to record flags", "task", task, "error", err)
+	}
+}
+
+// CurrentProfile returns the profile selected for the request by RunContext.
+func CurrentProfile(ctx *gin.Context) *services.Profile {
+	value, exists := ctx.Get(profileKey)
+	if !exists {
+		return nil
+	}
+	profile, _ := value.(*services.Profile)
+	return profile
+}
+
+func centralaMirror(ctx *gin.Context) *services.CentralaMirror {
+	if profile := CurrentProfile(ctx); profile != nil {
+		return profile.Mirror
+	}
+	return nil
+}
+
+func httpClient(ctx *gin.Context) *services.HTTPClient {
+	if profile := CurrentProfile(ctx); profile != nil && profile.HTTPClient != nil {
+		return profile.HTTPClient
+	}
+	return services.DefaultHTTPClient()
+}
+
+// getRequestBody returns the body of url, using the profile's HTTP client so
+// responses are cached apart from other profiles.
+func getRequestBody(ctx *gin.Context, url string) (string, error) {
+	body, err := httpClient(ctx).Get(ctx.Request.Context(), url)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func artifactStore(ctx *gin.Context) *services.ArtifactStore {
+	value, _ := ctx.Get(artifactsKey)
+	artifacts, _ := value.(*services.ArtifactStore)
+	return artifacts
+}
+
+func flagLedger(ctx *gin.Context) *services.FlagLedger {
+	if profile := CurrentProfile(ctx); profile != nil {
+		return profile.Ledger
+	}
+	return nil
+}
+
+func submissionLog(ctx *gin.Context) *services.SubmissionLog {
+	if profile := CurrentProfile(ctx); profile != nil {
+		return profile.Submissions
+	}
+	return nil
+}
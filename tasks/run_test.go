@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lumenn/bifrost-agent/services"
+)
+
+func TestRespondRejectedCarriesEmulatorHints(t *testing.T) {
+	fixtures, err := services.LoadCentralaFixtures("../fixtures/centrala")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emulator, err := services.NewCentralaEmulator(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	// The emulator rejects the answer with a 400, as Centrala does.
+	centralaService := services.NewCentralaService(server.URL, fixtures.APIKey, nil)
+	response, err := centralaService.PostReport("loop", "WARSZAWA")
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/solveTask", nil)
+	if !respondRejected(ctx, centralaService, err, gin.H{"response": response}) {
+		t.Fatalf("respondRejected() = false for %v", err)
+	}
+
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", recorder.Code)
+	}
+	var body struct {
+		Error    string                  `json:"error"`
+		Response services.EntityResponse `json:"response"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Barbara was last seen with Rafal"}
+	if !reflect.DeepEqual(body.Response.Hints, want) || body.Error == "" {
+		t.Errorf("body = %+v, want the hints %v and the error", body, want)
+	}
+}
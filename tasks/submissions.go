@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lumenn/bifrost-agent/services"
+)
+
+// ResubmitReport sends the answer of a logged submission to /report again, as
+// part of the current run. Answers are logged redacted, so one that lost a
+// secret is refused rather than sent with the placeholder in its place.
+func ResubmitReport(ctx *gin.Context, centralaBaseURL, centralaAPIKey string) {
+	submissions := submissionLog(ctx)
+	if submissions == nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "submission log not configured"})
+		return
+	}
+
+	original, err := submissions.Get(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if services.ContainsRedacted(original.Answer) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("submission %s was logged with redacted values and cannot be resubmitted", original.ID)})
+		return
+	}
+
+	logf(ctx, "[INFO] Resubmitting submission %s for task %s", original.ID, original.Task)
+
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+	response, err := centralaService.PostReport(original.Task, original.Answer)
+	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"original": original,
+			"response": response,
+		}) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to resubmit report: %v", err)})
+		return
+	}
+
+	respond(ctx, centralaService, gin.H{
+		"original": original,
+		"response": response,
+	})
+}
@@ -12,16 +12,21 @@ import (
 	"github.com/lumenn/bifrost-agent/services"
 )
 
-func SolveTask1(ctx *gin.Context, llmService services.LLMService, baseURL string) {
+func SolveTask1(ctx *gin.Context, llmService services.LLMService, baseURL, username, password string) {
 	if baseURL == "" {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Base URL is not set"})
 		return
 	}
 
+	if username == "" || password == "" {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Form credentials are not set"})
+		return
+	}
+
 	llmService.SetSystemPrompt("Please provide answer to given question only, using format: { \"question\": \"question\", \"answer\": \"answer\" }")
 
 	urlAddress := baseURL + "/"
-	body, err := services.GetRequestBody(urlAddress)
+	body, err := getRequestBody(ctx, urlAddress)
 
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get website content."})
@@ -61,8 +66,8 @@ func SolveTask1(ctx *gin.Context, llmService services.LLMService, baseURL string
 
 	res, err := services.PostForm(urlAddress, url.Values{
 		"answer":   {fmt.Sprintf("%d", openAIResponse.Answer)},
-		"username": {"tester"},
-		"password": {"574e112a"},
+		"username": {username},
+		"password": {password},
 	})
 
 	if err != nil {
@@ -70,5 +75,7 @@ func SolveTask1(ctx *gin.Context, llmService services.LLMService, baseURL string
 		return
 	}
 
+	recordFlags(ctx, "login", openAIResponse.Answer, res)
+
 	ctx.JSON(http.StatusOK, gin.H{"response": string(res)})
 }
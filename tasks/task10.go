@@ -2,9 +2,7 @@ package tasks
 
 import (
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -13,28 +11,28 @@ import (
 	"github.com/lumenn/bifrost-agent/services"
 )
 
-func SolveTask10(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	log.Println("[INFO] Starting Task10 execution")
+func SolveTask10(ctx *gin.Context, llmService services.LLMService, embedder services.Embedder, centralaBaseURL, centralaAPIKey string) {
+	logf(ctx, "[INFO] Starting Task10 execution")
 
-	workDir := "/tmp/task10"
-	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create work directory: %v", err)})
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+
+	workspace, err := runWorkspace(ctx, "task10")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
 		return
 	}
+	workDir := workspace.Dir
 
-	// Download and extract initial zip file
-	zipPath := filepath.Join(workDir, "files.zip")
-	downloadURL := fmt.Sprintf("%s/dane/pliki_z_fabryki.zip", centralaBaseURL)
-
-	if !services.FileExists(zipPath) {
-		if err := services.DownloadFile(downloadURL, zipPath); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download files: %v", err)})
-			return
-		}
+	// Download (or reuse the mirrored copy of) the initial zip file
+	zipPath, err := centralaService.DanePath("pliki_z_fabryki.zip")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download files: %v", err)})
+		return
 	}
+	defer centralaService.ReleaseDane(zipPath)
 
 	// Extract the initial zip file
-	if err := services.UnzipFile(zipPath, workDir, nil); err != nil {
+	if _, err := services.UnzipFile(zipPath, workDir, nil); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to extract files: %v", err)})
 		return
 	}
@@ -42,30 +40,32 @@ func SolveTask10(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	// Extract the weapons_tests.zip with password
 	weaponsZipPath := filepath.Join(workDir, "weapons_tests.zip")
 	weaponsDir := filepath.Join(workDir, "weapons")
-	if err := services.UnzipFile(weaponsZipPath, weaponsDir, &[]string{"1670"}[0]); err != nil {
+	if _, err := services.UnzipFile(weaponsZipPath, weaponsDir, &[]string{"1670"}[0]); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to extract weapons tests: %v", err)})
 		return
 	}
 
 	// Initialize vector database service
-	vectorDB, err := services.NewQdrantService()
+	vectorDB, err := services.NewQdrantService(embedder)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize vector database: %v", err)})
 		return
 	}
 
-	// Index all reports from weapons directory
-	files, err := services.ListFiles(filepath.Join(weaponsDir, "do-not-share"))
+	// Index all reports found anywhere in the weapons archive
+	entries, err := services.WalkFiles(weaponsDir, services.WalkOptions{Include: documentGlobs})
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list files: %v", err)})
 		return
 	}
 
-	// Process and index each file
-	for _, file := range files {
-		content, err := os.ReadFile(file)
+	// Collect every report, then embed and index them in one batch
+	extractors := services.NewContentExtractors(nil)
+	var documents []services.Document
+	for _, file := range services.EntryPaths(entries) {
+		content, err := extractors.ExtractText(file)
 		if err != nil {
-			log.Printf("[ERROR] Failed to read file %s: %v", file, err)
+			logf(ctx, "[ERROR] Failed to read file %s: %v", file, err)
 			continue
 		}
 
@@ -73,21 +73,24 @@ func SolveTask10(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 		date, err := extractDateFromContent(string(file))
 		date = strings.ReplaceAll(date, "_", "-")
 		if err != nil {
-			log.Printf("[ERROR] Failed to extract date from %s: %v", file, err)
+			logf(ctx, "[ERROR] Failed to extract date from %s: %v", file, err)
 			continue
 		}
 
-		// Index the document with metadata
-		metadata := map[string]interface{}{
-			"date":     date,
-			"filename": filepath.Base(file),
-			"path":     file,
-		}
+		documents = append(documents, services.Document{
+			ID:      filepath.Base(file),
+			Content: content,
+			Metadata: map[string]interface{}{
+				"date":     date,
+				"filename": filepath.Base(file),
+				"path":     file,
+			},
+		})
+	}
 
-		if err := vectorDB.IndexDocument(string(content), metadata); err != nil {
-			log.Printf("[ERROR] Failed to index document %s: %v", file, err)
-			continue
-		}
+	if err := vectorDB.IndexDocuments(documents); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to index documents: %v", err)})
+		return
 	}
 
 	// Search for weapon prototype theft
@@ -109,26 +112,25 @@ func SolveTask10(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	date := metadata.GetStructValue().GetFields()["date"].GetStringValue()
 	content := value["content"]
 
-	log.Println(metadata, content)
+	logf(ctx, "%v %v", metadata, content)
 
 	// Send report to centrala
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	reportRequest := map[string]interface{}{
-		"task":   "wektory",
-		"apikey": centralaAPIKey,
-		"answer": date,
-	}
-
-	response, err := services.PostJSON(reportURL, reportRequest)
+	response, err := centralaService.PostReport("wektory", date)
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"answer":   date,
+			"response": response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send report: %v", err)})
 		return
 	}
 
-	log.Println("[INFO] Task10 completed successfully")
-	ctx.JSON(http.StatusOK, gin.H{
-		"reportRequest": reportRequest,
-		"response":      response,
+	logf(ctx, "[INFO] Task10 completed successfully")
+	respond(ctx, centralaService, gin.H{
+		"answer":   date,
+		"response": response,
 	})
 }
 
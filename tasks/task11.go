@@ -1,9 +1,7 @@
 package tasks
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,13 +10,8 @@ import (
 	"github.com/lumenn/bifrost-agent/services"
 )
 
-type DBResponse struct {
-	Reply []map[string]interface{} `json:"reply"`
-	Error string                   `json:"error"`
-}
-
 func SolveTask11(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	log.Println("[INFO] Starting Task11 execution")
+	logf(ctx, "[INFO] Starting Task11 execution")
 
 	// Set up LLM for database exploration
 	llmService.SetSystemPrompt(`You are a database expert. Your task is to analyze database structure and content.
@@ -26,11 +19,12 @@ func SolveTask11(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 		The query should help explore the database structure or find specific information.
 		Consider relationships between tables and use JOINs when necessary.`)
 
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+
 	// Initialize database explorer
 	explorer := &DatabaseExplorer{
-		baseURL: centralaBaseURL,
-		apiKey:  centralaAPIKey,
-		llm:     llmService,
+		centrala: centralaService,
+		llm:      llmService,
 	}
 
 	// First, get the list of tables
@@ -45,7 +39,7 @@ func SolveTask11(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	for _, table := range tables {
 		structure, err := explorer.getTableStructure(table)
 		if err != nil {
-			log.Printf("[WARN] Failed to get structure for table %s: %v", table, err)
+			logf(ctx, "[WARN] Failed to get structure for table %s: %v", table, err)
 			continue
 		}
 		tableStructures[table] = structure
@@ -97,60 +91,42 @@ func SolveTask11(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	}
 
 	// Send report to centrala
-	reportRequest := map[string]interface{}{
-		"task":   "database",
-		"apikey": centralaAPIKey,
-		"answer": datacenterIDs,
-	}
-
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	response, err := services.PostJSON(reportURL, reportRequest)
+	response, err := centralaService.PostReport("database", datacenterIDs)
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"finalQuery":     query,
+			"datacenterIDs":  datacenterIDs,
+			"reportResponse": response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send report: %v", err)})
 		return
 	}
 
-	log.Println("[INFO] Task11 completed successfully")
-	ctx.JSON(http.StatusOK, gin.H{
+	logf(ctx, "[INFO] Task11 completed successfully")
+	respond(ctx, centralaService, gin.H{
 		"tables":         tables,
 		"tableStructure": tableStructures,
 		"finalQuery":     query,
 		"result":         result,
 		"datacenterIDs":  datacenterIDs,
-		"reportRequest":  reportRequest,
 		"reportResponse": response,
 	})
 }
 
 type DatabaseExplorer struct {
-	baseURL string
-	apiKey  string
-	llm     services.LLMService
+	centrala *services.CentralaService
+	llm      services.LLMService
 }
 
 func (e *DatabaseExplorer) executeQuery(query string) ([]map[string]interface{}, error) {
-	request := map[string]interface{}{
-		"task":   "database",
-		"apikey": e.apiKey,
-		"query":  query,
-	}
-
-	url := fmt.Sprintf("%s/apidb", e.baseURL)
-	response, err := services.PostJSON(url, request)
+	rows, err := e.centrala.QueryRows(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 
-	var dbResponse DBResponse
-	if err := json.Unmarshal([]byte(response), &dbResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if dbResponse.Error != "OK" {
-		return nil, fmt.Errorf("database error: %s", dbResponse.Error)
-	}
-
-	return dbResponse.Reply, nil
+	return rows, nil
 }
 
 func (e *DatabaseExplorer) listTables() ([]string, error) {
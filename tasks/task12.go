@@ -3,8 +3,6 @@ package tasks
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -67,9 +65,9 @@ func getFirstName(fullName string) string {
 }
 
 func SolveTask12(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	log.Println("[DEBUG] Starting Task12 execution with centralaBaseURL:", centralaBaseURL)
+	logf(ctx, "[DEBUG] Starting Task12 execution with centralaBaseURL: %s", centralaBaseURL)
 
-	centralaService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, nil)
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
 	connections := ConnectionMap{
 		PeopleToPlaces:  make(map[string]ConnectionInfo),
 		PlacesToPeople:  make(map[string]ConnectionInfo),
@@ -78,17 +76,22 @@ func SolveTask12(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 		UnqueriedPeople: make([]string, 0),
 		UnqueriedPlaces: make([]string, 0),
 	}
-	log.Println("[DEBUG] Initialized connection maps")
+	logf(ctx, "[DEBUG] Initialized connection maps")
 
 	// Download the note
-	log.Printf("[DEBUG] Attempting to download note from: %s/dane/barbara.txt", centralaBaseURL)
-	noteContent, err := downloadNote(fmt.Sprintf("%s/dane/barbara.txt", centralaBaseURL))
+	logf(ctx, "[DEBUG] Attempting to download note from: %s", centralaService.DaneURL("barbara.txt"))
+	workspace, err := runWorkspace(ctx, "task12")
 	if err != nil {
-		log.Printf("[ERROR] Failed to download note: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
+		return
+	}
+	noteContent, err := downloadNote(centralaService, workspace.Path("barbara.txt"))
+	if err != nil {
+		logf(ctx, "[ERROR] Failed to download note: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download note: %v", err)})
 		return
 	}
-	log.Printf("[DEBUG] Successfully downloaded note (%d bytes)", len(noteContent))
+	logf(ctx, "[DEBUG] Successfully downloaded note (%d bytes)", len(noteContent))
 
 	// Set system prompt for the investigation
 	llmService.SetSystemPrompt(`You are a detective investigating Barbara's location. You have access to these tools:
@@ -129,17 +132,17 @@ func SolveTask12(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	// Start the investigation loop
 	var foundFlag bool
 	maxSteps := 200 // prevent infinite loops
-	log.Printf("[DEBUG] Starting investigation loop with maximum %d steps", maxSteps)
+	logf(ctx, "[DEBUG] Starting investigation loop with maximum %d steps", maxSteps)
 
 	for steps := 0; steps < maxSteps && !foundFlag; steps++ {
 		// Force an answer attempt every 10 steps
 		forceAnswer := steps > 0 && steps%10 == 0
 		if forceAnswer {
-			log.Printf("[DEBUG] Step %d: Forcing answer attempt", steps+1)
+			logf(ctx, "[DEBUG] Step %d: Forcing answer attempt", steps+1)
 		}
 
-		log.Printf("[DEBUG] Step %d/%d - Building state YAML", steps+1, maxSteps)
-		log.Printf("[DEBUG] Current connections - People: %d, Places: %d",
+		logf(ctx, "[DEBUG] Step %d/%d - Building state YAML", steps+1, maxSteps)
+		logf(ctx, "[DEBUG] Current connections - People: %d, Places: %d",
 			len(connections.PeopleToPlaces), len(connections.PlacesToPeople))
 
 		// Prepare the current state for LLM
@@ -180,25 +183,25 @@ Current state:
 
 		// Ask LLM for next action
 		decisionPrompt := fmt.Sprintf("Based on the current state, what should we do next?\n%s", stateYAML)
-		log.Printf("[DEBUG] Sending decision prompt to LLM (prompt length: %d)", len(decisionPrompt))
-		log.Printf("[DEBUG] Full prompt:\n%s", decisionPrompt)
+		logf(ctx, "[DEBUG] Sending decision prompt to LLM (prompt length: %d)", len(decisionPrompt))
+		logf(ctx, "[DEBUG] Full prompt:\n%s", decisionPrompt)
 		response, err := llmService.SendChatMessage(decisionPrompt)
 		if err != nil {
-			log.Printf("[ERROR] LLM request failed: %v", err)
+			logf(ctx, "[ERROR] LLM request failed: %v", err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get LLM decision: %v", err)})
 			return
 		}
-		log.Printf("[DEBUG] Received LLM response (length: %d):\n%s", len(response), response)
+		logf(ctx, "[DEBUG] Received LLM response (length: %d):\n%s", len(response), response)
 
 		var decision LLMDecision
 		if err := json.Unmarshal([]byte(response), &decision); err != nil {
-			log.Printf("[ERROR] Failed to parse LLM response '%s': %v", response, err)
+			logf(ctx, "[ERROR] Failed to parse LLM response '%s': %v", response, err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to parse LLM response: %v", err)})
 			return
 		}
 
-		log.Printf("[INFO] Step %d - Action: %s, Query: %s", steps+1, decision.Action, decision.Query)
-		log.Printf("[INFO] Reasoning: %s", decision.Reasoning)
+		logf(ctx, "[INFO] Step %d - Action: %s, Query: %s", steps+1, decision.Action, decision.Query)
+		logf(ctx, "[INFO] Reasoning: %s", decision.Reasoning)
 
 		switch decision.Action {
 		case "ask_people":
@@ -206,22 +209,22 @@ Current state:
 				fmt.Sprintf("Step %d: Querying person %s - %s",
 					steps+1, normalizeString(getFirstName(decision.Query)), decision.Reasoning))
 			normalizedPerson := normalizeString(getFirstName(decision.Query))
-			log.Printf("[DEBUG] Normalized person name: %s -> %s", decision.Query, normalizedPerson)
+			logf(ctx, "[DEBUG] Normalized person name: %s -> %s", decision.Query, normalizedPerson)
 			if info, exists := connections.PeopleToPlaces[normalizedPerson]; exists && info.Queried {
-				log.Printf("[DEBUG] Skipping already queried person: %s", normalizedPerson)
+				logf(ctx, "[DEBUG] Skipping already queried person: %s", normalizedPerson)
 				continue
 			}
 			removeFromUnqueried(normalizedPerson, &connections.UnqueriedPeople)
 
-			log.Printf("[DEBUG] Querying /people endpoint for: %s", normalizedPerson)
-			data, err := centralaService.QueryAPI("/people", normalizedPerson)
+			logf(ctx, "[DEBUG] Querying /people endpoint for: %s", normalizedPerson)
+			response, err := centralaService.People(normalizedPerson)
 			if err != nil {
-				log.Printf("[WARN] Failed to query person data for %s: %v", normalizedPerson, err)
+				logf(ctx, "[WARN] Failed to query person data for %s: %v", normalizedPerson, err)
 				continue
 			}
 
-			places := strings.Fields(data.(services.EntityResponse).Message)
-			log.Printf("[DEBUG] Received %d places for person %s", len(places), normalizedPerson)
+			places := response.Names
+			logf(ctx, "[DEBUG] Received %d places for person %s", len(places), normalizedPerson)
 			normalizedPlaces := make([]string, 0, len(places))
 			for _, place := range places {
 				normalizedPlace := normalizeString(place)
@@ -232,29 +235,29 @@ Current state:
 				Links:   normalizedPlaces,
 				Queried: true,
 			}
-			log.Printf("[DEBUG] Updated connections for %s with places: %v", normalizedPerson, normalizedPlaces)
+			logf(ctx, "[DEBUG] Updated connections for %s with places: %v", normalizedPerson, normalizedPlaces)
 
 		case "ask_places":
 			connections.ReasoningLog = append(connections.ReasoningLog,
 				fmt.Sprintf("Step %d: Querying place %s - %s",
 					steps+1, normalizeString(decision.Query), decision.Reasoning))
 			normalizedPlace := normalizeString(decision.Query)
-			log.Printf("[DEBUG] Normalized place name: %s -> %s", decision.Query, normalizedPlace)
+			logf(ctx, "[DEBUG] Normalized place name: %s -> %s", decision.Query, normalizedPlace)
 			if info, exists := connections.PlacesToPeople[normalizedPlace]; exists && info.Queried {
-				log.Printf("[DEBUG] Skipping already queried place: %s", normalizedPlace)
+				logf(ctx, "[DEBUG] Skipping already queried place: %s", normalizedPlace)
 				continue
 			}
 			removeFromUnqueried(normalizedPlace, &connections.UnqueriedPlaces)
 
-			log.Printf("[DEBUG] Querying /places endpoint for: %s", normalizedPlace)
-			data, err := centralaService.QueryAPI("/places", normalizedPlace)
+			logf(ctx, "[DEBUG] Querying /places endpoint for: %s", normalizedPlace)
+			response, err := centralaService.Places(normalizedPlace)
 			if err != nil {
-				log.Printf("[WARN] Failed to query place data for %s: %v", normalizedPlace, err)
+				logf(ctx, "[WARN] Failed to query place data for %s: %v", normalizedPlace, err)
 				continue
 			}
 
-			people := strings.Fields(data.(services.EntityResponse).Message)
-			log.Printf("[DEBUG] Received %d people for place %s", len(people), normalizedPlace)
+			people := response.Names
+			logf(ctx, "[DEBUG] Received %d people for place %s", len(people), normalizedPlace)
 			normalizedPeople := make([]string, 0, len(people))
 			for _, person := range people {
 				normalizedPerson := normalizeString(getFirstName(person))
@@ -265,48 +268,50 @@ Current state:
 				Links:   normalizedPeople,
 				Queried: true,
 			}
-			log.Printf("[DEBUG] Updated connections for %s with people: %v", normalizedPlace, normalizedPeople)
+			logf(ctx, "[DEBUG] Updated connections for %s with people: %v", normalizedPlace, normalizedPeople)
 
 		case "reason":
 			connections.ReasoningLog = append(connections.ReasoningLog,
 				fmt.Sprintf("Step %d: Analysis - %s",
 					steps+1, decision.Reasoning))
-			log.Printf("[DEBUG] Processing reasoning step: %s", decision.Reasoning)
+			logf(ctx, "[DEBUG] Processing reasoning step: %s", decision.Reasoning)
 
 		case "answer":
 			connections.ReasoningLog = append(connections.ReasoningLog,
 				fmt.Sprintf("Step %d: Attempting answer %s - %s",
 					steps+1, normalizeString(decision.Answer), decision.Reasoning))
 			if decision.Answer == "" {
-				log.Printf("[WARN] Empty answer received")
+				logf(ctx, "[WARN] Empty answer received")
 				continue
 			}
 
 			answer := normalizeString(decision.Answer)
 			if connections.WrongGuesses[answer] {
-				log.Printf("[DEBUG] Skipping already tried and incorrect answer: %s", answer)
+				logf(ctx, "[DEBUG] Skipping already tried and incorrect answer: %s", answer)
 				continue
 			}
 
-			log.Printf("[DEBUG] Attempting answer with normalized city name: %s -> %s", decision.Answer, answer)
+			logf(ctx, "[DEBUG] Attempting answer with normalized city name: %s -> %s", decision.Answer, answer)
 
-			reportRequest := map[string]interface{}{
-				"task":   "loop",
-				"apikey": centralaAPIKey,
-				"answer": answer,
-			}
-
-			log.Printf("[DEBUG] Sending report request to %s/report", centralaBaseURL)
-			reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-			reportResponse, err := services.PostJSON(reportURL, reportRequest)
-			if err != nil {
-				log.Printf("[WARN] Failed to send report: %v", err)
+			reportResponse, err := centralaService.PostReport("loop", answer)
+			if _, rejected := services.AsCentralaError(err); err != nil && !rejected {
+				logf(ctx, "[WARN] Failed to send report: %v", err)
 				continue
 			}
-			log.Printf("[DEBUG] Received report response: %s", reportResponse)
+			logf(ctx, "[DEBUG] Received report response: %+v", reportResponse)
+
+			// A dry run cannot tell right from wrong, so stop at the first guess.
+			if centralaService.DryRun() {
+				respond(ctx, centralaService, gin.H{
+					"note":        noteContent,
+					"connections": connections,
+					"answer":      answer,
+				})
+				return
+			}
 
-			if strings.Contains(reportResponse, "FLG:") {
-				log.Printf("[DEBUG] Success! Found flag in response: %s", reportResponse)
+			if err == nil && strings.Contains(reportResponse.Message, "FLG:") {
+				logf(ctx, "[DEBUG] Success! Found flag in response: %s", reportResponse.Message)
 				foundFlag = true
 				ctx.JSON(http.StatusOK, gin.H{
 					"note":           noteContent,
@@ -318,36 +323,30 @@ Current state:
 			}
 
 			connections.WrongGuesses[answer] = true
-			log.Printf("[INFO] Incorrect answer: %s", answer)
+			logf(ctx, "[INFO] Incorrect answer: %s", answer)
 		}
 	}
 
 	if !foundFlag {
-		log.Printf("[ERROR] Investigation failed after %d steps", maxSteps)
+		logf(ctx, "[ERROR] Investigation failed after %d steps", maxSteps)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find Barbara's location after maximum steps"})
 		return
 	}
 }
 
-func downloadNote(url string) (string, error) {
-	resp, err := http.Get(url)
+func downloadNote(centralaService *services.CentralaService, notePath string) (string, error) {
+	content, err := centralaService.GetDane("barbara.txt")
 	if err != nil {
 		return "", fmt.Errorf("failed to download note: %w", err)
 	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read note content: %w", err)
-	}
 
-	// Save to /tmp
-	err = os.WriteFile("/tmp/barbara.txt", content, 0644)
+	// Keep a copy in the run's workspace
+	err = os.WriteFile(notePath, []byte(content), 0644)
 	if err != nil {
-		return "", fmt.Errorf("failed to save note to /tmp: %w", err)
+		return "", fmt.Errorf("failed to save note: %w", err)
 	}
 
-	return string(content), nil
+	return content, nil
 }
 
 func formatConnectionsToYAML(m map[string]ConnectionInfo) string {
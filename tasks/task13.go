@@ -2,9 +2,7 @@ package tasks
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
@@ -73,7 +71,7 @@ func findShortestPath(ctx context.Context, session neo4j.SessionWithContext) ([]
 
 func SolveTask13(ctx *gin.Context, centralaBaseURL, centralaAPIKey string) {
 	// Create CentralaService instance
-	centralService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, nil) // nil for openAIService as it's not needed
+	centralService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil) // nil for openAIService as it's not needed
 
 	// Initialize Neo4j driver
 	ctxBg := context.Background()
@@ -196,7 +194,7 @@ func SolveTask13(ctx *gin.Context, centralaBaseURL, centralaAPIKey string) {
 		}
 	}
 
-	log.Printf("Successfully imported %d users and %d connections to Neo4j",
+	logf(ctx, "Successfully imported %d users and %d connections to Neo4j",
 		len(users), len(connections))
 
 	// Find shortest path between Rafał and Barbara
@@ -210,28 +208,21 @@ func SolveTask13(ctx *gin.Context, centralaBaseURL, centralaAPIKey string) {
 	pathString := strings.Join(path, ", ")
 
 	// Send report to centrala
-	request := map[string]interface{}{
-		"task":   "connections",
-		"apikey": centralaAPIKey,
-		"answer": pathString,
-	}
-
-	response, err := services.PostJSON(fmt.Sprintf("%s/report", centralaBaseURL), request)
+	response, err := centralService.PostReport("connections", pathString)
 	if err != nil {
+		if respondRejected(ctx, centralService, err, gin.H{
+			"answer":   pathString,
+			"response": response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to send report: %v", err)})
 		return
 	}
 
-	// Parse response into JSON
-	var jsonResponse interface{}
-	if err := json.Unmarshal([]byte(response), &jsonResponse); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to parse response: %v", err)})
-		return
-	}
-
-	ctx.JSON(http.StatusOK, gin.H{
-		"message":      fmt.Sprintf("Successfully sent path report: %s", pathString),
-		"request_body": request,
-		"response":     jsonResponse,
+	respond(ctx, centralService, gin.H{
+		"message":  fmt.Sprintf("Successfully sent path report: %s", pathString),
+		"answer":   pathString,
+		"response": response,
 	})
 }
@@ -3,14 +3,14 @@ package tasks
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lumenn/bifrost-agent/services"
+	openai "github.com/sashabaranov/go-openai"
 )
 
 type AnalyzedImage struct {
@@ -83,16 +83,23 @@ func getFirstKey(m map[string]*AnalyzedImage) string {
 }
 
 func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	os.MkdirAll("/tmp/task14", 0755)
 	openAIService, ok := llmService.(*services.OpenAiService)
 	if !ok {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "LLM service must be OpenAI"})
 		return
 	}
 
-	centralaService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, openAIService)
+	workspace, err := runWorkspace(ctx, "task14")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
+		return
+	}
 
-	report, err := centralaService.PostReport("photos", "START")
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
+	// Photos are kept in the artifact store, so every version stays available
+	artifacts := artifactStore(ctx)
+
+	report, err := centralaService.SendCommand("photos", "START")
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,7 +128,7 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			- If you are asked to use specific language - use it.
 		`)
 
-	imageFiles := extractFiles(report.Message, centralaBaseURL)
+	imageFiles := extractFiles(ctx, report.Message, centralaService, artifacts, workspace.Dir)
 	reasoningHistory := make([]string, 0)
 	hints := []string{}
 	iteration := 0
@@ -161,7 +168,7 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 		cleanedResponse := clearFromMarkdown(response)
 		err = json.Unmarshal([]byte(cleanedResponse), &llmResponse)
 		if err != nil {
-			log.Printf("[ERROR] Failed to unmarshal LLM response. Original: %s\nCleaned: %s\nError: %v",
+			logf(ctx, "[ERROR] Failed to unmarshal LLM response. Original: %s\nCleaned: %s\nError: %v",
 				response, cleanedResponse, err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -170,13 +177,13 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 
 		switch llmResponse.NextTool {
 		case "DARKEN":
-			darkenResponse, err := centralaService.PostReport("photos", fmt.Sprintf("DARKEN %s", llmResponse.Filenames[0]))
+			darkenResponse, err := centralaService.SendCommand("photos", fmt.Sprintf("DARKEN %s", llmResponse.Filenames[0]))
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
-			newImages := extractFiles(darkenResponse.Message, centralaBaseURL)
+			newImages := extractFiles(ctx, darkenResponse.Message, centralaService, artifacts, workspace.Dir)
 			imageFiles = Merge(imageFiles, newImages)
 
 			reasoningHistory = append(reasoningHistory, fmt.Sprintf("Iteration %d: DARKEN %s\n%s", iteration, llmResponse.Filenames[0], darkenResponse.Message))
@@ -185,13 +192,13 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			imageFiles[llmResponse.Filenames[0]].DarkenedImage = newImages[getFirstKey(newImages)]
 			continue
 		case "REPAIR":
-			repairResponse, err := centralaService.PostReport("photos", fmt.Sprintf("REPAIR %s", llmResponse.Filenames[0]))
+			repairResponse, err := centralaService.SendCommand("photos", fmt.Sprintf("REPAIR %s", llmResponse.Filenames[0]))
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
-			newImages := extractFiles(repairResponse.Message, centralaBaseURL)
+			newImages := extractFiles(ctx, repairResponse.Message, centralaService, artifacts, workspace.Dir)
 			imageFiles = Merge(imageFiles, newImages)
 
 			reasoningHistory = append(reasoningHistory, fmt.Sprintf("Iteration %d: REPAIR %s\n%s", iteration, llmResponse.Filenames[0], repairResponse.Message))
@@ -200,13 +207,13 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			imageFiles[llmResponse.Filenames[0]].RepairedImage = newImages[getFirstKey(newImages)]
 			continue
 		case "BRIGHTEN":
-			brightenResponse, err := centralaService.PostReport("photos", fmt.Sprintf("BRIGHTEN %s", llmResponse.Filenames[0]))
+			brightenResponse, err := centralaService.SendCommand("photos", fmt.Sprintf("BRIGHTEN %s", llmResponse.Filenames[0]))
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
-			newImages := extractFiles(brightenResponse.Message, centralaBaseURL)
+			newImages := extractFiles(ctx, brightenResponse.Message, centralaService, artifacts, workspace.Dir)
 			imageFiles = Merge(imageFiles, newImages)
 
 			reasoningHistory = append(reasoningHistory, fmt.Sprintf("Iteration %d: BRIGHTEN %s\n%s", iteration, llmResponse.Filenames[0], brightenResponse.Message))
@@ -215,7 +222,11 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			imageFiles[llmResponse.Filenames[0]].BrightenedImage = newImages[getFirstKey(newImages)]
 			continue
 		case "DESCRIBE":
-			describeResponse, err := openAIService.AnalyzeImages(`Provide detailed description of Barbara, please focus on: `+strings.Join(hints, ", "), imageFiles[llmResponse.Filenames[0]].FilePath)
+			describeResponse, err := openAIService.AnalyzeImages(services.ImageAnalysisRequest{
+				Prompt: `Provide detailed description of Barbara, please focus on: ` + strings.Join(hints, ", "),
+				Images: services.ImageFiles(imageFiles[llmResponse.Filenames[0]].FilePath),
+				Detail: openai.ImageURLDetailHigh,
+			})
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
@@ -225,7 +236,7 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			cleanedDescribeResponse := clearFromMarkdown(describeResponse)
 			unmarshalErr := json.Unmarshal([]byte(cleanedDescribeResponse), &unmarshaledDescribeResponse)
 			if unmarshalErr != nil {
-				log.Printf("[ERROR] Failed to unmarshal describe response. Original: %s\nCleaned: %s\nError: %v",
+				logf(ctx, "[ERROR] Failed to unmarshal describe response. Original: %s\nCleaned: %s\nError: %v",
 					describeResponse, cleanedDescribeResponse, unmarshalErr)
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": unmarshalErr.Error()})
 				return
@@ -240,8 +251,12 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 				filePaths = append(filePaths, imageFiles[filename].FilePath)
 			}
 
-			checkResponse, err := openAIService.AnalyzeImages(fmt.Sprintf(`
-			Przygotuj dokładny opis postaci w języku Polskim, skup się w szczególności na cechach wyróżniających, %s`, strings.Join(report.Hints, ", ")), filePaths...)
+			checkResponse, err := openAIService.AnalyzeImages(services.ImageAnalysisRequest{
+				Prompt: fmt.Sprintf(`
+			Przygotuj dokładny opis postaci w języku Polskim, skup się w szczególności na cechach wyróżniających, %s`, strings.Join(report.Hints, ", ")),
+				Images: services.ImageFiles(filePaths...),
+				Detail: openai.ImageURLDetailHigh,
+			})
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
@@ -258,24 +273,32 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 			cleanedTranslateResponse := clearFromMarkdown(translateResponse)
 			unmarshalErr := json.Unmarshal([]byte(cleanedTranslateResponse), &unmarshaledCheckResponse)
 			if unmarshalErr != nil {
-				log.Printf("[ERROR] Failed to unmarshal check response. Original: %s\nCleaned: %s\nError: %v",
+				logf(ctx, "[ERROR] Failed to unmarshal check response. Original: %s\nCleaned: %s\nError: %v",
 					checkResponse, cleanedTranslateResponse, unmarshalErr)
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": unmarshalErr.Error()})
 				return
 			}
 
+			// A rejected description still carries hints for the next attempt.
 			centralaResponse, err := centralaService.PostReport("photos", unmarshaledCheckResponse.Description)
-			if err != nil {
+			if centralaErr, rejected := services.AsCentralaError(err); rejected {
+				logf(ctx, "[INFO] Description rejected: %v", centralaErr)
+			} else if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
+			if centralaService.DryRun() {
+				respond(ctx, centralaService, gin.H{"description": unmarshaledCheckResponse.Description})
+				return
+			}
+
 			if strings.Contains(centralaResponse.Message, "{{FLG:") {
 				ctx.JSON(http.StatusOK, gin.H{"description": centralaResponse.Message})
 				return
 			}
 
-			newImages := extractFiles(centralaResponse.Message, centralaBaseURL)
+			newImages := extractFiles(ctx, centralaResponse.Message, centralaService, artifacts, workspace.Dir)
 			imageFiles = Merge(imageFiles, newImages)
 
 			hints = centralaResponse.Hints
@@ -287,17 +310,17 @@ func SolveTask14(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 	}
 }
 
-func extractFiles(report string, centralaBaseURL string) map[string]*AnalyzedImage {
+func extractFiles(ctx *gin.Context, report string, centralaService *services.CentralaService, artifacts *services.ArtifactStore, workDir string) map[string]*AnalyzedImage {
 	re := regexp.MustCompile(`IMG_\d+(_[A-Z0-9]+)?`)
 	matches := re.FindAllString(report, -1)
 	images := map[string]*AnalyzedImage{}
 
 	for _, match := range matches {
 		fileName := match + "-small.png"
-		url := fmt.Sprintf("%s/dane/barbara/%s", centralaBaseURL, fileName)
-		filePath := fmt.Sprintf("/tmp/task14/%s", fileName)
-		err := services.DownloadFile(url, filePath)
+		url := centralaService.DaneURL("barbara/" + fileName)
+		filePath, err := storeImage(centralaService, artifacts, "barbara/"+fileName, filepath.Join(workDir, fileName))
 		if err != nil {
+			logf(ctx, "[WARN] Failed to fetch image %s: %v", fileName, err)
 			continue
 		}
 
@@ -315,6 +338,29 @@ func extractFiles(report string, centralaBaseURL string) map[string]*AnalyzedIma
 	return images
 }
 
+// storeImage returns a local copy of a shared asset: its artifact when there
+// is a store, otherwise a download to dest.
+func storeImage(centralaService *services.CentralaService, artifacts *services.ArtifactStore, path, dest string) (string, error) {
+	if artifacts == nil {
+		if err := centralaService.DownloadDane(path, dest); err != nil {
+			return "", err
+		}
+		return dest, nil
+	}
+
+	localPath, err := centralaService.DanePath(path)
+	if err != nil {
+		return "", err
+	}
+	defer centralaService.ReleaseDane(localPath)
+
+	artifact, err := artifacts.PutFile(localPath)
+	if err != nil {
+		return "", err
+	}
+	return artifact.Path, nil
+}
+
 func clearFromMarkdown(text string) string {
 	re := regexp.MustCompile(`\` + "`" + `json\s*` + "`" + `\s*`)
 	return re.ReplaceAllString(text, "")
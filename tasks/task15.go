@@ -51,16 +51,10 @@ func extractAHrefURLs(text interface{}) []string {
 
 func SolveTask15(ctx *gin.Context, llmService services.LLMService, centralaBaseURL string, centralaAPIKey string, softoBaseURL string) {
 	openAIService := llmService.(*services.OpenAiService)
-	centralaService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, openAIService)
-
-	body, err := services.GetRequestBody(centralaBaseURL + "/data/" + centralaAPIKey + "/softo.json")
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
 
 	var questions Questions
-	err = json.Unmarshal([]byte(body), &questions)
+	err := centralaService.GetDataJSON("softo.json", &questions)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -232,7 +226,7 @@ func SolveTask15(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 				continue
 			}
 
-			body, err := services.GetRequestBody(urlStr)
+			body, err := getRequestBody(ctx, urlStr)
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
@@ -253,20 +247,28 @@ func SolveTask15(ctx *gin.Context, llmService services.LLMService, centralaBaseU
 				continue
 			}
 			response, err := centralaService.PostReport("softo", params["answer"])
-			if err != nil {
+			if centralaErr, rejected := services.AsCentralaError(err); rejected {
+				// Wrong answers come back with hints the model can use next turn.
+				answerResult = strings.TrimSpace(centralaErr.Message + " " + strings.Join(centralaErr.Hints, " "))
+				actionsTaken = append(actionsTaken, llmResponse)
+				continue
+			} else if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 			actionsTaken = append(actionsTaken, llmResponse)
 
+			if centralaService.DryRun() {
+				respond(ctx, centralaService, gin.H{"answer": params["answer"], "actionsTaken": actionsTaken})
+				return
+			}
+
 			if strings.Contains(response.Message, "{{FLG:") {
 				ctx.JSON(http.StatusOK, gin.H{"body": response})
-			} else {
-				answerResult = response.Message
+				return
 			}
+			answerResult = response.Message
 		}
 
 	}
-
-	ctx.JSON(http.StatusOK, gin.H{"body": body})
 }
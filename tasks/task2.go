@@ -79,6 +79,8 @@ func SolveTask2(ctx *gin.Context, llmService services.LLMService, baseURL string
 			return
 		}
 
+		recordFlags(ctx, "verify", messageMap, message.Text)
+
 		if strings.Contains(message.Text, "{{FLG:") {
 			ctx.JSON(http.StatusOK, gin.H{"flag": message.Text})
 			break
@@ -17,7 +17,7 @@ func SolveTask3(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		return
 	}
 
-	centralaService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, openAIService)
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
 	correctedData, err := centralaService.ProcessCentralaData(llmService)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -26,22 +26,21 @@ func SolveTask3(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		return
 	}
 
-	reportRequest := map[string]interface{}{
-		"task":   "JSON",
-		"apikey": centralaAPIKey,
-		"answer": correctedData,
-	}
-
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	response, err := services.PostJSON(reportURL, reportRequest)
+	response, err := centralaService.PostReport("JSON", correctedData)
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"processedData":  correctedData,
+			"reportResponse": response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to send report: %v", err),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	respond(ctx, centralaService, gin.H{
 		"processedData":  correctedData,
 		"reportResponse": response,
 	})
@@ -17,7 +17,7 @@ func SolveTask4(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		return
 	}
 
-	centralaService := services.NewCentralaService(centralaBaseURL, centralaAPIKey, openAIService)
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
 	content, err := centralaService.GetCensorshipData()
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -61,22 +61,22 @@ func SolveTask4(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		return
 	}
 
-	reportRequest := map[string]interface{}{
-		"task":   "CENZURA",
-		"apikey": centralaAPIKey,
-		"answer": censoredContent,
-	}
-
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	response, err := services.PostJSON(reportURL, reportRequest)
+	response, err := centralaService.PostReport("CENZURA", censoredContent)
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"originalContent": content,
+			"censoredContent": censoredContent,
+			"reportResponse":  response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to send report: %v", err),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	respond(ctx, centralaService, gin.H{
 		"originalContent": content,
 		"censoredContent": censoredContent,
 		"reportResponse":  response,
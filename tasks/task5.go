@@ -1,4 +1,3 @@
-
 package tasks
 
 import (
@@ -10,28 +9,28 @@ import (
 )
 
 func SolveTask5(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-    openAIService, ok := llmService.(*services.OpenAiService)
-    if (!ok) {
-        ctx.JSON(http.StatusInternalServerError, gin.H{
-            "error": "LLM service is not an OpenAI service",
-        })
-        return
-    }
+	openAIService, ok := llmService.(*services.OpenAiService)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": "LLM service is not an OpenAI service",
+		})
+		return
+	}
 
-    transcriptions, err := openAIService.TranscribeDirectory("datasets/task5")
-    if (err != nil) {
-        ctx.JSON(http.StatusInternalServerError, gin.H{
-            "error": fmt.Sprintf("Failed to transcribe audio files: %v", err),
-        })
-        return
-    }
+	transcriptions, err := openAIService.TranscribeDirectory("datasets/task5")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to transcribe audio files: %v", err),
+		})
+		return
+	}
 
-    var combinedText string
-    for _, transcription := range transcriptions {
-        combinedText += transcription + "\n"
-    }
+	var combinedText string
+	for _, transcription := range transcriptions {
+		combinedText += transcription + "\n"
+	}
 
-    prompt := `Please analyze these transcriptions carefully. Think step by step:
+	prompt := `Please analyze these transcriptions carefully. Think step by step:
     Think slowly and carefully.
     Think about any locations which might be connected to universities or educational institutions.
     They might not be directly mentioned.
@@ -44,32 +43,33 @@ func SolveTask5(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
     Transcriptions:
     ` + combinedText
 
-    response, err := openAIService.SendChatMessage(prompt)
-    if (err != nil) {
-        ctx.JSON(http.StatusInternalServerError, gin.H{
-            "error": fmt.Sprintf("Failed to process with GPT: %v", err),
-        })
-        return
-    }
-
-    reportRequest := map[string]interface{}{
-        "task":   "mp3",
-        "apikey": centralaAPIKey,
-        "answer": response,
-    }
+	response, err := openAIService.SendChatMessage(prompt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to process with GPT: %v", err),
+		})
+		return
+	}
 
-    reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-    reportResponse, err := services.PostJSON(reportURL, reportRequest)
-    if (err != nil) {
-        ctx.JSON(http.StatusInternalServerError, gin.H{
-            "error": fmt.Sprintf("Failed to send report: %v", err),
-        })
-        return
-    }
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
+	reportResponse, err := centralaService.PostReport("mp3", response)
+	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"transcriptions": transcriptions,
+			"gptResponse":    response,
+			"reportResponse": reportResponse,
+		}) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to send report: %v", err),
+		})
+		return
+	}
 
-    ctx.JSON(http.StatusOK, gin.H{
-        "transcriptions": transcriptions,
-        "gptResponse":    response,
-        "reportResponse": reportResponse,
-    })
-}
\ No newline at end of file
+	respond(ctx, centralaService, gin.H{
+		"transcriptions": transcriptions,
+		"gptResponse":    response,
+		"reportResponse": reportResponse,
+	})
+}
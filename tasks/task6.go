@@ -1,7 +1,6 @@
 package tasks
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -14,53 +13,57 @@ type RobotDescription struct {
 	Description string `json:"description"`
 }
 
-func SolveTask6(ctx *gin.Context, centralaBaseURL, centralaAPIKey, openaiAPIKey string) {
+func SolveTask6(ctx *gin.Context, imageService *services.ImageGenerationService, centralaBaseURL, centralaAPIKey string) {
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+
 	// Get robot description from centrala
-	robotDescURL := fmt.Sprintf("%s/data/%s/robotid.json", centralaBaseURL, centralaAPIKey)
-	resp, err := http.Get(robotDescURL)
-	if err != nil {
+	var robotDesc RobotDescription
+	if err := centralaService.GetDataJSON("robotid.json", &robotDesc); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch robot description: %v", err)})
 		return
 	}
-	defer resp.Body.Close()
 
-	var robotDesc RobotDescription
-	if err := json.NewDecoder(resp.Body).Decode(&robotDesc); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to decode robot description: %v", err)})
-		return
+	// Without a public bifrost URL Centrala can only reach OpenAI's own link,
+	// so ask for one; the image is stored locally either way.
+	responseFormat := openai.CreateImageResponseFormatB64JSON
+	if !imageService.HasPublicURL() {
+		responseFormat = openai.CreateImageResponseFormatURL
 	}
 
-	// Generate image using DALLE
-	client := openai.NewClient(openaiAPIKey)
-	imageResp, err := client.CreateImage(ctx, openai.ImageRequest{
+	images, err := imageService.Generate(ctx, services.ImageGenerationRequest{
 		Prompt:         robotDesc.Description,
-		Size:          openai.CreateImageSize1024x1024,
-		Model:         openai.CreateImageModelDallE3,
-		N:             1,
-		ResponseFormat: openai.CreateImageResponseFormatURL,
+		Size:           openai.CreateImageSize1024x1024,
+		Model:          openai.CreateImageModelDallE3,
+		ResponseFormat: responseFormat,
 	})
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate image: %v", err)})
 		return
 	}
 
-	// Send report to centrala
-	reportRequest := map[string]interface{}{
-		"task":   "robotid",
-		"apikey": centralaAPIKey,
-		"answer": imageResp.Data[0].URL,
+	imageURL := images[0].URL
+	if imageURL == "" {
+		imageURL = images[0].SourceURL
 	}
 
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	response, err := services.PostJSON(reportURL, reportRequest)
+	// Send report to centrala
+	response, err := centralaService.PostReport("robotid", imageURL)
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"robotDescription":  robotDesc.Description,
+			"generatedImageURL": imageURL,
+			"reportResponse":    response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send report: %v", err)})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"robotDescription": robotDesc.Description,
-		"generatedImageURL": imageResp.Data[0].URL,
-		"reportResponse": response,
+	respond(ctx, centralaService, gin.H{
+		"robotDescription":  robotDesc.Description,
+		"generatedImageURL": imageURL,
+		"generatedImage":    images[0],
+		"reportResponse":    response,
 	})
-}
\ No newline at end of file
+}
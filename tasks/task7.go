@@ -1,12 +1,10 @@
 package tasks
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lumenn/bifrost-agent/services"
@@ -17,6 +15,28 @@ type AnalysisReport struct {
 	Hardware []string `json:"hardware"`
 }
 
+// FileClassification is the category chosen for one file with the model's
+// confidence. SecondPass is set when the first answer was too uncertain and
+// the file was classified again with an explicit analysis.
+type FileClassification struct {
+	File           string                   `json:"file"`
+	Classification *services.Classification `json:"classification,omitempty"`
+	FirstPass      *services.Classification `json:"firstPass,omitempty"`
+	SecondPass     bool                     `json:"secondPass"`
+	Skipped        string                   `json:"skipped,omitempty"`
+}
+
+// Files whose winning category is less likely than this get a second pass.
+const task7MinConfidence = 0.8
+
+var task7Labels = []string{"people", "hardware", "other"}
+
+const task7Instructions = `Classify the content into exactly one category:
+	- "people" if the content is about captured people or about signs of their location.
+		IF REPORT IS ABOUT NO PEOPLE SIGNS CATEGORIZE IT AS OTHER
+	- "hardware" if the content is about equipment or devices being fixed
+	- "other" for anything else (for example software fixes)`
+
 func SolveTask7(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
 	openAIService, ok := llmService.(*services.OpenAiService)
 	if !ok {
@@ -26,49 +46,60 @@ func SolveTask7(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		return
 	}
 
-	report, response, err := processTask7(centralaBaseURL, centralaAPIKey, openAIService)
+	workspace, err := runWorkspace(ctx, "task7")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
+		return
+	}
+
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
+	// The archive goes in its own directory, apart from the workspace metadata
+	report, classifications, response, err := processTask7(ctx, centralaService, openAIService, workspace.Path("files"))
 	if err != nil {
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"sent":            report,
+			"classifications": classifications,
+			"response":        response,
+		}) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to process task: %v", err),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"status":   "success",
-		"sent":     report,
-		"response": response,
+	respond(ctx, centralaService, gin.H{
+		"status":          "success",
+		"sent":            report,
+		"classifications": classifications,
+		"response":        response,
 	})
 }
 
-func processTask7(baseURL, apiKey string, openAI *services.OpenAiService) (*AnalysisReport, map[string]interface{}, error) {
-	workDir := filepath.Join("/tmp", "task7")
+func processTask7(ctx *gin.Context, centralaService *services.CentralaService, openAI *services.OpenAiService, workDir string) (*AnalysisReport, []FileClassification, *services.EntityResponse, error) {
 	openAI.SetSystemPrompt("follow speciified instrictuions with much care")
-	if err := os.MkdirAll(workDir, 0755); err != nil {
-		return nil, nil, fmt.Errorf("failed to create work directory: %w", err)
-	}
-
-	// Download and extract files
-	zipPath := filepath.Join(workDir, "files.zip")
-	downloadURL := fmt.Sprintf("%s/dane/pliki_z_fabryki.zip", baseURL)
 
-	if !services.FileExists(zipPath) {
-		if err := services.DownloadFile(downloadURL, zipPath); err != nil {
-			return nil, nil, fmt.Errorf("failed to download files: %w", err)
-		}
+	// Download (or reuse the mirrored copy of) the archive and extract it
+	zipPath, err := centralaService.DanePath("pliki_z_fabryki.zip")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to download files: %w", err)
 	}
+	defer centralaService.ReleaseDane(zipPath)
 
-	if err := services.UnzipFile(zipPath, workDir, nil); err != nil {
-		return nil, nil, fmt.Errorf("failed to extract files: %w", err)
+	if _, err := services.UnzipFile(zipPath, workDir, nil); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to extract files: %w", err)
 	}
 
-	filePaths, err := services.ListFiles(workDir, ".zip")
+	// Only the files at the root of the archive are analyzed
+	entries, err := services.WalkFiles(workDir, services.WalkOptions{MaxDepth: 1, Exclude: []string{"*.zip"}})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list files: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to list files: %w", err)
 	}
+	filePaths := services.EntryPaths(entries)
 
 	if len(filePaths) == 0 {
-		return nil, nil, fmt.Errorf("no files found to process")
+		return nil, nil, nil, fmt.Errorf("no files found to process")
 	}
 
 	// Initialize with non-nil slices and capacity
@@ -77,106 +108,90 @@ func processTask7(baseURL, apiKey string, openAI *services.OpenAiService) (*Anal
 		Hardware: make([]string, 0, len(filePaths)),
 	}
 
+	extractors := services.NewContentExtractors(openAI)
+	classifications := make([]FileClassification, 0, len(filePaths))
 	processedFiles := 0
 	for _, filePath := range filePaths {
-		category, err := analyzeFile(filePath, openAI)
+		result, err := analyzeFile(ctx, filePath, extractors, openAI)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to analyze %s: %w", filepath.Base(filePath), err)
+			return nil, nil, nil, fmt.Errorf("failed to analyze %s: %w", filepath.Base(filePath), err)
 		}
+		classifications = append(classifications, *result)
 
-		fileName := filepath.Base(filePath)
-		switch category {
+		if result.Classification == nil {
+			continue
+		}
+
+		switch result.Classification.Label {
 		case "people":
-			report.People = append(report.People, fileName)
+			report.People = append(report.People, result.File)
 			processedFiles++
 		case "hardware":
-			report.Hardware = append(report.Hardware, fileName)
+			report.Hardware = append(report.Hardware, result.File)
 			processedFiles++
 		}
 	}
 
 	if processedFiles == 0 {
-		return nil, nil, fmt.Errorf("no files were successfully categorized")
+		return nil, nil, nil, fmt.Errorf("no files were successfully categorized")
 	}
 
 	// Verify report before submission
 	if len(report.People) == 0 && len(report.Hardware) == 0 {
-		return nil, nil, fmt.Errorf("both categories are empty after processing")
+		return nil, nil, nil, fmt.Errorf("both categories are empty after processing")
 	}
 
-	response, err := submitReport(report, baseURL, apiKey)
-	if err != nil {
-		return nil, nil, err
+	// A rejection is returned with the report and response, for the caller to show.
+	response, err := centralaService.PostReport("kategorie", report)
+	if _, rejected := services.AsCentralaError(err); err != nil && !rejected {
+		return nil, nil, nil, err
 	}
 
-	return report, response, nil
+	return report, classifications, &response, err
 }
 
-func analyzeFile(filePath string, openAI *services.OpenAiService) (string, error) {
-	var content string
-	var err error
+// analyzeFile reads a file as text and classifies it. Files with uncertain
+// results are re-classified together with a short analysis of their content.
+func analyzeFile(ctx *gin.Context, filePath string, extractors *services.ExtractorRegistry, openAI *services.OpenAiService) (*FileClassification, error) {
+	result := &FileClassification{File: filepath.Base(filePath)}
 
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".txt", ".md":
-		contentBytes, err := os.ReadFile(filePath)
-		if err != nil {
-			return "", err
-		}
-		content = string(contentBytes)
-	case ".mp3", ".wav", ".m4a":
-		content, err = openAI.TranscribeAudio(filePath)
-		if err != nil {
-			return "", err
-		}
-	case ".jpg", ".jpeg", ".png":
-		content, err = openAI.AnalyzeImages(filePath)
-		if err != nil {
-			return "", err
-		}
-	default:
-		return "other", nil
+	extraction, err := extractors.Extract(filePath)
+	if errors.Is(err, services.ErrNoExtractor) {
+		result.Skipped = fmt.Sprintf("unsupported content type %q", extraction.MIMEType)
+		return result, nil
 	}
-
-	openAI.SetSystemPrompt(`Classify future content into exactly one category. Respond with only one word:
-	- "people" if the content is about captured people or about signs of their location.
-		IF REPORT IS ABOUT NO PEOPLE SIGNS CATEGORIZE IT AS OTHER
-	- "hardware" if the content is about equipment or devices being fixed
-	- "other" for anything else (for example software fixes)`)
-
-	response, err := openAI.SendChatMessage(content)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	content := extraction.Text
 
-	cleanResponse := strings.ToLower(strings.TrimSpace(response))
-
-	// Ensure exact category matching
-	switch cleanResponse {
-	case "people", "hardware":
-		return cleanResponse, nil
-	default:
-		return "other", nil
+	classification, err := openAI.Classify(content, task7Labels, task7Instructions)
+	if err != nil {
+		return nil, err
 	}
-}
+	result.Classification = classification
 
-func submitReport(report *AnalysisReport, baseURL, apiKey string) (map[string]interface{}, error) {
-	reportRequest := map[string]interface{}{
-		"task":   "kategorie",
-		"apikey": apiKey,
-		"answer": report,
+	if !classification.IsAmbiguous(task7MinConfidence) {
+		return result, nil
 	}
 
-	reportURL := fmt.Sprintf("%s/report", baseURL)
-	responseStr, err := services.PostJSON(reportURL, reportRequest)
+	logf(ctx, "[INFO] Classification of %s is ambiguous (p=%.3f) - running second pass", result.File, classification.Probability)
+
+	openAI.SetSystemPrompt(`You review factory reports. In two or three sentences, state whether the content
+	mentions captured people or traces of their presence, and whether it describes repaired hardware
+	(as opposed to software). Quote the deciding phrases.`)
+	analysis, err := openAI.SendChatMessage(content)
 	if err != nil {
 		return nil, err
 	}
 
-	var responseMap map[string]interface{}
-	if err := json.Unmarshal([]byte(responseStr), &responseMap); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	secondPass, err := openAI.Classify(fmt.Sprintf("%s\n\nAnalysis:\n%s", content, analysis), task7Labels, task7Instructions)
+	if err != nil {
+		return nil, err
 	}
 
-	return responseMap, nil
+	result.FirstPass = classification
+	result.Classification = secondPass
+	result.SecondPass = true
+	return result, nil
 }
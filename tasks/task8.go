@@ -1,93 +1,35 @@
 package tasks
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
-	"log"
-
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gin-gonic/gin"
 	"github.com/lumenn/bifrost-agent/services"
 )
 
-func downloadFile(baseURL, url string) (string, error) {
-	fullURL := fmt.Sprintf("%s/%s/%s", baseURL, "dane", url)
-	log.Printf("[DEBUG] Downloading file from URL: %s", fullURL)
-	resp, err := http.Get(fullURL)
-	if err != nil {
-		log.Printf("[ERROR] Download failed from URL %s: %v", fullURL, err)
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	// Extract file extension from URL
-	ext := filepath.Ext(url)
-	if ext == "" {
-		ext = ".tmp"
-	}
-
-	// Create temp file with proper extension
-	tempFile, err := os.CreateTemp("", "media-*"+ext)
-	if err != nil {
-		log.Printf("[ERROR] Failed to create temp file for %s: %v", fullURL, err)
-		return "", err
-	}
-	defer tempFile.Close()
-
-	bytesWritten, err := io.Copy(tempFile, resp.Body)
-	if err != nil {
-		log.Printf("[ERROR] Failed to write file content from %s: %v", fullURL, err)
-		return "", err
-	}
-
-	log.Printf("[INFO] Successfully downloaded %d bytes from %s to %s", bytesWritten, fullURL, tempFile.Name())
-	return tempFile.Name(), nil
-}
-
-func getSHA256Hash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
-func getCachedDescription(hash string) (string, error) {
-	cacheFilePath := filepath.Join("/tmp/task8", hash+".txt")
-	if _, err := os.Stat(cacheFilePath); os.IsNotExist(err) {
-		return "", nil
-	}
+func downloadFile(ctx *gin.Context, centralaService *services.CentralaService, url string) (string, error) {
+	logf(ctx, "[DEBUG] Downloading file from URL: %s", centralaService.DaneURL(url))
 
-	data, err := os.ReadFile(cacheFilePath)
+	localPath, err := centralaService.DanePath(url)
 	if err != nil {
+		logf(ctx, "[ERROR] Download failed for %s: %v", url, err)
 		return "", err
 	}
 
-	return string(data), nil
+	logf(ctx, "[INFO] Successfully downloaded %s to %s", url, localPath)
+	return localPath, nil
 }
 
-func cacheDescription(hash, description string) error {
-	cacheDir := "/tmp/task8"
-	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
-		return err
+// describeMedia returns the derived text of a media file, reusing the one in
+// the artifact store when the file and derivation are unchanged.
+func describeMedia(artifacts *services.ArtifactStore, localPath string, derivation services.Derivation, produce func() (string, error)) (string, error) {
+	if artifacts == nil {
+		return produce()
 	}
-
-	cacheFilePath := filepath.Join(cacheDir, hash+".txt")
-	return os.WriteFile(cacheFilePath, []byte(description), os.ModePerm)
+	return artifacts.DeriveText(localPath, derivation, produce)
 }
 
 func extractTextContent(doc *goquery.Document) string {
@@ -116,12 +58,15 @@ func extractTextContent(doc *goquery.Document) string {
 	return content.String()
 }
 
+// task8MaxAttempts bounds how often rejected answers are revised and resent.
+const task8MaxAttempts = 3
+
 func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	log.Println("[INFO] Starting Task8 execution")
+	logf(ctx, "[INFO] Starting Task8 execution")
 
 	openAIService, ok := llmService.(*services.OpenAiService)
 	if !ok {
-		log.Println("[ERROR] LLM service type assertion failed - expected OpenAI service")
+		logf(ctx, "[ERROR] LLM service type assertion failed - expected OpenAI service")
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": "LLM service is not an OpenAI service",
 		})
@@ -139,61 +84,72 @@ func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		Answer to question 3
 	`)
 
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, openAIService)
+
+	// Media descriptions are kept in the artifact store, keyed by content hash
+	artifacts := artifactStore(ctx)
+
 	// Fetch HTML data
-	arxivHTMLURL := fmt.Sprintf("%s/dane/arxiv-draft.html", centralaBaseURL)
-	log.Printf("[DEBUG] Fetching HTML content from URL: %s", arxivHTMLURL)
-	resp, err := http.Get(arxivHTMLURL)
+	arxivHTML, err := centralaService.GetDane("arxiv-draft.html")
 	if err != nil {
-		log.Printf("[ERROR] HTML fetch failed: %v", err)
+		logf(ctx, "[ERROR] HTML fetch failed: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch arxiv HTML: %v", err)})
 		return
 	}
-	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(arxivHTML))
 	if err != nil {
-		log.Printf("[ERROR] Failed to parse arxiv HTML: %v", err)
+		logf(ctx, "[ERROR] Failed to parse arxiv HTML: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to parse arxiv HTML: %v", err)})
 		return
 	}
 
+	// Fetch all media up front, in parallel; the loops below then read them locally.
+	var mediaSources []string
+	doc.Find("audio source[src], img[src]").Each(func(i int, sel *goquery.Selection) {
+		src, _ := sel.Attr("src")
+		mediaSources = append(mediaSources, src)
+	})
+	mediaPaths, err := centralaService.DanePaths(mediaSources)
+	if err != nil {
+		logf(ctx, "[WARN] Some media could not be prefetched: %v", err)
+	}
+	defer func() {
+		for _, localPath := range mediaPaths {
+			centralaService.ReleaseDane(localPath)
+		}
+	}()
+	mediaPath := func(src string) (string, error) {
+		if localPath, ok := mediaPaths[src]; ok {
+			return localPath, nil
+		}
+		// Retry media the prefetch missed.
+		localPath, err := downloadFile(ctx, centralaService, src)
+		if err == nil {
+			mediaPaths[src] = localPath
+		}
+		return localPath, err
+	}
+
 	var mediaInfos []services.MediaInfo
 	doc.Find("audio source").Each(func(i int, sel *goquery.Selection) {
 		if src, exists := sel.Attr("src"); exists {
-			log.Printf("[DEBUG] Processing audio file: %s", src)
-			localPath, err := downloadFile(centralaBaseURL, src)
-			if err != nil {
-				log.Printf("[ERROR] Audio download failed for %s: %v", src, err)
-				return
-			}
-
-			hash, err := getSHA256Hash(localPath)
+			logf(ctx, "[DEBUG] Processing audio file: %s", src)
+			localPath, err := mediaPath(src)
 			if err != nil {
-				log.Printf("[ERROR] Hash computation failed for audio %s: %v", src, err)
+				logf(ctx, "[ERROR] Audio download failed for %s: %v", src, err)
 				return
 			}
 
-			log.Printf("[DEBUG] Checking cache for audio hash: %s", hash)
-			description, err := getCachedDescription(hash)
+			description, err := describeMedia(artifacts, localPath, services.TranscriptDerivation(), func() (string, error) {
+				logf(ctx, "[INFO] Transcribing audio: %s", localPath)
+				return openAIService.TranscribeAudio(localPath)
+			})
 			if err != nil {
-				log.Printf("[ERROR] Cache retrieval failed for audio %s: %v", src, err)
+				logf(ctx, "[ERROR] Audio transcription failed for %s: %v", src, err)
 				return
 			}
 
-			if description == "" {
-				log.Printf("[INFO] Cache miss - transcribing audio: %s", localPath)
-				description, err = openAIService.TranscribeAudio(localPath)
-				if err != nil {
-					log.Printf("[ERROR] Audio transcription failed for %s: %v", src, err)
-					return
-				}
-				if err := cacheDescription(hash, description); err != nil {
-					log.Printf("[ERROR] Cache storage failed for audio %s: %v", src, err)
-				}
-			} else {
-				log.Printf("[DEBUG] Using cached audio description for: %s", src)
-			}
-
 			mediaInfos = append(mediaInfos, services.MediaInfo{
 				Type:        "audio",
 				URL:         src,
@@ -204,37 +160,26 @@ func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 
 	doc.Find("img").Each(func(i int, sel *goquery.Selection) {
 		if src, exists := sel.Attr("src"); exists {
-			log.Printf("Downloading image from %s", src)
-			localPath, err := downloadFile(centralaBaseURL, src)
+			logf(ctx, "Downloading image from %s", src)
+			localPath, err := mediaPath(src)
 			if err != nil {
-				log.Printf("[ERROR] Failed to download image from %s: %v", src, err)
+				logf(ctx, "[ERROR] Failed to download image from %s: %v", src, err)
 				return
 			}
 
-			hash, err := getSHA256Hash(localPath)
-			if err != nil {
-				log.Printf("[ERROR] Failed to compute hash for image %s: %v", src, err)
-				return
-			}
-
-			description, err := getCachedDescription(hash)
+			prompt := "Describe this image in detail, including any text and notable places visible in it."
+			description, err := describeMedia(artifacts, localPath, services.ImageDescriptionDerivation(prompt), func() (string, error) {
+				logf(ctx, "Analyzing image from %s", localPath)
+				return openAIService.AnalyzeImages(services.ImageAnalysisRequest{
+					Prompt: prompt,
+					Images: []services.ImageInput{{Path: localPath, Label: src}},
+				})
+			})
 			if err != nil {
-				log.Printf("[ERROR] Failed to get cached description for image %s: %v", src, err)
+				logf(ctx, "[ERROR] Failed to analyze image from %s: %v", src, err)
 				return
 			}
 
-			if description == "" {
-				log.Printf("Analyzing image from %s", localPath)
-				description, err = openAIService.AnalyzeImages(localPath)
-				if err != nil {
-					log.Printf("[ERROR] Failed to analyze image from %s: %v", src, err)
-					return
-				}
-				if err := cacheDescription(hash, description); err != nil {
-					log.Printf("[ERROR] Failed to cache description for image %s: %v", src, err)
-				}
-			}
-
 			mediaInfos = append(mediaInfos, services.MediaInfo{
 				Type:        "image",
 				URL:         src,
@@ -252,24 +197,14 @@ func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 	}
 
 	// Fetch questions
-	arxivQuestionsURL := fmt.Sprintf("%s/data/%s/arxiv.txt", centralaBaseURL, centralaAPIKey)
-	log.Printf("Fetching questions from %s", arxivQuestionsURL)
-	resp, err = http.Get(arxivQuestionsURL)
+	questionsData, err := centralaService.GetData("arxiv.txt")
 	if err != nil {
-		log.Printf("[ERROR] Failed to fetch arxiv questions: %v", err)
+		logf(ctx, "[ERROR] Failed to fetch arxiv questions: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch arxiv questions: %v", err)})
 		return
 	}
-	defer resp.Body.Close()
-
-	questionsData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("[ERROR] Failed to read arxiv questions: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read arxiv questions: %v", err)})
-		return
-	}
 
-	questions := strings.Split(string(questionsData), "\n")
+	questions := strings.Split(questionsData, "\n")
 	var validQuestions []string
 	for _, question := range questions {
 		if question != "" {
@@ -280,14 +215,14 @@ func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 	textContent := extractTextContent(doc)
 	combinedPrompt := strings.Join(validQuestions, "\n") + "\n\nContent:\n" + textContent
 
-	log.Printf("[DEBUG] Sending combined prompt to OpenAI (length: %d characters)", len(combinedPrompt))
+	logf(ctx, "[DEBUG] Sending combined prompt to OpenAI (length: %d characters)", len(combinedPrompt))
 	answer, err := openAIService.SendChatMessage(combinedPrompt)
 	if err != nil {
-		log.Printf("[ERROR] OpenAI API call failed: %v", err)
+		logf(ctx, "[ERROR] OpenAI API call failed: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get combined answer: %v", err)})
 		return
 	}
-	log.Printf("[DEBUG] Received answer from OpenAI (length: %d characters)", len(answer))
+	logf(ctx, "[DEBUG] Received answer from OpenAI (length: %d characters)", len(answer))
 
 	answers := make(map[string]string)
 	answerLines := strings.Split(answer, "\n")
@@ -296,25 +231,27 @@ func SolveTask8(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 	}
 
 	// Send report
-	reportRequest := map[string]interface{}{
-		"task":   "arxiv",
-		"apikey": centralaAPIKey,
-		"answer": answers,
-	}
-
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-	log.Printf("[INFO] Sending final report to: %s", reportURL)
-	response, err := services.PostJSON(reportURL, reportRequest)
+	logf(ctx, "[INFO] Sending final report")
+	response, attempts, err := centralaService.SubmitWithRetry("arxiv", answers, task8MaxAttempts,
+		services.LLMReviser(openAIService, combinedPrompt))
 	if err != nil {
-		log.Printf("[ERROR] Report submission failed: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send report: %v", err)})
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"answers":        answers,
+			"attempts":       attempts,
+			"reportResponse": response,
+		}) {
+			return
+		}
+		logf(ctx, "[ERROR] Report submission failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send report: %v", err), "attempts": attempts})
 		return
 	}
 
-	log.Println("[INFO] Task8 completed successfully")
-	ctx.JSON(http.StatusOK, gin.H{
+	logf(ctx, "[INFO] Task8 completed successfully")
+	respond(ctx, centralaService, gin.H{
 		"combinedPrompt": combinedPrompt,
 		"answers":        answers,
+		"attempts":       attempts,
 		"reportResponse": response,
 	})
 }
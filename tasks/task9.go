@@ -3,18 +3,30 @@ package tasks
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lumenn/bifrost-agent/services"
 )
 
+const task9MaxAttempts = 3
+
+// documentGlobs matches the report formats read through the content
+// extractors: plain text, PDFs and office documents.
+var documentGlobs = []string{"*.txt", "*.pdf", "*.docx", "*.odt", "*.xlsx"}
+
+// task9RevisionContext tells the reviser what the keyword answers are for.
+const task9RevisionContext = `The answer maps factory report file names to comma-separated Polish keywords
+describing each report: sectors (fully qualified, e.g. C4), locations, people, job titles,
+captured people (zatrzymanie), animals and programming languages.`
+
 func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseURL, centralaAPIKey string) {
-	log.Println("[INFO] Starting Task9 execution")
+	logf(ctx, "[INFO] Starting Task9 execution")
 
 	llmService.SetSystemPrompt(
 		`You have two tasks: 1. Analyse text and return keywords, 2. Help choosing the context files. 
@@ -25,157 +37,137 @@ func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		</rules>
 		`)
 
-	workDir := "/tmp/task9"
-	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create work directory: %v", err)})
+	centralaService := newCentralaService(ctx, centralaBaseURL, centralaAPIKey, nil)
+
+	workspace, err := runWorkspace(ctx, "task9")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
 		return
 	}
+	// The archive goes in its own directory, apart from the workspace metadata
+	// and the analysis caches
+	workDir := workspace.Path("files")
 
-	// Download and extract files
-	zipPath := filepath.Join(workDir, "files.zip")
-	downloadURL := fmt.Sprintf("%s/dane/pliki_z_fabryki.zip", centralaBaseURL)
-
-	if !services.FileExists(zipPath) {
-		if err := services.DownloadFile(downloadURL, zipPath); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download files: %v", err)})
-			return
-		}
+	// Download (or reuse the mirrored copy of) the archive and extract it
+	zipPath, err := centralaService.DanePath("pliki_z_fabryki.zip")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download files: %v", err)})
+		return
 	}
+	defer centralaService.ReleaseDane(zipPath)
 
-	if err := services.UnzipFile(zipPath, workDir, nil); err != nil {
+	if _, err := services.UnzipFile(zipPath, workDir, nil); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to extract files: %v", err)})
 		return
 	}
 
-	files, err := services.ListFiles(workDir, ".zip")
+	entries, err := services.WalkFiles(workDir, services.WalkOptions{Include: documentGlobs})
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list files: %v", err)})
 		return
 	}
 
-	// Filter files to include only .txt files
-	var txtFiles []string
-	for _, file := range files {
-		if strings.HasSuffix(strings.ToLower(file), ".txt") {
-			txtFiles = append(txtFiles, file)
-		}
-	}
+	// Group the documents by directory instead of assuming the archive layout
+	reports, facts := task9Documents(entries)
+	reportsByPath := entriesByRelPath(reports)
+	factsByPath := entriesByRelPath(facts)
 
-	// Collect facts from /facts directory
-	factsDirectory := filepath.Join(workDir, "facts")
+	extractors := services.NewContentExtractors(nil)
 	factsContent := make(map[string]string)
-	factsFiles, err := os.ReadDir(factsDirectory)
-	if err != nil {
-		log.Printf("[ERROR] Failed to read facts directory: %v", err)
-	} else {
-		for _, file := range factsFiles {
-			if file.IsDir() {
-				continue
-			}
-			content, err := os.ReadFile(filepath.Join(factsDirectory, file.Name()))
-			if err != nil {
-				log.Printf("[ERROR] Failed to read fact file %s: %v", file.Name(), err)
-				continue
-			}
-			factsContent[file.Name()] = string(content)
+	for _, entry := range facts {
+		content, err := extractors.ExtractText(entry.Path)
+		if err != nil {
+			logf(ctx, "[ERROR] Failed to read fact file %s: %v", entry.RelPath, err)
+			continue
 		}
+		factsContent[entry.RelPath] = content
 	}
 
 	// Add both facts and reports analysis caching
-	factsAnalysisPath := filepath.Join(workDir, "facts_analysis.json")
-	reportsAnalysisPath := filepath.Join(workDir, "reports_analysis.json")
+	factsAnalysisPath := workspace.Path("facts_analysis.json")
+	reportsAnalysisPath := workspace.Path("reports_analysis.json")
 	factsAnalysis := make(map[string]string)
 	reportsAnalysis := make(map[string]string)
 
 	// Try to load cached analyses
 	if cachedData, err := os.ReadFile(factsAnalysisPath); err == nil {
 		if err := json.Unmarshal(cachedData, &factsAnalysis); err != nil {
-			log.Printf("[WARN] Failed to parse cached facts analysis: %v", err)
+			logf(ctx, "[WARN] Failed to parse cached facts analysis: %v", err)
 		}
 	}
 
 	if cachedData, err := os.ReadFile(reportsAnalysisPath); err == nil {
 		if err := json.Unmarshal(cachedData, &reportsAnalysis); err != nil {
-			log.Printf("[WARN] Failed to parse cached reports analysis: %v", err)
+			logf(ctx, "[WARN] Failed to parse cached reports analysis: %v", err)
 		}
 	}
 
 	// If cache is empty, perform facts analysis
 	if len(factsAnalysis) == 0 {
-		log.Println("[INFO] Analyzing facts files")
-		for fileName, content := range factsContent {
+		logf(ctx, "[INFO] Analyzing facts files")
+		for _, entry := range facts {
+			content, ok := factsContent[entry.RelPath]
+			if !ok {
+				continue
+			}
 			analysisPrompt := fmt.Sprintf(`Please provide a short description of the following fact:
                 Content: %s
                 Return only the description, nothing else. Use polish language. Important informations are: sectors, locations, people, job titles`, content)
 
 			description, err := llmService.SendChatMessage(analysisPrompt)
 			if err != nil {
-				log.Printf("[ERROR] Facts analysis failed for %s: %v", fileName, err)
+				logf(ctx, "[ERROR] Facts analysis failed for %s: %v", entry.RelPath, err)
 				continue
 			}
-			factsAnalysis[fileName] = strings.TrimSpace(description)
+			factsAnalysis[entry.RelPath] = strings.TrimSpace(description)
 		}
 
 		// Cache the facts analysis
 		if cachedData, err := json.Marshal(factsAnalysis); err == nil {
 			if err := os.WriteFile(factsAnalysisPath, cachedData, 0644); err != nil {
-				log.Printf("[WARN] Failed to cache facts analysis: %v", err)
+				logf(ctx, "[WARN] Failed to cache facts analysis: %v", err)
 			}
 		}
 	}
 
 	// Analyze reports if not cached
 	if len(reportsAnalysis) == 0 {
-		log.Println("[INFO] Analyzing report files")
-		for _, file := range txtFiles {
-			if filepath.Dir(file) == factsDirectory {
-				continue
-			}
-
-			fileName := filepath.Base(file)
-			// Reports are in the root directory
-			reportPath := filepath.Join(workDir, fileName)
-
-			content, err := os.ReadFile(reportPath)
+		logf(ctx, "[INFO] Analyzing report files")
+		for _, entry := range reports {
+			content, err := extractors.ExtractText(entry.Path)
 			if err != nil {
-				log.Printf("[ERROR] Failed to read file %s: %v", fileName, err)
+				logf(ctx, "[ERROR] Failed to read file %s: %v", entry.RelPath, err)
 				continue
 			}
 
 			analysisPrompt := fmt.Sprintf(`Please provide a short description of the following report:
                 Content: %s
-                Return only the description, nothing else. Use polish language. Max 2 sentences. Important informations are: sectors, locations, people, job titles`, string(content))
+                Return only the description, nothing else. Use polish language. Max 2 sentences. Important informations are: sectors, locations, people, job titles`, content)
 
 			description, err := llmService.SendChatMessage(analysisPrompt)
 			if err != nil {
-				log.Printf("[ERROR] Report analysis failed for %s: %v", fileName, err)
+				logf(ctx, "[ERROR] Report analysis failed for %s: %v", entry.RelPath, err)
 				continue
 			}
-			reportsAnalysis[fileName] = strings.TrimSpace(description)
+			reportsAnalysis[entry.RelPath] = strings.TrimSpace(description)
 		}
 
 		// Cache the reports analysis
 		if cachedData, err := json.Marshal(reportsAnalysis); err == nil {
 			if err := os.WriteFile(reportsAnalysisPath, cachedData, 0644); err != nil {
-				log.Printf("[WARN] Failed to cache reports analysis: %v", err)
+				logf(ctx, "[WARN] Failed to cache reports analysis: %v", err)
 			}
 		}
 	}
 
 	// Modify the context prompt to include both facts and reports descriptions
 	fileAnalysis := make(map[string]string)
-	for _, file := range txtFiles {
-		if filepath.Dir(file) == factsDirectory {
-			continue
-		}
-
-		fileName := filepath.Base(file)
-		log.Printf("[INFO] Analyzing file: %s", fileName)
+	for _, report := range reports {
+		logf(ctx, "[INFO] Analyzing file: %s", report.RelPath)
 
-		// Read from root directory for reports
-		content, err := os.ReadFile(filepath.Join(workDir, fileName))
+		content, err := extractors.ExtractText(report.Path)
 		if err != nil {
-			log.Printf("[ERROR] Failed to read file %s: %v", fileName, err)
+			logf(ctx, "[ERROR] Failed to read file %s: %v", report.RelPath, err)
 			continue
 		}
 
@@ -192,26 +184,29 @@ func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 		%s
 
 		Should I include any of these materials to better understand the content? 
-		Prepare response as json object with both facts and reports: 
+		Prepare response as json object with both facts and reports, using the file paths exactly as listed: 
 		{ 
 			"facts": { "filename01.ext": 1, "filename0X.ext": 0 },
 			"reports": { "2024-11-12_report-XX-sektor_XX.ext": 1, "2024-11-12_report-XX-sektor_XX.ext": 0 }
 		}
 		Mark all files as either 1 (needed) or 0 (not needed). No additional formatting.`,
-			fileName,
-			string(content),
+			report.RelPath,
+			content,
 			func() string {
 				var descriptions []string
-				for fname, desc := range factsAnalysis {
-					descriptions = append(descriptions, fmt.Sprintf("%s: %s", fname, desc))
+				for _, fact := range facts {
+					if desc, ok := factsAnalysis[fact.RelPath]; ok {
+						descriptions = append(descriptions, fmt.Sprintf("%s: %s", fact.RelPath, desc))
+					}
 				}
 				return strings.Join(descriptions, "\n")
 			}(),
 			func() string {
 				var descriptions []string
-				for fname, desc := range reportsAnalysis {
-					if fname != fileName { // Exclude current file
-						descriptions = append(descriptions, fmt.Sprintf("%s: %s", fname, desc))
+				for _, other := range reports {
+					// Exclude current file
+					if desc, ok := reportsAnalysis[other.RelPath]; ok && other.RelPath != report.RelPath {
+						descriptions = append(descriptions, fmt.Sprintf("%s: %s", other.RelPath, desc))
 					}
 				}
 				return strings.Join(descriptions, "\n")
@@ -219,7 +214,7 @@ func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 
 		needsContext, err := llmService.SendChatMessage(contextPrompt)
 		if err != nil {
-			log.Printf("[ERROR] Context check failed for %s: %v", fileName, err)
+			logf(ctx, "[ERROR] Context check failed for %s: %v", report.RelPath, err)
 			continue
 		}
 
@@ -229,38 +224,47 @@ func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 			Reports map[string]int `json:"reports"`
 		}
 		if err := json.Unmarshal([]byte(needsContext), &contextNeeded); err != nil {
-			log.Printf("[ERROR] Failed to parse context response for %s: %v", fileName, err)
+			logf(ctx, "[ERROR] Failed to parse context response for %s: %v", report.RelPath, err)
 			continue
 		}
 
 		// Build analysis prompt with relevant context from both facts and reports
 		var contextBuilder strings.Builder
-		contextBuilder.WriteString(fmt.Sprintf("Content of file %s:\n%s\n\n", fileName, string(content)))
+		contextBuilder.WriteString(fmt.Sprintf("Content of file %s:\n%s\n\n", report.RelPath, content))
 
-		// Add relevant facts with proper path handling
+		// Only files found in the archive are read, whatever names the LLM returns
 		for factFile, needed := range contextNeeded.Facts {
-			if needed == 1 {
-				factContent, err := os.ReadFile(filepath.Join(workDir, "facts", factFile))
-				if err != nil {
-					log.Printf("[ERROR] Failed to read fact file %s: %v", factFile, err)
-					continue
-				}
-				contextBuilder.WriteString(fmt.Sprintf("Additional fact from %s:\n%s\n\n",
-					factFile, string(factContent)))
+			if needed != 1 {
+				continue
+			}
+			if _, ok := factsByPath[factFile]; !ok {
+				logf(ctx, "[WARN] Skipping unknown fact file %s", factFile)
+				continue
+			}
+			factContent, ok := factsContent[factFile]
+			if !ok {
+				continue
 			}
+			contextBuilder.WriteString(fmt.Sprintf("Additional fact from %s:\n%s\n\n",
+				factFile, factContent))
 		}
 
 		for reportFile, needed := range contextNeeded.Reports {
-			if needed == 1 {
-				// Read reports from root directory
-				reportContent, err := os.ReadFile(filepath.Join(workDir, reportFile))
-				if err != nil {
-					log.Printf("[WARN] Failed to read report file %s: %v", reportFile, err)
-					continue
-				}
-				contextBuilder.WriteString(fmt.Sprintf("Additional report from %s:\n%s\n\n",
-					reportFile, string(reportContent)))
+			if needed != 1 {
+				continue
+			}
+			related, ok := reportsByPath[reportFile]
+			if !ok {
+				logf(ctx, "[WARN] Skipping unknown report file %s", reportFile)
+				continue
 			}
+			reportContent, err := extractors.ExtractText(related.Path)
+			if err != nil {
+				logf(ctx, "[WARN] Failed to read report file %s: %v", reportFile, err)
+				continue
+			}
+			contextBuilder.WriteString(fmt.Sprintf("Additional report from %s:\n%s\n\n",
+				reportFile, reportContent))
 		}
 
 		analysisPrompt := contextBuilder.String() + `
@@ -275,31 +279,74 @@ func SolveTask9(ctx *gin.Context, llmService services.LLMService, centralaBaseUR
 
 		keywords, err := llmService.SendChatMessage(analysisPrompt)
 		if err != nil {
-			log.Printf("[ERROR] Analysis failed for %s: %v", fileName, err)
+			logf(ctx, "[ERROR] Analysis failed for %s: %v", report.RelPath, err)
 			continue
 		}
 
-		fileAnalysis[fileName] = strings.TrimSpace(keywords)
+		// Centrala expects the reports' file names as keys
+		fileAnalysis[path.Base(report.RelPath)] = strings.TrimSpace(keywords)
 	}
 
 	// Send response to task endpoint
-	reportURL := fmt.Sprintf("%s/report", centralaBaseURL)
-
-	reportRequest := map[string]interface{}{
-		"task":   "dokumenty",
-		"apikey": centralaAPIKey,
-		"answer": fileAnalysis,
-	}
-
-	response, err := services.PostJSON(reportURL, reportRequest)
+	response, attempts, err := centralaService.SubmitWithRetry("dokumenty", fileAnalysis, task9MaxAttempts,
+		services.LLMReviser(llmService, task9RevisionContext))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send response: %v", err)})
+		if respondRejected(ctx, centralaService, err, gin.H{
+			"answer":   fileAnalysis,
+			"attempts": attempts,
+			"response": response,
+		}) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send response: %v", err), "attempts": attempts})
 		return
 	}
 
-	log.Println("[INFO] Task9 completed successfully")
-	ctx.JSON(http.StatusOK, gin.H{
-		"reportRequest": reportRequest,
-		"response":      response,
+	logf(ctx, "[INFO] Task9 completed successfully")
+	respond(ctx, centralaService, gin.H{
+		"answer":   fileAnalysis,
+		"attempts": attempts,
+		"response": response,
 	})
 }
+
+// task9ReportPattern matches report file names such as
+// 2024-11-12_report-00-sektor_C4.txt.
+var task9ReportPattern = regexp.MustCompile(`(?i)report`)
+
+// task9Documents splits the walked files by directory: a directory whose files
+// are all named like reports holds reports, any other holds facts.
+func task9Documents(entries []services.FileEntry) (reports, facts []services.FileEntry) {
+	groups := services.GroupByDir(entries)
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		group := groups[dir]
+		isReports := true
+		for _, entry := range group {
+			if !task9ReportPattern.MatchString(path.Base(entry.RelPath)) {
+				isReports = false
+				break
+			}
+		}
+		if isReports {
+			reports = append(reports, group...)
+		} else {
+			facts = append(facts, group...)
+		}
+	}
+	return reports, facts
+}
+
+// entriesByRelPath indexes entries by their path relative to the walk root.
+func entriesByRelPath(entries []services.FileEntry) map[string]services.FileEntry {
+	byPath := make(map[string]services.FileEntry, len(entries))
+	for _, entry := range entries {
+		byPath[entry.RelPath] = entry
+	}
+	return byPath
+}